@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/edwinbm5/go-product-web/internal/auth"
+)
+
+const keysUsage = `usage: keys <command> [flags]
+
+commands:
+  add -name NAME -scopes SCOPE[,...] [-roles ROLE[,...]]
+                                            create a key and print it, roles default to the roles of the scopes
+  list                                      list the keys
+  revoke -name NAME                         delete a key
+
+every command accepts -file PATH, by default AUTH_KEYS_FILE, and -policy PATH, by default POLICY_FILE
+scopes: products:read, products:write, products:delete, webhooks:manage, audit:read
+roles: viewer, editor, admin (or any role of the policy file)
+the keys without roles are given the roles of their scopes: products:read viewer, products:write
+editor, products:delete, webhooks:manage and audit:read admin
+
+a running server uses the new keys once it is sent SIGHUP (kill -HUP <pid>) or restarted
+`
+
+// keysReload reminds that a running server still uses the keys it loaded
+const keysReload = "send SIGHUP to a running server (kill -HUP <pid>) or restart it to use the change"
+
+// runKeys manages the API keys file, it returns the exit code of the process
+func runKeys(args []string) (code int) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, keysUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("keys "+args[0], flag.ContinueOnError)
+	file := fs.String("file", os.Getenv("AUTH_KEYS_FILE"), "keys file")
+	name := fs.String("name", "", "key name")
+	scopes := fs.String("scopes", "", "comma separated scopes")
+	roles := fs.String("roles", "", "comma separated roles, the roles of the scopes when empty")
+	policyFile := fs.String("policy", os.Getenv("POLICY_FILE"), "policy file with the roles, the default policy when empty")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "keys: -file or AUTH_KEYS_FILE is required")
+		return 2
+	}
+
+	keys := auth.NewAuthKeys(*file)
+	if *policyFile != "" {
+		policy, err := auth.LoadPolicy(*policyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		keys.Policy = policy
+	}
+
+	if err := keys.Load(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch args[0] {
+	case "add":
+		if *name == "" || *scopes == "" {
+			fmt.Fprint(os.Stderr, keysUsage)
+			return 2
+		}
+
+		keyScopes := strings.Split(*scopes, ",")
+		keyRoles := auth.RolesFromScopes(keyScopes)
+		if *roles != "" {
+			keyRoles = strings.Split(*roles, ",")
+		}
+
+		token, err := keys.Add(*name, keyScopes, keyRoles)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		fmt.Printf("key %s created, store it now since it can't be shown again:\n%s\n", *name, token)
+		fmt.Println(keysReload)
+	case "list":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tSCOPES\tROLES\tCREATED")
+		for _, key := range keys.List() {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", key.Name, strings.Join(key.Scopes, ","), strings.Join(key.Roles, ","), key.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		tw.Flush()
+	case "revoke":
+		if *name == "" {
+			fmt.Fprint(os.Stderr, keysUsage)
+			return 2
+		}
+
+		if err := keys.Revoke(*name); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		fmt.Printf("key %s revoked\n", *name)
+		fmt.Println(keysReload)
+	default:
+		fmt.Fprint(os.Stderr, keysUsage)
+		return 2
+	}
+
+	return 0
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/edwinbm5/go-product-web/internal/application"
 	"github.com/joho/godotenv"
@@ -14,11 +16,57 @@ func main() {
 		panic(err)
 	}
 
+	// subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "keys":
+			os.Exit(runKeys(os.Args[2:]))
+		case "products":
+			os.Exit(runProducts(os.Args[2:]))
+		}
+	}
+
+	// an invalid or missing value falls back to the default of the application
+	compactEvery, _ := strconv.Atoi(os.Getenv("DB_COMPACT_EVERY"))
+	privateReads, _ := strconv.ParseBool(os.Getenv("PRIVATE_READS"))
+	jwtTTL, _ := time.ParseDuration(os.Getenv("JWT_TTL"))
+	idempotencyTTL, _ := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL"))
+	eventLogSize, _ := strconv.Atoi(os.Getenv("EVENT_LOG_SIZE"))
+	webhookMaxAttempts, _ := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS"))
+	webhookBackoff, _ := time.ParseDuration(os.Getenv("WEBHOOK_BACKOFF"))
+	trashRetention, _ := time.ParseDuration(os.Getenv("TRASH_RETENTION"))
+	reserveTrashedCodes, _ := strconv.ParseBool(os.Getenv("TRASH_RESERVE_CODES"))
+	legacyTokenHeader, err := strconv.ParseBool(os.Getenv("LEGACY_TOKEN_HEADER"))
+	if err != nil {
+		legacyTokenHeader = true
+	}
+
 	App := application.NewDefaultApp(application.ConfigDefaultApp{
-		Title:    os.Getenv("APP_TITLE"),
-		Color:    os.Getenv("APP_CLI_COLOR"),
-		FilePath: os.Getenv("DB_PATH") + os.Getenv("DB_FILE_NAME"),
-		Token:    os.Getenv("TOKEN"),
+		Title:        os.Getenv("APP_TITLE"),
+		Color:        os.Getenv("APP_CLI_COLOR"),
+		FilePath:     os.Getenv("DB_PATH") + os.Getenv("DB_FILE_NAME"),
+		CompactEvery: compactEvery,
+		Token:        os.Getenv("TOKEN"),
+		KeysFilePath: os.Getenv("AUTH_KEYS_FILE"),
+		PrivateReads: privateReads,
+		DateFormat:   os.Getenv("DATE_FORMAT"),
+		PolicyFile:   os.Getenv("POLICY_FILE"),
+
+		IdempotencyTTL: idempotencyTTL,
+		EventLogSize:   eventLogSize,
+
+		WebhookMaxAttempts: webhookMaxAttempts,
+		WebhookBackoff:     webhookBackoff,
+
+		TrashRetention:      trashRetention,
+		ReserveTrashedCodes: reserveTrashedCodes,
+
+		JWTSecret:         os.Getenv("JWT_SECRET"),
+		JWTKey:            os.Getenv("JWT_ED25519_KEY"),
+		JWTIssuer:         os.Getenv("JWT_ISSUER"),
+		JWTAudience:       os.Getenv("JWT_AUDIENCE"),
+		JWTTTL:            jwtTTL,
+		LegacyTokenHeader: legacyTokenHeader,
 	})
 
 	App.Run()
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/application"
+	"github.com/edwinbm5/go-product-web/internal/auth"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+	"github.com/edwinbm5/go-product-web/internal/repository"
+	"github.com/edwinbm5/go-product-web/internal/service"
+	"github.com/edwinbm5/go-product-web/internal/storage"
+)
+
+const productsUsage = `usage: products <command> [flags]
+
+commands:
+  export [-format csv|excel] [-out FILE]    write the products as CSV, to stdout by default
+  import -in FILE [-strategy insert|upsert|replace] [-dry-run] [-mapping COLUMN=FIELD[,...]]
+                                            import the products of a CSV, insert by default
+
+every command accepts -db PATH, by default DB_PATH and DB_FILE_NAME
+an export only reads the database and can run next to the server
+an import refuses to run while the server has the database open, stop the server first. The changes of an
+import are audited as the cli and added to the events of the products, the server sends them to the
+webhooks and to the clients that resume the events once it is started again
+`
+
+// runProducts exports and imports the products of the database file, it returns the exit code of the process
+func runProducts(args []string) (code int) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, productsUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("products "+args[0], flag.ContinueOnError)
+	db := fs.String("db", os.Getenv("DB_PATH")+os.Getenv("DB_FILE_NAME"), "database file")
+	format := fs.String("format", "csv", "export format, csv or excel")
+	out := fs.String("out", "", "exported file")
+	in := fs.String("in", "", "imported file")
+	strategy := fs.String("strategy", internal.ProductImportInsert, "import strategy, insert, upsert or replace")
+	dryRun := fs.Bool("dry-run", false, "check the import without applying it")
+	mapping := fs.String("mapping", "", "comma separated column=field pairs")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if *db == "" {
+		fmt.Fprintln(os.Stderr, "products: -db or DB_PATH and DB_FILE_NAME are required")
+		return 2
+	}
+
+	// the commands run as the owner of the database file, without a policy
+	reserveTrashedCodes, _ := strconv.ParseBool(os.Getenv("TRASH_RESERVE_CODES"))
+	ctx := auth.NewContext(context.Background(), auth.Principal{Name: "cli"})
+
+	switch args[0] {
+	case "export":
+		if *format != "csv" && *format != "excel" {
+			fmt.Fprint(os.Stderr, productsUsage)
+			return 2
+		}
+
+		dateLayout, err := tools.DateLayout(os.Getenv("DATE_FORMAT"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		// the file is only read, so the snapshot and the log of a running server are left as they are
+		repo, err := application.LoadProductRepository(*db, reserveTrashedCodes)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		products, _, err := service.NewDefaultProduct(repo, nil).GetAll(ctx, internal.ProductQuery{})
+		if err != nil && !errors.Is(err, internal.ErrProductsEmpty) {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			file, err := os.Create(*out)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer file.Close()
+			w = file
+		}
+
+		if err := internal.WriteProductsCSV(w, products, dateLayout, *format == "excel"); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		if *out != "" {
+			fmt.Printf("%d products exported to %s\n", len(products), *out)
+		}
+	case "import":
+		if *in == "" {
+			fmt.Fprint(os.Stderr, productsUsage)
+			return 2
+		}
+
+		columns, err := internal.ParseProductCSVMapping([]string{*mapping})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+
+		file, err := os.Open(*in)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+
+		rows, err := internal.ReadProductsCSV(file, columns)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		sv, closeSv, err := openProductsService(*db, reserveTrashedCodes)
+		if errors.Is(err, storage.ErrStorageLocked) {
+			fmt.Fprintln(os.Stderr, "products: the database is open in a running server, stop it before the import")
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer closeSv()
+
+		report, err := sv.Import(ctx, internal.ProductImport{Rows: rows, Strategy: *strategy, DryRun: *dryRun})
+		var rowErrs internal.ProductRowErrors
+		if err != nil && !errors.As(err, &rowErrs) {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		// a dry run reports the invalid rows without an error
+		if rowErrs == nil {
+			rowErrs = report.Errors
+		}
+
+		if len(rowErrs) > 0 {
+			for _, rowErr := range rowErrs {
+				fmt.Fprintln(os.Stderr, rowErr)
+			}
+			fmt.Fprintf(os.Stderr, "%d of %d rows are invalid, nothing was imported\n", len(rowErrs), len(rows))
+			return 1
+		}
+
+		verb := "imported"
+		if *dryRun {
+			verb = "checked, nothing was imported"
+		}
+		fmt.Printf("%d rows %s: %d created, %d updated, %d deleted\n", len(rows), verb, report.Created, report.Updated, report.Deleted)
+	default:
+		fmt.Fprint(os.Stderr, productsUsage)
+		return 2
+	}
+
+	return 0
+}
+
+// openProductsService opens the products of the database file for writing, with their events and audit
+// log as the server does. closeSv closes the files
+func openProductsService(db string, reserveTrashedCodes bool) (sv internal.ProductService, closeSv func(), err error) {
+	compactEvery, _ := strconv.Atoi(os.Getenv("DB_COMPACT_EVERY"))
+	repo, closeRepo, err := application.OpenProductRepository(db, compactEvery, reserveTrashedCodes)
+	if err != nil {
+		return
+	}
+
+	eventLogSize, _ := strconv.Atoi(os.Getenv("EVENT_LOG_SIZE"))
+	if eventLogSize < 1 {
+		eventLogSize = 1000
+	}
+
+	events := storage.NewEventLog(db+".events", eventLogSize)
+	if err = events.Open(); err != nil {
+		closeRepo()
+		return
+	}
+
+	audit := storage.NewAuditFile(db + ".audit")
+	if err = audit.Open(); err != nil {
+		events.Close()
+		closeRepo()
+		return
+	}
+
+	sv = service.NewProductAudited(service.NewDefaultProduct(repository.NewProductEvents(repo, events), nil), audit)
+	closeSv = func() {
+		audit.Close()
+		events.Close()
+		closeRepo()
+	}
+	return
+}
@@ -1,28 +1,95 @@
 package application
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/edwinbm5/go-product-web/internal"
 	"github.com/edwinbm5/go-product-web/internal/auth"
 	"github.com/edwinbm5/go-product-web/internal/handler"
+	"github.com/edwinbm5/go-product-web/internal/platform/codec"
+	"github.com/edwinbm5/go-product-web/internal/platform/idempotency"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
 	"github.com/edwinbm5/go-product-web/internal/repository"
 	"github.com/edwinbm5/go-product-web/internal/service"
+	"github.com/edwinbm5/go-product-web/internal/storage"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 type DefaultApp struct {
-	Title    string
-	Color    string
-	FilePath string
-	Token    string
+	Title        string
+	Color        string
+	FilePath     string
+	CompactEvery int
+	Token        string
+	KeysFilePath string
+	PrivateReads bool
+	DateFormat   string
+	PolicyFile   string
+	// IdempotencyTTL is how long the responses of the requests with an Idempotency-Key are replayed
+	IdempotencyTTL time.Duration
+	// EventLogSize is the number of events of the products kept for the clients that resume the feed
+	EventLogSize int
+	// WebhookMaxAttempts and WebhookBackoff are the attempts of a delivery and the wait after its first failure
+	WebhookMaxAttempts int
+	WebhookBackoff     time.Duration
+	// TrashRetention is how long the deleted products are kept, ReserveTrashedCodes keeps their code values taken
+	TrashRetention      time.Duration
+	ReserveTrashedCodes bool
+	// Codecs are the formats served besides the default ones
+	Codecs []codec.Codec
+
+	JWTSecret         string
+	JWTKey            string
+	JWTIssuer         string
+	JWTAudience       string
+	JWTTTL            time.Duration
+	LegacyTokenHeader bool
 }
 
 type ConfigDefaultApp struct {
-	Title    string `json:"title"`
-	Color    string `json:"color"`
-	FilePath string `json:"file_path"`
-	Token    string `json:"token"`
+	Title        string `json:"title"`
+	Color        string `json:"color"`
+	FilePath     string `json:"file_path"`
+	CompactEvery int    `json:"compact_every"`
+	Token        string `json:"token"`
+	KeysFilePath string `json:"keys_file_path"`
+	PrivateReads bool   `json:"private_reads"`
+	DateFormat   string `json:"date_format"`
+	// PolicyFile maps the roles to their permissions, the default policy is used when empty
+	PolicyFile string `json:"policy_file"`
+	// IdempotencyTTL is how long the responses of the requests with an Idempotency-Key are replayed
+	IdempotencyTTL time.Duration `json:"idempotency_ttl"`
+	// EventLogSize is the number of events of the products kept for the clients that resume the feed,
+	// they are saved next to the file of the products
+	EventLogSize int `json:"event_log_size"`
+	// WebhookMaxAttempts is the number of failed attempts after which a delivery is dead
+	WebhookMaxAttempts int `json:"webhook_max_attempts"`
+	// WebhookBackoff is the wait after the first failed attempt of a delivery, doubled after each failure
+	WebhookBackoff time.Duration `json:"webhook_backoff"`
+	// TrashRetention is how long the deleted products are kept in the trash before they are purged
+	TrashRetention time.Duration `json:"trash_retention"`
+	// ReserveTrashedCodes keeps the code values of the products of the trash taken until they are purged,
+	// by default they can be used by other products and a restore fails if its code value was taken
+	ReserveTrashedCodes bool `json:"reserve_trashed_codes"`
+	// Codecs are registered after JSON, XML, YAML, MessagePack and CSV, and replace the default
+	// codec of their first media type
+	Codecs []codec.Codec `json:"-"`
+
+	// JWTSecret signs the tokens with HS256, JWTKey (a base64 Ed25519 seed) with EdDSA
+	JWTSecret   string        `json:"jwt_secret"`
+	JWTKey      string        `json:"jwt_key"`
+	JWTIssuer   string        `json:"jwt_issuer"`
+	JWTAudience string        `json:"jwt_audience"`
+	JWTTTL      time.Duration `json:"jwt_ttl"`
+	// LegacyTokenHeader keeps accepting the token header when signed tokens are enabled
+	LegacyTokenHeader bool `json:"legacy_token_header"`
 }
 
 func NewDefaultApp(cfg ConfigDefaultApp) *DefaultApp {
@@ -31,11 +98,65 @@ func NewDefaultApp(cfg ConfigDefaultApp) *DefaultApp {
 		cfg.Title = "Generic App"
 	}
 
+	if cfg.CompactEvery < 1 {
+		cfg.CompactEvery = 100
+	}
+
+	if cfg.IdempotencyTTL <= 0 {
+		cfg.IdempotencyTTL = 24 * time.Hour
+	}
+
+	if cfg.EventLogSize < 1 {
+		cfg.EventLogSize = 1000
+	}
+
+	if cfg.WebhookMaxAttempts < 1 {
+		cfg.WebhookMaxAttempts = service.WebhookMaxAttempts
+	}
+
+	if cfg.WebhookBackoff <= 0 {
+		cfg.WebhookBackoff = service.WebhookBackoff
+	}
+
+	if cfg.TrashRetention <= 0 {
+		cfg.TrashRetention = service.TrashRetention
+	}
+
+	if cfg.JWTIssuer == "" {
+		cfg.JWTIssuer = "go-product-web"
+	}
+
+	if cfg.JWTTTL <= 0 {
+		cfg.JWTTTL = 15 * time.Minute
+	}
+
 	return &DefaultApp{
-		Title:    cfg.Title,
-		Color:    cfg.Color,
-		FilePath: cfg.FilePath,
-		Token:    cfg.Token,
+		Title:        cfg.Title,
+		Color:        cfg.Color,
+		FilePath:     cfg.FilePath,
+		CompactEvery: cfg.CompactEvery,
+		Token:        cfg.Token,
+		KeysFilePath: cfg.KeysFilePath,
+		PrivateReads: cfg.PrivateReads,
+		DateFormat:   cfg.DateFormat,
+		PolicyFile:   cfg.PolicyFile,
+
+		IdempotencyTTL: cfg.IdempotencyTTL,
+		EventLogSize:   cfg.EventLogSize,
+		Codecs:         cfg.Codecs,
+
+		WebhookMaxAttempts: cfg.WebhookMaxAttempts,
+		WebhookBackoff:     cfg.WebhookBackoff,
+
+		TrashRetention:      cfg.TrashRetention,
+		ReserveTrashedCodes: cfg.ReserveTrashedCodes,
+
+		JWTSecret:         cfg.JWTSecret,
+		JWTKey:            cfg.JWTKey,
+		JWTIssuer:         cfg.JWTIssuer,
+		JWTAudience:       cfg.JWTAudience,
+		JWTTTL:            cfg.JWTTTL,
+		LegacyTokenHeader: cfg.LegacyTokenHeader,
 	}
 }
 
@@ -43,24 +164,286 @@ func (d *DefaultApp) Run() {
 	fmt.Println("Running application...")
 	fmt.Printf("Title: %s\n", d.Title)
 
-	auth := auth.NewAuthDefault(d.Token)
+	dateLayout, err := tools.DateLayout(d.DateFormat)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	policy := auth.DefaultPolicy()
+	if d.PolicyFile != "" {
+		policy, err = auth.LoadPolicy(d.PolicyFile)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	// API keys replace the shared token when a keys file is configured
+	var keys auth.Auth = auth.NewAuthDefault(d.Token)
+	if d.KeysFilePath != "" {
+		authKeys := auth.NewAuthKeys(d.KeysFilePath)
+		authKeys.Policy = policy
+		if err := authKeys.Load(); err != nil {
+			fmt.Println(err)
+			return
+		}
+		keys = authKeys
+
+		// the keys added or revoked by the keys command are loaded on SIGHUP
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		defer signal.Stop(reload)
+		go func() {
+			for range reload {
+				if err := authKeys.Load(); err != nil {
+					fmt.Println("keys:", err)
+					continue
+				}
+				fmt.Println("keys: reloaded")
+			}
+		}()
+	}
+
+	// signed tokens are enabled when a signing key is configured
+	var jwt *auth.AuthJWT
+	switch {
+	case d.JWTKey != "":
+		private, err := auth.ParseEd25519Seed(d.JWTKey)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		jwt = auth.NewAuthJWTEdDSA(private, d.JWTIssuer, d.JWTAudience, d.JWTTTL)
+	case d.JWTSecret != "":
+		jwt = auth.NewAuthJWTHS256([]byte(d.JWTSecret), d.JWTIssuer, d.JWTAudience, d.JWTTTL)
+	}
+
+	// without signed tokens the token header is the only way to authenticate
+	var bearer, legacy auth.Auth
+	if jwt != nil {
+		bearer = jwt
+	}
+	if jwt == nil || d.LegacyTokenHeader {
+		legacy = keys
+	}
+
+	repo, closeRepo, err := OpenProductRepository(d.FilePath, d.CompactEvery, d.ReserveTrashedCodes)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer closeRepo()
+
+	// the events are kept in memory without a file of the products
+	eventsFilePath := ""
+	if d.FilePath != "" {
+		eventsFilePath = d.FilePath + ".events"
+	}
+
+	events := storage.NewEventLog(eventsFilePath, d.EventLogSize)
+	if err := events.Open(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer events.Close()
+	repo = repository.NewProductEvents(repo, events)
+
+	// the webhooks and their queue are kept next to the products, the dispatcher stops with the application
+	webhooksFilePath := ""
+	if d.FilePath != "" {
+		webhooksFilePath = d.FilePath + ".webhooks"
+	}
+
+	webhooks := storage.NewWebhookFile(webhooksFilePath)
+	if err := webhooks.Load(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer webhooks.Close()
+
+	dispatcher := service.NewWebhookDispatcher(webhooks, events, dateLayout)
+	dispatcher.MaxAttempts, dispatcher.Backoff = d.WebhookMaxAttempts, d.WebhookBackoff
+
+	// the changes made through the service are audited next to the products, the file is never rewritten
+	auditFilePath := ""
+	if d.FilePath != "" {
+		auditFilePath = d.FilePath + ".audit"
+	}
+
+	audit := storage.NewAuditFile(auditFilePath)
+	if err := audit.Open(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer audit.Close()
+
+	// the trash is purged in the background, as the webhooks are delivered
+	productService := service.NewDefaultProduct(repo, events)
+	productService.TrashRetention = d.TrashRetention
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+	go productService.PurgeTrash(ctx)
 
-	repository := repository.NewProductSlice(nil, 0)
-	service := service.NewDefaultProduct(repository)
-	handler := handler.NewDefaultProduct(service, auth)
+	// the policy is checked before every operation of the services
+	webhookService := service.NewWebhookAuthorized(service.NewWebhookDefault(webhooks), policy)
+	auditService := service.NewAuditAuthorized(service.NewAuditDefault(audit), policy)
+	service := service.NewProductAuthorized(service.NewProductAudited(productService, audit), policy)
+	var tokenHandler *handler.DefaultToken
+	if jwt != nil {
+		tokenHandler = handler.NewDefaultToken(keys, jwt)
+	}
+
+	// the formats of the products, */* is answered with the first one
+	codecs := codec.NewRegistry(codec.JSON{}, codec.XML{}, codec.YAML{}, codec.MessagePack{}, codec.CSV{})
+	for _, c := range d.Codecs {
+		codecs.Register(c)
+	}
 
+	authMiddleware := handler.NewAuthMiddleware(bearer, legacy)
+	negotiationMiddleware := handler.NewNegotiationMiddleware(codecs)
+	idempotencyMiddleware := handler.NewIdempotencyMiddleware(idempotency.NewStoreMemory(d.IdempotencyTTL))
+	webhookHandler := handler.NewDefaultWebhook(webhookService)
+	auditHandler := handler.NewDefaultAudit(auditService, dateLayout)
+	handler := handler.NewDefaultProduct(service, dateLayout, codecs)
+
+	// every request has an ID, taken from the X-Request-Id header when present, recorded by the audit
 	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
+	if tokenHandler != nil {
+		router.Post("/auth/token", tokenHandler.Create())
+	}
+
 	router.Route("/products", func(r chi.Router) {
-		r.Get("/", handler.GetAll())
-		r.Post("/", handler.Create())
-		r.Get("/{id}", handler.GetByID())
-		r.Patch("/{id}", handler.Update())
-		r.Put("/{id}", handler.UpdateAndCreate())
-		r.Delete("/{id}", handler.Delete())
+		// reads are public, unless configured as private
+		var reads []func(http.Handler) http.Handler
+		if d.PrivateReads {
+			reads = append(reads, authMiddleware.Authenticate, authMiddleware.RequireScope(auth.ScopeProductsRead))
+		}
+
+		// the stream is always NDJSON and the events are Server-Sent Events, so they skip the negotiation of the codec
+		r.With(reads...).Get("/stream", handler.Stream())
+		r.With(reads...).Get("/events", handler.Events())
+
+		// the trash is only seen by the principals that can delete
+		remove := authMiddleware.RequireScope(auth.ScopeProductsDelete)
+		r.With(negotiationMiddleware.Handle, authMiddleware.Authenticate, remove).Get("/trash", handler.GetTrash())
+
+		// the history tells who changed the product, it is read with the audit scope
+		r.With(authMiddleware.Authenticate, authMiddleware.RequireScope(auth.ScopeAuditRead)).Get("/{id}/history", auditHandler.History())
+
+		r.Group(func(r chi.Router) {
+			r.Use(negotiationMiddleware.Handle)
+			r.Use(reads...)
+
+			r.Get("/", handler.GetAll())
+			r.Get("/search", handler.Search())
+			r.Get("/expiring", handler.GetExpiring())
+			r.Get("/expired", handler.GetExpired())
+			r.Get("/export", handler.Export())
+			r.Get("/{id}", handler.GetByID())
+		})
+
+		// writes need a token with the scope of the operation, and can be retried with an Idempotency-Key.
+		// The body of a retried write is only read once its scope was checked. The writes that don't
+		// respond with products can't be sent as CSV
+		write := authMiddleware.RequireScope(auth.ScopeProductsWrite)
+		r.Group(func(r chi.Router) {
+			r.Use(negotiationMiddleware.Handle, authMiddleware.Authenticate)
+
+			r.With(write, idempotencyMiddleware.Handle).Post("/", handler.Create())
+			r.With(write, idempotencyMiddleware.Handle).Patch("/{id}", handler.Update())
+			r.With(write, idempotencyMiddleware.Handle).Put("/{id}", handler.UpdateAndCreate())
+			r.With(remove, idempotencyMiddleware.Handle).Post("/{id}/restore", handler.Restore())
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(negotiationMiddleware.HandleDocuments, authMiddleware.Authenticate)
+
+			r.With(write, idempotencyMiddleware.Handle).Post("/batch", handler.Batch())
+			r.With(write, idempotencyMiddleware.Handle).Post("/import", handler.Import())
+			r.With(remove, idempotencyMiddleware.Handle).Delete("/{id}", handler.Delete())
+		})
+	})
+
+	// the webhooks are managed with their own scope, their events can reveal every product
+	router.Route("/webhooks", func(r chi.Router) {
+		r.Use(authMiddleware.Authenticate, authMiddleware.RequireScope(auth.ScopeWebhooksManage))
+
+		r.Get("/", webhookHandler.GetAll())
+		r.Post("/", webhookHandler.Create())
+		r.Get("/dead-letters", webhookHandler.DeadLetters())
+		r.Post("/deliveries/{id}/redeliver", webhookHandler.Redeliver())
+		r.Get("/{id}", webhookHandler.GetByID())
+		r.Put("/{id}", webhookHandler.Update())
+		r.Delete("/{id}", webhookHandler.Delete())
+		r.Get("/{id}/deliveries", webhookHandler.Deliveries())
 	})
 
+	// the audit log tells who changed every product, it is read with its own scope
+	router.With(authMiddleware.Authenticate, authMiddleware.RequireScope(auth.ScopeAuditRead)).Get("/audit", auditHandler.GetAll())
+
 	if err := http.ListenAndServe("localhost:8080", router); err != nil {
 		fmt.Println(err)
 		return
 	}
 }
+
+// LoadProductRepository loads the products stored in the file into a repository in memory, the file
+// is only read so it can be used while an application has it open. The writes on the repository are
+// not saved, a missing file is an empty repository
+func LoadProductRepository(filePath string, reserveTrashedCodes bool) (repo internal.ProductRepository, err error) {
+	var (
+		products []internal.Product
+		lastID   int
+	)
+	if _, statErr := os.Stat(filePath); statErr == nil {
+		if products, lastID, err = storage.NewStorageDefault(filePath).Load(); err != nil {
+			return
+		}
+	}
+
+	memory := repository.NewProductMap(products, lastID)
+	memory.ReserveTrashedCodes = reserveTrashedCodes
+	repo = memory
+	return
+}
+
+// OpenProductRepository opens the products stored in the file, or an empty repository in memory
+// when the file path is empty. Close must be called to close the file
+func OpenProductRepository(filePath string, compactEvery int, reserveTrashedCodes bool) (repo internal.ProductRepository, close func() error, err error) {
+	memory := repository.NewProductMap(nil, 0)
+	memory.ReserveTrashedCodes = reserveTrashedCodes
+	repo, close = memory, func() error { return nil }
+	if filePath == "" {
+		return
+	}
+
+	st := storage.NewStorageDefault(filePath)
+	if err = st.Open(); err != nil {
+		return
+	}
+
+	products, lastID, err := st.Load()
+	if err != nil {
+		st.Close()
+		return
+	}
+
+	// compact the log left by the previous run into a fresh snapshot, the snapshot is not rewritten
+	// when the log is empty
+	if info, statErr := os.Stat(st.WALPath); statErr == nil && info.Size() > 0 {
+		if err = st.Save(products, lastID); err != nil {
+			st.Close()
+			return
+		}
+	}
+
+	stored := repository.NewProductMap(products, lastID)
+	stored.ReserveTrashedCodes = reserveTrashedCodes
+	repo = repository.NewProductStorage(stored, st, compactEvery)
+	close = st.Close
+	return
+}
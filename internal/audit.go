@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrAuditUnavailable is returned for the writes refused while the audit log can't record the
+	// changes already made
+	ErrAuditUnavailable = errors.New("Audit log unavailable")
+)
+
+// Operations of the audit entries, an upsert is recorded as the create or the update it made
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// AuditFields are the fields of the products compared by the audit entries, named as in the JSON payloads
+var AuditFields = []string{"name", "quantity", "code_value", "is_published", "expiration", "price"}
+
+// AuditEntry is a change made on a product through the service, by whom and in which request.
+// Before is nil on a create or a restore, and After on a delete
+type AuditEntry struct {
+	// Sequence is assigned by the log, it is incremented on every entry
+	Sequence  int64
+	Time      time.Time
+	Actor     string
+	RequestID string
+	Operation string
+	ProductID int
+	Before    *Product
+	After     *Product
+}
+
+// Changes returns the fields that differ between the product before and after the change, every
+// field when one of them is missing
+func (e AuditEntry) Changes() (fields []string) {
+	for _, field := range AuditFields {
+		if e.Before == nil || e.After == nil || compareProducts(*e.Before, *e.After, field) != 0 {
+			fields = append(fields, field)
+		}
+	}
+	return
+}
+
+// AuditQuery selects the audit entries, the zero fields are not applied
+type AuditQuery struct {
+	ProductID int
+	Actor     string
+	// Since selects the entries made at or after the time
+	Since time.Time
+	// Before selects the entries with a lower sequence, to page back from the last entry returned
+	Before int64
+	// Limit is the maximum number of entries returned, the newest ones
+	Limit int
+}
+
+// Match reports whether the entry passes all the filters of the query
+func (q AuditQuery) Match(entry AuditEntry) bool {
+	if q.Before != 0 && entry.Sequence >= q.Before {
+		return false
+	}
+
+	if q.ProductID != 0 && entry.ProductID != q.ProductID {
+		return false
+	}
+
+	if q.Actor != "" && entry.Actor != q.Actor {
+		return false
+	}
+
+	return q.Since.IsZero() || !entry.Time.Before(q.Since)
+}
+
+// AuditLog is the append-only record of the changes made on the products
+type AuditLog interface {
+	// Append assigns the next sequences to the entries and adds them to the log
+	Append(entries []AuditEntry) (err error)
+	// Query returns the entries that match the query, the newest first
+	Query(query AuditQuery) (entries []AuditEntry, err error)
+}
+
+// AuditService reads the audit log, ctx carries the principal reading it
+type AuditService interface {
+	// History returns the changes made on a product, the oldest first
+	History(ctx context.Context, productID int) (entries []AuditEntry, err error)
+	// Query returns the entries that match the query, the newest first
+	Query(ctx context.Context, query AuditQuery) (entries []AuditEntry, err error)
+}
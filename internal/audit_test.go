@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAuditEntry_Changes(t *testing.T) {
+	before := Product{ID: 1, Name: "Product", Quantity: 1, CodeValue: "P1", Expiration: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), Price: 10}
+	after := before
+	after.Quantity, after.Price = 5, 12.5
+
+	entry := AuditEntry{Operation: AuditUpdate, Before: &before, After: &after}
+	if fields := entry.Changes(); !slices.Equal(fields, []string{"quantity", "price"}) {
+		t.Fatalf("got changes %v, want [quantity price]", fields)
+	}
+
+	// a create or a delete changes every field
+	for _, entry := range []AuditEntry{{Operation: AuditCreate, After: &after}, {Operation: AuditDelete, Before: &before}} {
+		if fields := entry.Changes(); !slices.Equal(fields, AuditFields) {
+			t.Fatalf("%s: got changes %v, want %v", entry.Operation, fields, AuditFields)
+		}
+	}
+}
+
+func TestAuditQuery_Match(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	entry := AuditEntry{Sequence: 5, Time: now, Actor: "admin", ProductID: 3}
+
+	tests := []struct {
+		name  string
+		query AuditQuery
+		want  bool
+	}{
+		{name: "no filter", query: AuditQuery{}, want: true},
+		{name: "product", query: AuditQuery{ProductID: 3}, want: true},
+		{name: "other product", query: AuditQuery{ProductID: 4}, want: false},
+		{name: "actor", query: AuditQuery{Actor: "admin"}, want: true},
+		{name: "other actor", query: AuditQuery{Actor: "reader"}, want: false},
+		{name: "since the time", query: AuditQuery{Since: now}, want: true},
+		{name: "since later", query: AuditQuery{Since: now.Add(time.Second)}, want: false},
+		{name: "before a later sequence", query: AuditQuery{Before: 6}, want: true},
+		{name: "before the sequence", query: AuditQuery{Before: 5}, want: false},
+		{name: "every filter", query: AuditQuery{ProductID: 3, Actor: "admin", Since: now.Add(-time.Hour), Before: 10}, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.query.Match(entry); got != tt.want {
+			t.Errorf("%s: got %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,14 +1,54 @@
 package auth
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"slices"
+)
 
 type Auth interface {
-	Auth(token string) (err error)
-	GetToken() string
+	Auth(token string) (principal Principal, err error)
+}
+
+const (
+	ScopeProductsRead   = "products:read"
+	ScopeProductsWrite  = "products:write"
+	ScopeProductsDelete = "products:delete"
+	ScopeWebhooksManage = "webhooks:manage"
+	ScopeAuditRead      = "audit:read"
+)
+
+// Scopes are all the scopes a principal can be granted
+var Scopes = []string{ScopeProductsRead, ScopeProductsWrite, ScopeProductsDelete, ScopeWebhooksManage, ScopeAuditRead}
+
+// Principal is the identity behind a token, the scopes it was granted and its roles
+type Principal struct {
+	Name   string
+	Scopes []string
+	Roles  []string
+}
+
+// HasScope reports whether the principal was granted the scope
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
 }
 
 var (
 	ErrAuthTokenInternal = errors.New("auth: token internal")
 	ErrAuthTokenInvalid  = errors.New("auth: token invalid")
 	ErrAuthTokenNotFound = errors.New("auth: token not found")
+	ErrAuthForbidden     = errors.New("auth: forbidden")
 )
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal
+func NewContext(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the principal carried by ctx, if any
+func FromContext(ctx context.Context) (principal Principal, ok bool) {
+	principal, ok = ctx.Value(contextKey{}).(Principal)
+	return
+}
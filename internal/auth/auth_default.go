@@ -1,5 +1,8 @@
 package auth
 
+import "crypto/subtle"
+
+// AuthDefault authenticates a single shared token, which is granted every scope and the admin role
 type AuthDefault struct {
 	Token string
 }
@@ -11,15 +14,22 @@ func NewAuthDefault(token string) *AuthDefault {
 }
 
 // Auth checks if the token is valid
-func (a *AuthDefault) Auth(token string) (err error) {
-	if a.Token == token {
-		return nil
+func (a *AuthDefault) Auth(token string) (principal Principal, err error) {
+	if token == "" {
+		err = ErrAuthTokenNotFound
+		return
 	}
 
-	return ErrAuthTokenInvalid
-}
+	// an empty configured token never matches, so a missing TOKEN doesn't open the api
+	if a.Token == "" || subtle.ConstantTimeCompare([]byte(a.Token), []byte(token)) != 1 {
+		err = ErrAuthTokenInvalid
+		return
+	}
 
-// GetToken returns the token
-func (a *AuthDefault) GetToken() string {
-	return a.Token
+	principal = Principal{
+		Name:   "default",
+		Scopes: Scopes,
+		Roles:  []string{RoleAdmin},
+	}
+	return
 }
@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrAuthJWTKey is returned when the configured signing key can't be used
+var ErrAuthJWTKey = errors.New("auth: invalid signing key")
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Leeway is the clock skew tolerated when checking exp and nbf
+const Leeway = 30 * time.Second
+
+// Issuer issues signed tokens for a principal
+type Issuer interface {
+	Issue(principal Principal) (token string, expiresAt time.Time, err error)
+}
+
+// AuthJWT authenticates the signed tokens (JWT) it issues, signed with HS256 or EdDSA
+type AuthJWT struct {
+	Issuer   string
+	Audience string
+	TTL      time.Duration
+
+	algorithm string
+	secret    []byte
+	private   ed25519.PrivateKey
+	public    ed25519.PublicKey
+	// now returns the current time, to check the expiration of the tokens
+	now func() time.Time
+}
+
+// NewAuthJWTHS256 creates an AuthJWT signing with HMAC-SHA256 and a shared secret
+func NewAuthJWTHS256(secret []byte, issuer, audience string, ttl time.Duration) *AuthJWT {
+	return &AuthJWT{
+		Issuer:    issuer,
+		Audience:  audience,
+		TTL:       ttl,
+		algorithm: AlgorithmHS256,
+		secret:    secret,
+		now:       time.Now,
+	}
+}
+
+// NewAuthJWTEdDSA creates an AuthJWT signing with an Ed25519 private key
+func NewAuthJWTEdDSA(private ed25519.PrivateKey, issuer, audience string, ttl time.Duration) *AuthJWT {
+	return &AuthJWT{
+		Issuer:    issuer,
+		Audience:  audience,
+		TTL:       ttl,
+		algorithm: AlgorithmEdDSA,
+		private:   private,
+		public:    private.Public().(ed25519.PublicKey),
+		now:       time.Now,
+	}
+}
+
+type headerJWT struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+}
+
+type claimsJWT struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// audience is the aud claim, which is either a string or an array of strings
+type audience []string
+
+func (a audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *audience) UnmarshalJSON(data []byte) (err error) {
+	var single string
+	if err = json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return
+	}
+
+	var many []string
+	if err = json.Unmarshal(data, &many); err != nil {
+		return
+	}
+	*a = many
+	return
+}
+
+// Issue signs a token for the principal, valid for the TTL
+func (a *AuthJWT) Issue(principal Principal) (token string, expiresAt time.Time, err error) {
+	now := a.now()
+	expiresAt = now.Add(a.TTL)
+
+	header, err := json.Marshal(headerJWT{Algorithm: a.algorithm, Type: "JWT"})
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrAuthTokenInternal, err)
+		return
+	}
+
+	claims := claimsJWT{
+		Issuer:    a.Issuer,
+		Subject:   principal.Name,
+		ExpiresAt: expiresAt.Unix(),
+		NotBefore: now.Unix(),
+		IssuedAt:  now.Unix(),
+		Scope:     strings.Join(principal.Scopes, " "),
+		Roles:     principal.Roles,
+	}
+	if a.Audience != "" {
+		claims.Audience = audience{a.Audience}
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrAuthTokenInternal, err)
+		return
+	}
+
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+	token = signingInput + "." + encodeSegment(a.sign([]byte(signingInput)))
+	return
+}
+
+// Auth verifies the signature and the claims of the token
+func (a *AuthJWT) Auth(token string) (principal Principal, err error) {
+	if token == "" {
+		err = ErrAuthTokenNotFound
+		return
+	}
+
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		err = fmt.Errorf("%w: malformed token", ErrAuthTokenInvalid)
+		return
+	}
+
+	var header headerJWT
+	if err = decodeSegment(segments[0], &header); err != nil {
+		return
+	}
+
+	// the algorithm is fixed by the configuration, never chosen by the token
+	if header.Algorithm != a.algorithm {
+		err = fmt.Errorf("%w: unexpected algorithm %q", ErrAuthTokenInvalid, header.Algorithm)
+		return
+	}
+
+	signature, decodeErr := base64.RawURLEncoding.DecodeString(segments[2])
+	if decodeErr != nil || !a.verify([]byte(segments[0]+"."+segments[1]), signature) {
+		err = fmt.Errorf("%w: bad signature", ErrAuthTokenInvalid)
+		return
+	}
+
+	var claims claimsJWT
+	if err = decodeSegment(segments[1], &claims); err != nil {
+		return
+	}
+
+	now := a.now()
+	switch {
+	case claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(Leeway)):
+		err = fmt.Errorf("%w: token expired", ErrAuthTokenInvalid)
+		return
+	case claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-Leeway)):
+		err = fmt.Errorf("%w: token not valid yet", ErrAuthTokenInvalid)
+		return
+	case a.Issuer != "" && claims.Issuer != a.Issuer:
+		err = fmt.Errorf("%w: unexpected issuer", ErrAuthTokenInvalid)
+		return
+	case a.Audience != "" && !slices.Contains(claims.Audience, a.Audience):
+		err = fmt.Errorf("%w: unexpected audience", ErrAuthTokenInvalid)
+		return
+	}
+
+	principal = Principal{
+		Name:   claims.Subject,
+		Scopes: strings.Fields(claims.Scope),
+		Roles:  claims.Roles,
+	}
+	return
+}
+
+func (a *AuthJWT) sign(input []byte) []byte {
+	if a.algorithm == AlgorithmEdDSA {
+		return ed25519.Sign(a.private, input)
+	}
+
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write(input)
+	return mac.Sum(nil)
+}
+
+func (a *AuthJWT) verify(input, signature []byte) bool {
+	if a.algorithm == AlgorithmEdDSA {
+		return ed25519.Verify(a.public, input, signature)
+	}
+
+	return hmac.Equal(a.sign(input), signature)
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSegment(segment string, ptr any) (err error) {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		err = fmt.Errorf("%w: malformed token", ErrAuthTokenInvalid)
+		return
+	}
+
+	if err = json.Unmarshal(data, ptr); err != nil {
+		err = fmt.Errorf("%w: malformed token", ErrAuthTokenInvalid)
+		return
+	}
+
+	return
+}
+
+// ParseEd25519Seed decodes a base64 Ed25519 seed into a private key
+func ParseEd25519Seed(encoded string) (private ed25519.PrivateKey, err error) {
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		err = fmt.Errorf("%w: the Ed25519 key must be a base64 seed of %d bytes", ErrAuthJWTKey, ed25519.SeedSize)
+		return
+	}
+
+	private = ed25519.NewKeyFromSeed(seed)
+	return
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testNow is the time of the tests, the tokens are issued and checked at it unless moved
+var testNow = time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestAuthJWT() *AuthJWT {
+	a := NewAuthJWTHS256([]byte("secret"), "go-product-web", "products", 15*time.Minute)
+	a.now = func() time.Time { return testNow }
+	return a
+}
+
+// signToken signs a token with the header and the claims given, as the AuthJWT would
+func signToken(t *testing.T, a *AuthJWT, header headerJWT, claims claimsJWT) string {
+	headerData, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimsData, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingInput := encodeSegment(headerData) + "." + encodeSegment(claimsData)
+	return signingInput + "." + encodeSegment(a.sign([]byte(signingInput)))
+}
+
+// validClaims returns the claims of a token valid at testNow
+func validClaims() claimsJWT {
+	return claimsJWT{
+		Issuer:    "go-product-web",
+		Subject:   "ci",
+		Audience:  audience{"products"},
+		ExpiresAt: testNow.Add(time.Minute).Unix(),
+		NotBefore: testNow.Unix(),
+		IssuedAt:  testNow.Unix(),
+		Scope:     ScopeProductsRead,
+	}
+}
+
+func TestAuthJWT_RoundTrip(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	eddsa := NewAuthJWTEdDSA(ed25519.NewKeyFromSeed(seed), "go-product-web", "products", 15*time.Minute)
+	eddsa.now = func() time.Time { return testNow }
+
+	principal := Principal{Name: "ci", Scopes: []string{ScopeProductsRead, ScopeProductsWrite}, Roles: []string{RoleEditor}}
+	for _, a := range []*AuthJWT{newTestAuthJWT(), eddsa} {
+		token, expiresAt, err := a.Issue(principal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !expiresAt.Equal(testNow.Add(15 * time.Minute)) {
+			t.Errorf("%s: got expiration %v, want %v", a.algorithm, expiresAt, testNow.Add(15*time.Minute))
+		}
+
+		got, err := a.Auth(token)
+		if err != nil {
+			t.Fatalf("%s: got error %v, want the token verified", a.algorithm, err)
+		}
+		if got.Name != principal.Name || !slices.Equal(got.Scopes, principal.Scopes) || !slices.Equal(got.Roles, principal.Roles) {
+			t.Errorf("%s: got principal %+v, want %+v", a.algorithm, got, principal)
+		}
+	}
+}
+
+func TestAuthJWT_Auth(t *testing.T) {
+	a := newTestAuthJWT()
+	header := headerJWT{Algorithm: AlgorithmHS256, Type: "JWT"}
+
+	withClaims := func(change func(claims *claimsJWT)) string {
+		claims := validClaims()
+		change(&claims)
+		return signToken(t, a, header, claims)
+	}
+
+	valid := signToken(t, a, header, validClaims())
+	segments := strings.Split(valid, ".")
+
+	// the payload of another subject with the signature of the valid token
+	tampered, _ := json.Marshal(claimsJWT{Issuer: "go-product-web", Subject: "admin", Audience: audience{"products"}, ExpiresAt: testNow.Add(time.Minute).Unix()})
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{name: "valid", token: valid},
+		{name: "empty", token: "", err: ErrAuthTokenNotFound},
+		{name: "malformed", token: "a.b", err: ErrAuthTokenInvalid},
+		{name: "none algorithm", token: encodeSegment([]byte(`{"alg":"none"}`)) + "." + segments[1] + ".", err: ErrAuthTokenInvalid},
+		{name: "other algorithm", token: signToken(t, a, headerJWT{Algorithm: AlgorithmEdDSA}, validClaims()), err: ErrAuthTokenInvalid},
+		{name: "tampered payload", token: segments[0] + "." + encodeSegment(tampered) + "." + segments[2], err: ErrAuthTokenInvalid},
+		{name: "tampered signature", token: segments[0] + "." + segments[1] + "." + encodeSegment([]byte("signature")), err: ErrAuthTokenInvalid},
+		{name: "other secret", token: signToken(t, NewAuthJWTHS256([]byte("other"), "", "", time.Minute), header, validClaims()), err: ErrAuthTokenInvalid},
+		// the expiration is required and checked with the leeway
+		{name: "no exp", token: withClaims(func(c *claimsJWT) { c.ExpiresAt = 0 }), err: ErrAuthTokenInvalid},
+		{name: "expired within the leeway", token: withClaims(func(c *claimsJWT) { c.ExpiresAt = testNow.Add(-Leeway).Unix() })},
+		{name: "expired", token: withClaims(func(c *claimsJWT) { c.ExpiresAt = testNow.Add(-Leeway - time.Second).Unix() }), err: ErrAuthTokenInvalid},
+		// nbf is optional and checked with the leeway
+		{name: "no nbf", token: withClaims(func(c *claimsJWT) { c.NotBefore = 0 })},
+		{name: "nbf within the leeway", token: withClaims(func(c *claimsJWT) { c.NotBefore = testNow.Add(Leeway).Unix() })},
+		{name: "nbf", token: withClaims(func(c *claimsJWT) { c.NotBefore = testNow.Add(Leeway + time.Second).Unix() }), err: ErrAuthTokenInvalid},
+		// issuer and audience
+		{name: "wrong iss", token: withClaims(func(c *claimsJWT) { c.Issuer = "other" }), err: ErrAuthTokenInvalid},
+		{name: "no iss", token: withClaims(func(c *claimsJWT) { c.Issuer = "" }), err: ErrAuthTokenInvalid},
+		{name: "wrong aud", token: withClaims(func(c *claimsJWT) { c.Audience = audience{"other"} }), err: ErrAuthTokenInvalid},
+		{name: "no aud", token: withClaims(func(c *claimsJWT) { c.Audience = nil }), err: ErrAuthTokenInvalid},
+		{name: "aud array", token: withClaims(func(c *claimsJWT) { c.Audience = audience{"other", "products"} })},
+	}
+
+	for _, test := range tests {
+		principal, err := a.Auth(test.token)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+			continue
+		}
+
+		if test.err == nil && principal.Name != "ci" {
+			t.Errorf("%s: got principal %+v, want ci", test.name, principal)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+var (
+	ErrAuthKeyNotFound   = errors.New("auth: key not found")
+	ErrAuthKeyDuplicated = errors.New("auth: key already exists")
+	ErrAuthKeyScope      = errors.New("auth: key scope is invalid")
+	ErrAuthKeyRole       = errors.New("auth: key role is invalid")
+)
+
+// scopeRoles are the roles given to the keys saved before they had roles, each scope maps to the
+// role of the default policy that grants its operations
+var scopeRoles = map[string]string{
+	ScopeProductsRead:   RoleViewer,
+	ScopeProductsWrite:  RoleEditor,
+	ScopeProductsDelete: RoleAdmin,
+	ScopeWebhooksManage: RoleAdmin,
+	ScopeAuditRead:      RoleAdmin,
+}
+
+// APIKey is a named key with its scopes, the key itself is only kept as a salted hash
+type APIKey struct {
+	Name      string    `json:"name"`
+	Salt      string    `json:"salt"`
+	Hash      string    `json:"hash"`
+	Scopes    []string  `json:"scopes"`
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuthKeys authenticates the API keys stored in a JSON file
+type AuthKeys struct {
+	FilePath string
+	// Policy has the roles a new key can be given
+	Policy Policy
+
+	mu   sync.RWMutex
+	keys []APIKey
+}
+
+func NewAuthKeys(filePath string) *AuthKeys {
+	return &AuthKeys{
+		FilePath: filePath,
+		Policy:   DefaultPolicy(),
+	}
+}
+
+// Load reads the keys from the file, a missing file has no keys. It can be called again to
+// reload the keys, they are kept as they were when the file can't be read. The keys saved
+// without roles are given the roles of their scopes
+func (a *AuthKeys) Load() (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	data, err := os.ReadFile(a.FilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		a.keys = nil
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrAuthTokenInternal, err)
+		return
+	}
+
+	var keys []APIKey
+	if err = json.Unmarshal(data, &keys); err != nil {
+		err = fmt.Errorf("%w: %v", ErrAuthTokenInternal, err)
+		return
+	}
+
+	for index, key := range keys {
+		if len(key.Roles) == 0 {
+			keys[index].Roles = RolesFromScopes(key.Scopes)
+		}
+	}
+
+	a.keys = keys
+	return
+}
+
+// RolesFromScopes returns the roles of the default policy that grant the operations of the scopes
+func RolesFromScopes(scopes []string) (roles []string) {
+	for _, scope := range scopes {
+		role, ok := scopeRoles[scope]
+		if ok && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+
+	return
+}
+
+// Auth checks the token against every key, so the time taken doesn't tell which key was close
+func (a *AuthKeys) Auth(token string) (principal Principal, err error) {
+	if token == "" {
+		err = ErrAuthTokenNotFound
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	found := -1
+	for index, key := range a.keys {
+		salt, saltErr := hex.DecodeString(key.Salt)
+		expected, hashErr := hex.DecodeString(key.Hash)
+		if saltErr != nil || hashErr != nil {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare(hashKey(salt, token), expected) == 1 {
+			found = index
+		}
+	}
+
+	if found < 0 {
+		err = ErrAuthTokenInvalid
+		return
+	}
+
+	principal = Principal{
+		Name:   a.keys[found].Name,
+		Scopes: slices.Clone(a.keys[found].Scopes),
+		Roles:  slices.Clone(a.keys[found].Roles),
+	}
+	return
+}
+
+// Add creates a new key and saves it into the file, the key is returned since it can't be recovered later
+func (a *AuthKeys) Add(name string, scopes, roles []string) (token string, err error) {
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			err = fmt.Errorf("%w: %s", ErrAuthKeyScope, scope)
+			return
+		}
+	}
+
+	for _, role := range roles {
+		if _, ok := a.Policy.Roles[role]; !ok {
+			err = fmt.Errorf("%w: %s", ErrAuthKeyRole, role)
+			return
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, key := range a.keys {
+		if key.Name == name {
+			err = fmt.Errorf("%w: %s", ErrAuthKeyDuplicated, name)
+			return
+		}
+	}
+
+	secret := make([]byte, 32)
+	salt := make([]byte, 16)
+	if _, err = rand.Read(secret); err != nil {
+		err = fmt.Errorf("%w: %v", ErrAuthTokenInternal, err)
+		return
+	}
+	if _, err = rand.Read(salt); err != nil {
+		err = fmt.Errorf("%w: %v", ErrAuthTokenInternal, err)
+		return
+	}
+
+	token = "pk_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	keys := append(slices.Clone(a.keys), APIKey{
+		Name:      name,
+		Salt:      hex.EncodeToString(salt),
+		Hash:      hex.EncodeToString(hashKey(salt, token)),
+		Scopes:    scopes,
+		Roles:     roles,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err = a.save(keys); err != nil {
+		token = ""
+		return
+	}
+
+	a.keys = keys
+	return
+}
+
+// Revoke deletes a key by its name and saves the file
+func (a *AuthKeys) Revoke(name string) (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	index := slices.IndexFunc(a.keys, func(key APIKey) bool { return key.Name == name })
+	if index < 0 {
+		err = fmt.Errorf("%w: %s", ErrAuthKeyNotFound, name)
+		return
+	}
+
+	keys := slices.Delete(slices.Clone(a.keys), index, index+1)
+	if err = a.save(keys); err != nil {
+		return
+	}
+
+	a.keys = keys
+	return
+}
+
+// List returns all the keys
+func (a *AuthKeys) List() (keys []APIKey) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	keys = slices.Clone(a.keys)
+	return
+}
+
+// save writes the keys into a temporary file readable only by its owner and renames it over the
+// file, so a server reloading the file reads either the old keys or the new ones
+func (a *AuthKeys) save(keys []APIKey) (err error) {
+	if keys == nil {
+		keys = []APIKey{}
+	}
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrAuthTokenInternal, err)
+		return
+	}
+
+	if err = tools.WriteFileAtomic(a.FilePath, data); err != nil {
+		err = fmt.Errorf("%w: %v", ErrAuthTokenInternal, err)
+		return
+	}
+
+	return
+}
+
+// hashKey hashes a key with its salt
+func hashKey(salt []byte, token string) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(token))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestAuthKeys_Reload checks that the keys saved by another process are used once the file is
+// loaded again, and that the file is replaced without leaving temporary files behind
+func TestAuthKeys_Reload(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "keys.json")
+
+	server := NewAuthKeys(filePath)
+	if err := server.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	cli := NewAuthKeys(filePath)
+	token, err := cli.Add("ci", []string{ScopeProductsRead}, []string{RoleViewer})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = server.Auth(token); !errors.Is(err, ErrAuthTokenInvalid) {
+		t.Fatalf("got error %v before the reload, want %v", err, ErrAuthTokenInvalid)
+	}
+	if err = server.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if principal, err := server.Auth(token); err != nil || principal.Name != "ci" {
+		t.Fatalf("got principal %+v and error %v, want ci", principal, err)
+	}
+
+	if err = cli.Revoke("ci"); err != nil {
+		t.Fatal(err)
+	}
+	if err = server.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = server.Auth(token); !errors.Is(err, ErrAuthTokenInvalid) {
+		t.Fatalf("got error %v after the revoke, want %v", err, ErrAuthTokenInvalid)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("got %d files, want the keys file only", len(entries))
+	}
+	if info, err := os.Stat(filePath); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("got file %v and error %v, want the permissions 0600", info, err)
+	}
+}
+
+// TestAuthKeys_LoadWithoutRoles checks that the keys saved before they had roles are given the
+// roles of their scopes, so the policy still lets them perform their operations
+func TestAuthKeys_LoadWithoutRoles(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "keys.json")
+
+	writer := NewAuthKeys(filePath)
+	token, err := writer.Add("legacy", []string{ScopeProductsRead, ScopeProductsWrite}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := NewAuthKeys(filePath)
+	if err = keys.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	principal, err := keys.Auth(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := DefaultPolicy()
+	for _, permission := range []string{PermissionProductsGet, PermissionProductsCreate} {
+		if err := policy.Authorize(principal, permission); err != nil {
+			t.Errorf("got error %v for %s with the roles %v, want nil", err, permission, principal.Roles)
+		}
+	}
+	if err := policy.Authorize(principal, PermissionProductsDelete); !errors.Is(err, ErrAuthForbidden) {
+		t.Errorf("got error %v for %s with the roles %v, want %v", err, PermissionProductsDelete, principal.Roles, ErrAuthForbidden)
+	}
+}
+
+// TestAuthKeys_AddRole checks that a key can only be given the roles of the policy
+func TestAuthKeys_AddRole(t *testing.T) {
+	keys := NewAuthKeys(filepath.Join(t.TempDir(), "keys.json"))
+
+	if _, err := keys.Add("typo", []string{ScopeProductsRead}, []string{"editr"}); !errors.Is(err, ErrAuthKeyRole) {
+		t.Fatalf("got error %v, want %v", err, ErrAuthKeyRole)
+	}
+	if len(keys.List()) != 0 {
+		t.Fatalf("got %d keys, want none", len(keys.List()))
+	}
+
+	keys.Policy = Policy{Roles: map[string][]string{"auditor": {PermissionAuditRead}}}
+	if _, err := keys.Add("auditor", []string{ScopeAuditRead}, []string{"auditor"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Add("editor", []string{ScopeProductsWrite}, []string{RoleEditor}); !errors.Is(err, ErrAuthKeyRole) {
+		t.Fatalf("got error %v, want %v", err, ErrAuthKeyRole)
+	}
+}
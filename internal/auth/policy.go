@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Permissions on the product operations
+const (
+	PermissionProductsList   = "products:list"
+	PermissionProductsGet    = "products:get"
+	PermissionProductsCreate = "products:create"
+	PermissionProductsUpdate = "products:update"
+	PermissionProductsDelete = "products:delete"
+	PermissionProductsImport = "products:import"
+	// PermissionWebhooksManage lets a principal manage the webhooks and see their deliveries
+	PermissionWebhooksManage = "webhooks:manage"
+	// PermissionAuditRead lets a principal read who changed the products
+	PermissionAuditRead = "audit:read"
+)
+
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+	// RoleAnonymous is the role of the requests without a principal
+	RoleAnonymous = "anonymous"
+)
+
+// Reasons of a ForbiddenError
+const (
+	ReasonPermissionDenied = "permission_denied"
+	ReasonNoRoles          = "no_roles"
+)
+
+var ErrAuthPolicy = errors.New("auth: invalid policy")
+
+// ForbiddenError is returned when a principal is not allowed to perform an operation
+type ForbiddenError struct {
+	Principal  string
+	Permission string
+	Reason     string
+}
+
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("%s: %s can't %s (%s)", ErrAuthForbidden, e.Principal, e.Permission, e.Reason)
+}
+
+func (e *ForbiddenError) Unwrap() error {
+	return ErrAuthForbidden
+}
+
+// Policy maps each role to the permissions it grants
+type Policy struct {
+	Roles map[string][]string `json:"roles"`
+}
+
+// DefaultPolicy lets anyone read, editors create and update, and only admins delete, import,
+// manage the webhooks and read the audit log
+func DefaultPolicy() Policy {
+	read := []string{PermissionProductsList, PermissionProductsGet}
+	write := append(slices.Clone(read), PermissionProductsCreate, PermissionProductsUpdate)
+
+	return Policy{
+		Roles: map[string][]string{
+			RoleAnonymous: read,
+			RoleViewer:    read,
+			RoleEditor:    write,
+			RoleAdmin:     append(slices.Clone(write), PermissionProductsDelete, PermissionProductsImport, PermissionWebhooksManage, PermissionAuditRead),
+		},
+	}
+}
+
+// LoadPolicy reads a policy from a JSON file
+func LoadPolicy(filePath string) (policy Policy, err error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrAuthPolicy, err)
+		return
+	}
+
+	if err = json.Unmarshal(data, &policy); err != nil {
+		err = fmt.Errorf("%w: %v", ErrAuthPolicy, err)
+		return
+	}
+
+	if len(policy.Roles) == 0 {
+		err = fmt.Errorf("%w: no roles defined", ErrAuthPolicy)
+		return
+	}
+
+	return
+}
+
+// Authorize returns a ForbiddenError unless a role of the principal grants the permission
+func (p Policy) Authorize(principal Principal, permission string) (err error) {
+	if len(principal.Roles) == 0 {
+		err = &ForbiddenError{Principal: principal.Name, Permission: permission, Reason: ReasonNoRoles}
+		return
+	}
+
+	for _, role := range principal.Roles {
+		if slices.Contains(p.Roles[role], permission) {
+			return
+		}
+	}
+
+	err = &ForbiddenError{Principal: principal.Name, Permission: permission, Reason: ReasonPermissionDenied}
+	return
+}
+
+// Anonymous is the principal of the requests without a token
+var Anonymous = Principal{
+	Name:  RoleAnonymous,
+	Roles: []string{RoleAnonymous},
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPolicy_Authorize(t *testing.T) {
+	tests := []struct {
+		roles      []string
+		permission string
+		reason     string
+	}{
+		{roles: []string{RoleAnonymous}, permission: PermissionProductsList},
+		{roles: []string{RoleAnonymous}, permission: PermissionProductsCreate, reason: ReasonPermissionDenied},
+		{roles: []string{RoleViewer}, permission: PermissionProductsGet},
+		{roles: []string{RoleViewer}, permission: PermissionProductsCreate, reason: ReasonPermissionDenied},
+		{roles: []string{RoleViewer}, permission: PermissionProductsUpdate, reason: ReasonPermissionDenied},
+		{roles: []string{RoleEditor}, permission: PermissionProductsCreate},
+		{roles: []string{RoleEditor}, permission: PermissionProductsUpdate},
+		{roles: []string{RoleEditor}, permission: PermissionProductsDelete, reason: ReasonPermissionDenied},
+		{roles: []string{RoleEditor}, permission: PermissionProductsImport, reason: ReasonPermissionDenied},
+		{roles: []string{RoleEditor}, permission: PermissionWebhooksManage, reason: ReasonPermissionDenied},
+		{roles: []string{RoleEditor}, permission: PermissionAuditRead, reason: ReasonPermissionDenied},
+		{roles: []string{RoleAdmin}, permission: PermissionProductsDelete},
+		{roles: []string{RoleAdmin}, permission: PermissionProductsImport},
+		{roles: []string{RoleAdmin}, permission: PermissionWebhooksManage},
+		{roles: []string{RoleAdmin}, permission: PermissionAuditRead},
+		{roles: []string{RoleAdmin}, permission: "products:unknown", reason: ReasonPermissionDenied},
+		// a permission of any role is granted
+		{roles: []string{RoleViewer, RoleEditor}, permission: PermissionProductsCreate},
+		{roles: []string{"unknown"}, permission: PermissionProductsList, reason: ReasonPermissionDenied},
+		{roles: nil, permission: PermissionProductsList, reason: ReasonNoRoles},
+	}
+
+	policy := DefaultPolicy()
+	for _, test := range tests {
+		err := policy.Authorize(Principal{Name: "key", Roles: test.roles}, test.permission)
+		if test.reason == "" {
+			if err != nil {
+				t.Errorf("%v %s: got error %v, want nil", test.roles, test.permission, err)
+			}
+			continue
+		}
+
+		var forbiddenErr *ForbiddenError
+		if !errors.As(err, &forbiddenErr) || !errors.Is(err, ErrAuthForbidden) || forbiddenErr.Reason != test.reason || forbiddenErr.Permission != test.permission {
+			t.Errorf("%v %s: got error %v, want the reason %s", test.roles, test.permission, err, test.reason)
+		}
+	}
+}
+
+func TestRolesFromScopes(t *testing.T) {
+	roles := RolesFromScopes([]string{ScopeProductsRead, ScopeProductsWrite, ScopeProductsDelete, ScopeAuditRead, "unknown"})
+	if len(roles) != 3 || roles[0] != RoleViewer || roles[1] != RoleEditor || roles[2] != RoleAdmin {
+		t.Fatalf("got roles %v, want [viewer editor admin]", roles)
+	}
+}
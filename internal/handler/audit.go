@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+// DefaultAuditLimit is the number of audit entries returned when the request does not set a limit
+const DefaultAuditLimit = 100
+
+// DefaultAudit is a handler of the audit log of the changes made on the products
+type DefaultAudit struct {
+	sv internal.AuditService
+	// dateLayout is the layout of the expiration dates of the changes
+	dateLayout string
+}
+
+func NewDefaultAudit(sv internal.AuditService, dateLayout string) *DefaultAudit {
+	return &DefaultAudit{
+		sv:         sv,
+		dateLayout: dateLayout,
+	}
+}
+
+// AuditEntryJSON is a change made on a product, with the fields it changed
+type AuditEntryJSON struct {
+	Sequence  int64             `json:"sequence"`
+	Time      string            `json:"time"`
+	Actor     string            `json:"actor"`
+	RequestID string            `json:"request_id,omitempty"`
+	Operation string            `json:"operation"`
+	ProductID int               `json:"product_id"`
+	Changes   []AuditChangeJSON `json:"changes"`
+}
+
+// AuditChangeJSON is a field changed, Before is null on a create or a restore and After on a delete
+type AuditChangeJSON struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// History is a handler for get the changes made on a product, the oldest first
+func (d *DefaultAudit) History() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseID(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		entries, err := d.sv.History(r.Context(), id)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		respond(w, r, http.StatusOK, map[string]any{
+			"message": "Total changes: " + strconv.Itoa(len(entries)),
+			"data":    d.entriesJSON(entries),
+		})
+	}
+}
+
+// GetAll is a handler for get the changes made on the products, the newest first, filtered by
+// the since (a time or a date), actor and limit parameters. The before parameter pages back from the
+// sequence of the last entry returned
+func (d *DefaultAudit) GetAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseAuditQuery(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		entries, err := d.sv.Query(r.Context(), query)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		respond(w, r, http.StatusOK, map[string]any{
+			"message": "Total changes: " + strconv.Itoa(len(entries)),
+			"data":    d.entriesJSON(entries),
+		})
+	}
+}
+
+// parseAuditQuery reads the filters of the audit log from the query string
+func parseAuditQuery(r *http.Request) (query internal.AuditQuery, err error) {
+	values := r.URL.Query()
+	query.Actor = values.Get("actor")
+
+	if v := values.Get("since"); v != "" {
+		if query.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			if query.Since, err = tools.ParseDate(v); err != nil {
+				err = &tools.FieldError{Field: "since", Msg: "must be a RFC 3339 time or a date with format dd/mm/yyyy or yyyy-mm-dd"}
+				return
+			}
+		}
+	}
+
+	if v := values.Get("before"); v != "" {
+		if query.Before, err = strconv.ParseInt(v, 10, 64); err != nil || query.Before < 1 {
+			err = &tools.FieldError{Field: "before", Msg: "must be a positive integer"}
+			return
+		}
+	}
+
+	query.Limit = DefaultAuditLimit
+	if v := values.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit < 1 {
+			err = &tools.FieldError{Field: "limit", Msg: "must be a positive integer"}
+			return
+		}
+	}
+
+	return
+}
+
+// entriesJSON converts the entries to their response representation
+func (d *DefaultAudit) entriesJSON(entries []internal.AuditEntry) (data []AuditEntryJSON) {
+	data = make([]AuditEntryJSON, 0, len(entries))
+	for _, entry := range entries {
+		ej := AuditEntryJSON{
+			Sequence:  entry.Sequence,
+			Time:      entry.Time.UTC().Format(time.RFC3339),
+			Actor:     entry.Actor,
+			RequestID: entry.RequestID,
+			Operation: entry.Operation,
+			ProductID: entry.ProductID,
+			Changes:   make([]AuditChangeJSON, 0, len(internal.AuditFields)),
+		}
+
+		for _, field := range entry.Changes() {
+			ej.Changes = append(ej.Changes, AuditChangeJSON{
+				Field:  field,
+				Before: d.fieldJSON(entry.Before, field),
+				After:  d.fieldJSON(entry.After, field),
+			})
+		}
+
+		data = append(data, ej)
+	}
+	return
+}
+
+// fieldJSON returns the value of a field of the product as in its response representation, nil without a product
+func (d *DefaultAudit) fieldJSON(product *internal.Product, field string) any {
+	if product == nil {
+		return nil
+	}
+
+	switch field {
+	case "name":
+		return product.Name
+	case "quantity":
+		return product.Quantity
+	case "code_value":
+		return product.CodeValue
+	case "is_published":
+		return product.IsPublished
+	case "expiration":
+		return product.Expiration.Format(d.dateLayout)
+	case "price":
+		return product.Price
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/edwinbm5/go-product-web/internal/auth"
+)
+
+// AuthMiddleware is a middleware that authenticates the requests. Bearer tokens in the
+// Authorization header are checked with bearer, and the legacy token header with legacy.
+// Either of them can be nil to disable it
+type AuthMiddleware struct {
+	bearer auth.Auth
+	legacy auth.Auth
+}
+
+func NewAuthMiddleware(bearer, legacy auth.Auth) *AuthMiddleware {
+	return &AuthMiddleware{
+		bearer: bearer,
+		legacy: legacy,
+	}
+}
+
+// Authenticate only lets through the requests with a valid token, the principal of the
+// token is added to the request context
+func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := m.authenticate(r)
+		if err != nil {
+			m.authError(w, r, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+	})
+}
+
+// RequireScope only lets through the requests whose principal was granted the scope,
+// it must be mounted after Authenticate
+func (m *AuthMiddleware) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.FromContext(r.Context())
+			if !ok {
+				m.authError(w, r, auth.ErrAuthTokenNotFound)
+				return
+			}
+
+			if !principal.HasScope(scope) {
+				m.authError(w, r, auth.ErrAuthForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authenticate checks the bearer token if the request has one, or else the legacy token header
+func (m *AuthMiddleware) authenticate(r *http.Request) (principal auth.Principal, err error) {
+	if header := r.Header.Get("Authorization"); header != "" && m.bearer != nil {
+		scheme, token, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			err = auth.ErrAuthTokenInvalid
+			return
+		}
+
+		principal, err = m.bearer.Auth(strings.TrimSpace(token))
+		return
+	}
+
+	if m.legacy != nil {
+		principal, err = m.legacy.Auth(r.Header.Get("token"))
+		return
+	}
+
+	err = auth.ErrAuthTokenNotFound
+	return
+}
+
+// authError writes the response of an authentication error, with the challenge of the
+// accepted scheme when the request is unauthorized
+func (m *AuthMiddleware) authError(w http.ResponseWriter, r *http.Request, err error) {
+	challenge := `Token realm="products"`
+	if m.bearer != nil {
+		challenge = `Bearer realm="products"`
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrAuthTokenNotFound):
+		w.Header().Set("WWW-Authenticate", challenge)
+	case errors.Is(err, auth.ErrAuthTokenInvalid):
+		w.Header().Set("WWW-Authenticate", challenge+`, error="invalid_token"`)
+	}
+
+	problem(w, r, err)
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal/auth"
+)
+
+// TestAuthMiddleware checks the status and the challenge of the requests without a token, with a
+// bad or expired one, or without the scope, and which of the bearer and the legacy tokens is used
+func TestAuthMiddleware(t *testing.T) {
+	jwt := auth.NewAuthJWTHS256([]byte("secret"), "go-product-web", "", time.Minute)
+	expired := auth.NewAuthJWTHS256([]byte("secret"), "go-product-web", "", -time.Hour)
+	legacy := auth.NewAuthDefault("legacy-token")
+
+	issue := func(a *auth.AuthJWT, scopes ...string) string {
+		token, _, err := a.Issue(auth.Principal{Name: "ci", Scopes: scopes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	writeToken, readToken := issue(jwt, auth.ScopeProductsWrite), issue(jwt, auth.ScopeProductsRead)
+	expiredToken := issue(expired, auth.ScopeProductsWrite)
+
+	// the principal of the request is written in the body
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.FromContext(r.Context())
+		w.Write([]byte(principal.Name))
+	})
+
+	tests := []struct {
+		name          string
+		bearer        auth.Auth
+		authorization string
+		token         string
+		status        int
+		challenge     string
+		principal     string
+	}{
+		{name: "no token", bearer: jwt, status: http.StatusUnauthorized, challenge: `Bearer realm="products"`},
+		{name: "bad bearer", bearer: jwt, authorization: "Bearer nope", status: http.StatusUnauthorized, challenge: `Bearer realm="products", error="invalid_token"`},
+		{name: "other scheme", bearer: jwt, authorization: "Basic " + writeToken, status: http.StatusUnauthorized, challenge: `Bearer realm="products", error="invalid_token"`},
+		{name: "expired bearer", bearer: jwt, authorization: "Bearer " + expiredToken, status: http.StatusUnauthorized, challenge: `Bearer realm="products", error="invalid_token"`},
+		{name: "missing scope", bearer: jwt, authorization: "Bearer " + readToken, status: http.StatusForbidden},
+		{name: "bearer", bearer: jwt, authorization: "Bearer " + writeToken, status: http.StatusOK, principal: "ci"},
+		{name: "lowercase scheme", bearer: jwt, authorization: "bearer " + writeToken, status: http.StatusOK, principal: "ci"},
+		{name: "legacy", bearer: jwt, token: "legacy-token", status: http.StatusOK, principal: "default"},
+		{name: "bad legacy", bearer: jwt, token: "nope", status: http.StatusUnauthorized, challenge: `Bearer realm="products", error="invalid_token"`},
+		// the bearer token is checked first, the legacy one doesn't widen its scopes
+		{name: "bearer over legacy", bearer: jwt, authorization: "Bearer " + readToken, token: "legacy-token", status: http.StatusForbidden},
+		{name: "bad bearer over legacy", bearer: jwt, authorization: "Bearer nope", token: "legacy-token", status: http.StatusUnauthorized, challenge: `Bearer realm="products", error="invalid_token"`},
+		// without bearer tokens the Authorization header is ignored
+		{name: "legacy only", token: "legacy-token", authorization: "Bearer " + writeToken, status: http.StatusOK, principal: "default"},
+		{name: "legacy only without token", authorization: "Bearer " + writeToken, status: http.StatusUnauthorized, challenge: `Token realm="products"`},
+	}
+
+	for _, test := range tests {
+		m := NewAuthMiddleware(test.bearer, legacy)
+		handler := m.Authenticate(m.RequireScope(auth.ScopeProductsWrite)(next))
+
+		r := httptest.NewRequest(http.MethodPost, "/products", nil)
+		if test.authorization != "" {
+			r.Header.Set("Authorization", test.authorization)
+		}
+		if test.token != "" {
+			r.Header.Set("token", test.token)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Fatalf("%s: got status %d, want %d", test.name, w.Code, test.status)
+		}
+		if challenge := w.Header().Get("WWW-Authenticate"); challenge != test.challenge {
+			t.Fatalf("%s: got challenge %q, want %q", test.name, challenge, test.challenge)
+		}
+		if test.status == http.StatusOK && w.Body.String() != test.principal {
+			t.Fatalf("%s: got principal %q, want %q", test.name, w.Body.String(), test.principal)
+		}
+		if test.status != http.StatusOK && w.Header().Get("Content-Type") != ContentTypeProblem {
+			t.Fatalf("%s: got content type %q, want a problem", test.name, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+// TestAuthMiddleware_RequireScopeWithoutPrincipal checks that RequireScope answers 401 when no
+// principal was authenticated before it
+func TestAuthMiddleware_RequireScopeWithoutPrincipal(t *testing.T) {
+	m := NewAuthMiddleware(nil, auth.NewAuthDefault("legacy-token"))
+	handler := m.RequireScope(auth.ScopeProductsRead)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("got the request through, want it stopped")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Token realm="products"` {
+		t.Fatalf("got status %d and challenge %q, want 401 with the token challenge", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/auth"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+const (
+	// MaxBatchSize is the biggest number of writes of a batch
+	MaxBatchSize = 1000
+	// MaxBatchBodySize is the biggest body of a batch
+	MaxBatchBodySize = 10 << 20
+)
+
+// BatchItemRequestBody is a write of a batch. Patch is either a JSON Merge Patch (an object)
+// or a JSON Patch (an array)
+type BatchItemRequestBody struct {
+	Op          string          `json:"op"`
+	ID          int             `json:"id"`
+	Product     json.RawMessage `json:"product"`
+	Patch       json.RawMessage `json:"patch"`
+	IfMatch     string          `json:"if_match"`
+	IfNoneMatch string          `json:"if_none_match"`
+}
+
+// BatchResultJSON is the result of a write of a batch
+type BatchResultJSON struct {
+	Index  int          `json:"index"`
+	Status int          `json:"status"`
+	Data   *ProductJSON `json:"data,omitempty"`
+	Error  *ProblemJSON `json:"error,omitempty"`
+}
+
+// Batch is a handler for apply a list of creates, upserts, patches and deletes. With atomic=true
+// all of them are applied or none, and the response has the status of the failed write
+func (d *DefaultProduct) Batch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic := false
+		if v := r.URL.Query().Get("atomic"); v != "" {
+			var err error
+			if atomic, err = strconv.ParseBool(v); err != nil {
+				problem(w, r, &tools.FieldError{Field: "atomic", Msg: "must be a boolean"})
+				return
+			}
+		}
+
+		items, err := decodeBatch(http.MaxBytesReader(w, r.Body, MaxBatchBodySize))
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		// deletes need the delete scope, as the single deletes do
+		principal, _ := auth.FromContext(r.Context())
+		for _, item := range items {
+			if item.Op == internal.ProductWriteDelete && !principal.HasScope(auth.ScopeProductsDelete) {
+				problem(w, r, auth.ErrAuthForbidden)
+				return
+			}
+		}
+
+		types := make([]string, len(items))
+		for index, item := range items {
+			types[index] = item.Op
+		}
+
+		// the items that can't be decoded fail on their own, unless the batch is atomic
+		results := make([]internal.ProductWriteResult, len(items))
+		writes := make([]internal.ProductWrite, 0, len(items))
+		for index, item := range items {
+			write, err := batchWrite(item)
+			if err == nil {
+				writes = append(writes, write)
+				continue
+			}
+
+			if atomic {
+				results = internal.NewProductBatchResults(len(items), &internal.ProductBatchError{Index: index, Err: err})
+				d.batchResponse(w, r, types, results, atomic)
+				return
+			}
+			results[index].Err = err
+		}
+
+		// a service returns a result per write even when the batch fails, or else every write fails with the error
+		written, err := d.sv.Batch(r.Context(), writes, atomic)
+		if len(written) != len(writes) {
+			written = internal.NewProductBatchResults(len(writes), err)
+		}
+		for index := range results {
+			if results[index].Err == nil {
+				results[index], written = written[0], written[1:]
+			}
+		}
+
+		d.batchResponse(w, r, types, results, atomic)
+	}
+}
+
+// decodeBatch reads the array of writes of a batch one write at a time, and stops at the first write
+// past MaxBatchSize without reading the rest of the body
+func decodeBatch(body io.Reader) (items []BatchItemRequestBody, err error) {
+	sizeErr := &tools.FieldError{Field: "operations", Msg: fmt.Sprintf("must have between 1 and %d operations", MaxBatchSize)}
+
+	decoder := json.NewDecoder(body)
+	if token, tokenErr := decoder.Token(); tokenErr != nil || token != json.Delim('[') {
+		err = batchBodyError(tokenErr)
+		return
+	}
+
+	for decoder.More() {
+		if len(items) == MaxBatchSize {
+			err = sizeErr
+			return
+		}
+
+		var item BatchItemRequestBody
+		if err = decoder.Decode(&item); err != nil {
+			err = batchBodyError(err)
+			return
+		}
+		items = append(items, item)
+	}
+
+	if _, err = decoder.Token(); err != nil {
+		err = batchBodyError(err)
+		return
+	}
+
+	if len(items) == 0 {
+		err = sizeErr
+	}
+	return
+}
+
+// batchBodyError returns the error of a body that can't be decoded, with the limit when it is too big
+func batchBodyError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return fmt.Errorf("%w: must have at most %d bytes", ErrInvalidBody, maxBytesErr.Limit)
+	}
+	return ErrInvalidBody
+}
+
+// batchResponse writes the results of a batch
+func (d *DefaultProduct) batchResponse(w http.ResponseWriter, r *http.Request, types []string, results []internal.ProductWriteResult, atomic bool) {
+	status := http.StatusOK
+	failed := 0
+
+	data := make([]BatchResultJSON, 0, len(results))
+	for index, result := range results {
+		item := BatchResultJSON{Index: index}
+		if result.Err != nil {
+			p := newProblem(result.Err)
+			item.Status, item.Error = p.Status, &p
+			failed++
+
+			// an atomic batch fails with the status of the write that failed
+			if atomic && status == http.StatusOK && p.Status != http.StatusFailedDependency {
+				status = p.Status
+			}
+		} else {
+			item.Status = batchStatus(types[index])
+			if types[index] != internal.ProductWriteDelete {
+				product := d.productJSON(result.Product)
+				item.Data = &product
+			}
+		}
+
+		data = append(data, item)
+	}
+
+	respond(w, r, status, map[string]any{
+		"message": fmt.Sprintf("Batch applied: %d succeeded, %d failed", len(results)-failed, failed),
+		"atomic":  atomic,
+		"results": data,
+	})
+}
+
+// batchStatus is the status of a write of a batch that succeeded, as the single writes answer.
+// A delete answers 200 without the product, as the single delete
+func batchStatus(op string) int {
+	switch op {
+	case internal.ProductWriteCreate:
+		return http.StatusCreated
+	default:
+		return http.StatusOK
+	}
+}
+
+// batchWrite converts an item of a batch into a write
+func batchWrite(item BatchItemRequestBody) (write internal.ProductWrite, err error) {
+	write = internal.ProductWrite{
+		Type:      item.Op,
+		ID:        item.ID,
+		Condition: newCondition(item.IfMatch, item.IfNoneMatch),
+	}
+
+	switch item.Op {
+	case internal.ProductWriteCreate, internal.ProductWriteUpsert:
+		if write.Product, err = productFromJSON(item.Product); err != nil {
+			return
+		}
+		write.Product.ID = item.ID
+	case internal.ProductWritePatch:
+		if len(item.Patch) > 0 && item.Patch[0] == '[' {
+			var jsonPatch internal.ProductJSONPatch
+			err = json.Unmarshal(item.Patch, &jsonPatch)
+			write.Patch = jsonPatch
+		} else {
+			var mergePatch internal.ProductMergePatch
+			err = json.Unmarshal(item.Patch, &mergePatch)
+			write.Patch = mergePatch
+		}
+
+		if err != nil || write.Patch == nil {
+			err = &tools.FieldError{Field: "patch", Msg: "must be a JSON Merge Patch object or a JSON Patch array"}
+		}
+	case internal.ProductWriteDelete:
+	default:
+		err = fmt.Errorf("%w: op must be create, upsert, patch or delete", internal.ErrProductBatchInvalid)
+	}
+
+	return
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
+
+// TestBatchResponse_Status checks that each write of a batch answers the status of its single
+// write, a delete answering 200 without the product
+func TestBatchResponse_Status(t *testing.T) {
+	d := NewDefaultProduct(nil, "02/01/2006", nil)
+	product := internal.Product{ID: 1, Name: "Product A", CodeValue: "A", Expiration: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), Version: 1}
+
+	types := []string{internal.ProductWriteCreate, internal.ProductWritePatch, internal.ProductWriteDelete}
+	results := []internal.ProductWriteResult{{Product: product}, {Product: product}, {}}
+
+	w := httptest.NewRecorder()
+	d.batchResponse(w, httptest.NewRequest(http.MethodPost, "/api/v1/products/batch", nil), types, results, false)
+
+	var body struct {
+		Results []BatchResultJSON `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{http.StatusCreated, http.StatusOK, http.StatusOK}
+	for index, result := range body.Results {
+		if result.Status != want[index] {
+			t.Errorf("write %d: got status %d, want %d", index, result.Status, want[index])
+		}
+		if (result.Data == nil) != (types[index] == internal.ProductWriteDelete) {
+			t.Errorf("write %d: got data %+v", index, result.Data)
+		}
+	}
+}
+
+// TestDefaultProduct_BatchBody checks that a body that is not an array of 1 to MaxBatchSize writes, or
+// is bigger than MaxBatchBodySize, is refused before any write is applied
+func TestDefaultProduct_BatchBody(t *testing.T) {
+	handler := NewDefaultProduct(nil, "02/01/2006", nil).Batch()
+	write := `{"op":"create","product":{}}`
+
+	tests := []struct {
+		name   string
+		body   string
+		field  string
+		detail string
+	}{
+		{name: "not json", body: "[{", detail: ErrInvalidBody.Error()},
+		{name: "object", body: write, detail: ErrInvalidBody.Error()},
+		{name: "empty", body: "[]", field: "operations"},
+		{name: "too many", body: "[" + strings.Repeat(write+",", MaxBatchSize) + write + "]", field: "operations"},
+		// the writes past the limit are not read
+		{name: "too many and truncated", body: "[" + strings.Repeat(write+",", MaxBatchSize) + write + ",{", field: "operations"},
+		{name: "too big", body: `[{"op":"create","product":{"name":"` + strings.Repeat("a", MaxBatchBodySize) + `"}}]`, detail: "must have at most"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/products/batch", strings.NewReader(test.body)))
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: got status %d, want %d", test.name, w.Code, http.StatusBadRequest)
+		}
+
+		var p ProblemJSON
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		if test.field != "" && (len(p.Errors) != 1 || p.Errors[0].Field != test.field) {
+			t.Fatalf("%s: got errors %+v, want the field %s", test.name, p.Errors, test.field)
+		}
+		if test.detail != "" && !strings.Contains(p.Detail, test.detail) {
+			t.Fatalf("%s: got detail %q, want %q", test.name, p.Detail, test.detail)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
+
+// etag returns the entity tag of a product, which changes with its version. It is strong so it can
+// be sent back in If-Match, which only compares strong tags. Unlike RFC 7232 asks of a strong tag,
+// the JSON, XML, YAML, MessagePack and CSV representations of a version share it, since a write
+// compares the version of the product and not the bytes of a representation
+func etag(product internal.Product) string {
+	return `"v` + strconv.Itoa(product.Version) + `"`
+}
+
+// parseCondition reads the If-Match and If-None-Match headers of a write into the condition
+// of the stored product
+func parseCondition(r *http.Request) (condition internal.ProductCondition) {
+	condition = newCondition(r.Header.Get("If-Match"), r.Header.Get("If-None-Match"))
+	return
+}
+
+// newCondition converts the values of If-Match and If-None-Match into a condition, the entity
+// tags unknown to the API never match. If-Match uses the strong comparison, so a weak tag never
+// matches, and If-None-Match the weak one (RFC 7232)
+func newCondition(ifMatch, ifNoneMatch string) (condition internal.ProductCondition) {
+	if ifMatch != "" {
+		versions, any := parseETags(ifMatch, true)
+		if any {
+			condition.Exists = true
+		} else {
+			condition.IfMatch = versions
+		}
+	}
+
+	if ifNoneMatch != "" {
+		versions, any := parseETags(ifNoneMatch, false)
+		if any {
+			condition.Absent = true
+		} else {
+			condition.IfNoneMatch = versions
+		}
+	}
+
+	return
+}
+
+// notModified tells if the product matches the If-None-Match header of a read
+func notModified(r *http.Request, product internal.Product) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	versions, any := parseETags(header, false)
+	if any {
+		return true
+	}
+
+	for _, version := range versions {
+		if version == product.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// parseETags parses a list of entity tags into the versions they refer to, or reports "*". With
+// strong, the weak tags are left out as they never match in a strong comparison
+func parseETags(header string, strong bool) (versions []int, any bool) {
+	if strings.TrimSpace(header) == "*" {
+		any = true
+		return
+	}
+
+	versions = []int{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strong && strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		tag = strings.TrimPrefix(tag, "W/")
+
+		if !strings.HasPrefix(tag, `"v`) || !strings.HasSuffix(tag, `"`) || len(tag) < 3 {
+			continue
+		}
+
+		version, err := strconv.Atoi(tag[2 : len(tag)-1])
+		if err != nil {
+			continue
+		}
+		versions = append(versions, version)
+	}
+
+	return
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/repository"
+	"github.com/edwinbm5/go-product-web/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestNewCondition(t *testing.T) {
+	tag := etag(internal.Product{Version: 3})
+	if tag != `"v3"` {
+		t.Fatalf("got ETag %s, want a strong tag", tag)
+	}
+
+	// the tags sent by the API are accepted by If-Match, the weak ones are not
+	condition := newCondition(tag+`, W/"v4", "other"`, "")
+	if !slices.Equal(condition.IfMatch, []int{3}) {
+		t.Fatalf("got If-Match versions %v, want [3]", condition.IfMatch)
+	}
+
+	// an If-Match of weak tags only is never met
+	condition = newCondition(`W/"v3"`, "")
+	if condition.IfMatch == nil || condition.Met(&internal.Product{Version: 3}) {
+		t.Fatalf("got %+v, want a weak If-Match never met", condition)
+	}
+
+	// If-None-Match compares the weak tags too
+	condition = newCondition("", `W/"v5", "v6"`)
+	if !slices.Equal(condition.IfNoneMatch, []int{5, 6}) {
+		t.Fatalf("got If-None-Match versions %v, want [5 6]", condition.IfNoneMatch)
+	}
+
+	if condition = newCondition("*", "*"); !condition.Exists || !condition.Absent {
+		t.Fatalf("got %+v, want * to require the product to exist and to be absent", condition)
+	}
+}
+
+// TestDefaultProduct_UpdateIfMatch checks that the ETag of a product is accepted by the If-Match of
+// its update, while its weak form fails the precondition
+func TestDefaultProduct_UpdateIfMatch(t *testing.T) {
+	product := internal.Product{ID: 1, Name: "Product", CodeValue: "A", Expiration: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), Price: 10, Version: 1}
+	d := NewDefaultProduct(service.NewDefaultProduct(repository.NewProductMap([]internal.Product{product}, 1), nil), "02/01/2006", nil)
+	router := chi.NewRouter()
+	router.Patch("/products/{id}", d.Update())
+
+	tests := []struct {
+		ifMatch string
+		status  int
+		etag    string
+	}{
+		{ifMatch: `W/"v1"`, status: http.StatusPreconditionFailed},
+		{ifMatch: `"v1"`, status: http.StatusOK, etag: `"v2"`},
+		{ifMatch: `"v1"`, status: http.StatusPreconditionFailed},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPatch, "/products/1", strings.NewReader(`{"price":11}`))
+		r.Header.Set("Content-Type", ContentTypeMergePatch)
+		r.Header.Set("If-Match", test.ifMatch)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if w.Code != test.status || w.Header().Get("ETag") != test.etag {
+			t.Fatalf("If-Match %s: got status %d and ETag %q, want %d and %q", test.ifMatch, w.Code, w.Header().Get("ETag"), test.status, test.etag)
+		}
+	}
+}
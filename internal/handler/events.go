@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+// ContentTypeEventStream is the media type of the Server-Sent Events
+const ContentTypeEventStream = "text/event-stream"
+
+// EventJSON is the data of an event of the feed, deleted products have their ID only
+type EventJSON struct {
+	Sequence  int64        `json:"sequence"`
+	Type      string       `json:"type"`
+	Time      string       `json:"time"`
+	ProductID int          `json:"product_id"`
+	Product   *ProductJSON `json:"product,omitempty"`
+}
+
+// Events is a handler for follow the changes of the products as Server-Sent Events. The id of each
+// event is its sequence, a client that reconnects with the Last-Event-ID header (or the last_event_id
+// parameter) receives the events it missed. The id parameter, repeated or separated by commas, only
+// follows the events of those products
+func (d *DefaultProduct) Events() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseEventQuery(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		flusher, _ := w.(http.Flusher)
+
+		// the status is sent on the first call, so the errors before it are still reported
+		started := false
+		err = d.sv.Watch(r.Context(), query, func(events []internal.ProductEvent) error {
+			if !started {
+				w.Header().Set("Content-Type", ContentTypeEventStream)
+				w.Header().Set("Cache-Control", "no-cache")
+				w.WriteHeader(http.StatusOK)
+				started = true
+			}
+
+			// a comment keeps the idle connections open through the proxies
+			if len(events) == 0 {
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return err
+				}
+			}
+
+			for _, event := range events {
+				data, err := json.Marshal(d.eventJSON(event))
+				if err != nil {
+					return err
+				}
+
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Sequence, event.Type, data); err != nil {
+					return err
+				}
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		})
+
+		if !started && r.Context().Err() == nil {
+			problem(w, r, err)
+		}
+	}
+}
+
+// parseEventQuery reads the products and the last event of the feed from the request
+func parseEventQuery(r *http.Request) (query internal.ProductEventQuery, err error) {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	if lastEventID != "" {
+		if query.After, err = strconv.ParseInt(lastEventID, 10, 64); err != nil || query.After < 1 {
+			err = &tools.FieldError{Field: "last_event_id", Msg: "must be the id of an event"}
+			return
+		}
+	}
+
+	for _, value := range r.URL.Query()["id"] {
+		for _, part := range strings.Split(value, ",") {
+			id, convErr := strconv.Atoi(strings.TrimSpace(part))
+			if convErr != nil || id < 1 {
+				err = &tools.FieldError{Field: "id", Msg: "must be a list of product IDs"}
+				return
+			}
+			query.IDs = append(query.IDs, id)
+		}
+	}
+
+	return
+}
+
+// eventJSON converts an event to its representation in the feed
+func (d *DefaultProduct) eventJSON(event internal.ProductEvent) (ev EventJSON) {
+	ev = EventJSON{
+		Sequence:  event.Sequence,
+		Type:      event.Type,
+		Time:      event.Time.UTC().Format(time.RFC3339),
+		ProductID: event.Product.ID,
+	}
+
+	if event.Type != internal.ProductEventDeleted {
+		product := d.productJSON(event.Product)
+		ev.Product = &product
+	}
+	return
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/edwinbm5/go-product-web/internal/auth"
+	"github.com/edwinbm5/go-product-web/internal/platform/idempotency"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+// MaxIdempotencyKeyLength is the longest Idempotency-Key accepted
+const MaxIdempotencyKeyLength = 255
+
+// IdempotencyMiddleware is a middleware that replays the stored response of the POST, PUT and PATCH
+// requests retried with the same Idempotency-Key header. The keys are scoped to the principal
+// of the request and the body is buffered, so it must be mounted after the authentication and
+// the check of the scope
+type IdempotencyMiddleware struct {
+	// MaxBodySize is the biggest body buffered for a request with a key, by default the biggest import
+	MaxBodySize int64
+
+	store idempotency.Store
+}
+
+func NewIdempotencyMiddleware(store idempotency.Store) *IdempotencyMiddleware {
+	return &IdempotencyMiddleware{
+		MaxBodySize: MaxImportSize,
+		store:       store,
+	}
+}
+
+// Handle stores the first response for each key and replays it for the retries. A key reused with
+// a different request is rejected, and so is a retry while the first request is in progress
+func (m *IdempotencyMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodPatch) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > MaxIdempotencyKeyLength {
+			problem(w, r, &tools.FieldError{Field: "Idempotency-Key", Msg: "must have at most 255 characters"})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, m.MaxBodySize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				err = fmt.Errorf("%w: must have at most %d bytes", ErrInvalidBody, maxBytesErr.Limit)
+			} else {
+				err = ErrInvalidBody
+			}
+			problem(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		principal, _ := auth.FromContext(r.Context())
+		storeKey := idempotency.Key{Principal: principal.Name, Key: key}
+
+		stored, err := m.store.Begin(storeKey, fingerprint(r, body))
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		if stored != nil {
+			for name, values := range stored.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		// the key is released if the request fails or panics, so it can be retried
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		completed := false
+		defer func() {
+			if !completed {
+				m.store.Abort(storeKey)
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status >= http.StatusInternalServerError {
+			return
+		}
+
+		m.store.Complete(storeKey, idempotency.Response{
+			Status: recorder.status,
+			Header: w.Header().Clone(),
+			Body:   recorder.body.Bytes(),
+		})
+		completed = true
+	})
+}
+
+// fingerprintHeaders are the request headers that change what a write does
+var fingerprintHeaders = []string{"Content-Type", "If-Match", "If-None-Match"}
+
+// fingerprint identifies a request by its method, path, query, the headers that change its
+// behaviour and its body
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery + "\n"))
+	for _, name := range fingerprintHeaders {
+		hash.Write([]byte(name + ": " + strings.Join(r.Header.Values(name), ", ") + "\n"))
+	}
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder writes a response while it keeps a copy of its status and body
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal/platform/idempotency"
+)
+
+// TestIdempotencyMiddleware_Fingerprint checks that a key reused with a different query or
+// condition is rejected instead of replaying the first response
+func TestIdempotencyMiddleware_Fingerprint(t *testing.T) {
+	calls := 0
+	handler := NewIdempotencyMiddleware(idempotency.NewStoreMemory(time.Hour)).Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+
+	send := func(target, ifMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"products":[]}`))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Idempotency-Key", "import-1")
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := send("/products/import?dry_run=true", ""); w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// the same request is replayed
+	if w := send("/products/import?dry_run=true", ""); w.Header().Get("Idempotent-Replayed") != "true" || calls != 1 {
+		t.Fatalf("got %d calls and headers %v, want the response replayed", calls, w.Header())
+	}
+
+	for _, request := range []struct{ target, ifMatch string }{
+		{target: "/products/import"},
+		{target: "/products/import?dry_run=true&strategy=replace"},
+		{target: "/products/import?dry_run=true", ifMatch: `"v1"`},
+	} {
+		if w := send(request.target, request.ifMatch); w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s %s: got status %d, want %d", request.target, request.ifMatch, w.Code, http.StatusUnprocessableEntity)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("got %d calls, want the handler called once", calls)
+	}
+}
+
+// TestIdempotencyMiddleware_MaxBodySize checks that a body bigger than the limit is rejected
+// before it is buffered or reaches the handler
+func TestIdempotencyMiddleware_MaxBodySize(t *testing.T) {
+	calls := 0
+	middleware := NewIdempotencyMiddleware(idempotency.NewStoreMemory(time.Hour))
+	middleware.MaxBodySize = 16
+	handler := middleware.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, test := range []struct {
+		body   string
+		status int
+	}{
+		{body: strings.Repeat("a", 17), status: http.StatusBadRequest},
+		{body: strings.Repeat("a", 16), status: http.StatusOK},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/products/batch", strings.NewReader(test.body))
+		r.Header.Set("Idempotency-Key", "batch-1")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Fatalf("body of %d bytes: got status %d, want %d", len(test.body), w.Code, test.status)
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("got %d calls, want the handler called once", calls)
+	}
+}
+
+// TestIdempotencyMiddleware_InProgress checks that a retry sent while the first request is in
+// progress is refused with a conflict, and replayed once the first request completed
+func TestIdempotencyMiddleware_InProgress(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := NewIdempotencyMiddleware(idempotency.NewStoreMemory(time.Hour)).Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	send := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{"name":"A"}`))
+		r.Header.Set("Idempotency-Key", "create-1")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- send() }()
+	<-started
+
+	if w := send(); w.Code != http.StatusConflict || w.Header().Get("Content-Type") != ContentTypeProblem {
+		t.Fatalf("got status %d, want a %d problem", w.Code, http.StatusConflict)
+	}
+
+	close(release)
+	if w := <-first; w.Code != http.StatusCreated {
+		t.Fatalf("got status %d for the first request, want %d", w.Code, http.StatusCreated)
+	}
+
+	if w := send(); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("got status %d and headers %v, want the response replayed", w.Code, w.Header())
+	}
+}
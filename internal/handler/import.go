@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/auth"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+// MaxImportSize is the biggest CSV upload accepted by an import
+const MaxImportSize = 10 << 20
+
+// Formats of an export, excel is a CSV that starts with a byte order mark
+const (
+	ExportFormatCSV   = "csv"
+	ExportFormatExcel = "excel"
+)
+
+// Export is a handler for download the products that match the filters of the query string as a CSV,
+// sorted by the query string and without pagination
+func (d *DefaultProduct) Export() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = ExportFormatCSV
+		}
+
+		if format != ExportFormatCSV && format != ExportFormatExcel {
+			problem(w, r, &tools.FieldError{Field: "format", Msg: "must be csv or excel"})
+			return
+		}
+
+		query, err := parseProductQuery(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+		query.Page, query.PageSize = 0, 0
+
+		products, _, err := d.sv.GetAll(r.Context(), query)
+		if err != nil && !errors.Is(err, internal.ErrProductsEmpty) {
+			problem(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="products.csv"`)
+		w.WriteHeader(http.StatusOK)
+		internal.WriteProductsCSV(w, products, d.dateLayout, format == ExportFormatExcel)
+	}
+}
+
+// Import is a handler for import the products of a CSV uploaded as the file field of a multipart form.
+// The strategy, dry_run and mapping fields can be sent in the form or in the query string
+func (d *DefaultProduct) Import() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, MaxImportSize)
+		if err := r.ParseMultipartForm(MaxImportSize); err != nil {
+			if errors.Is(err, http.ErrNotMultipart) {
+				err = fmt.Errorf("%w: the CSV must be uploaded as multipart/form-data", ErrUnsupportedMediaType)
+			} else {
+				err = ErrInvalidBody
+			}
+			problem(w, r, err)
+			return
+		}
+
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			problem(w, r, &tools.FieldError{Field: "file", Msg: "is required"})
+			return
+		}
+		defer file.Close()
+
+		imp := internal.ProductImport{Strategy: r.FormValue("strategy")}
+		if imp.Strategy == "" {
+			imp.Strategy = internal.ProductImportInsert
+		}
+
+		if !slices.Contains(internal.ProductImportStrategies, imp.Strategy) {
+			problem(w, r, &tools.FieldError{Field: "strategy", Msg: "must be " + strings.Join(internal.ProductImportStrategies, ", ")})
+			return
+		}
+
+		if v := r.FormValue("dry_run"); v != "" {
+			if imp.DryRun, err = strconv.ParseBool(v); err != nil {
+				problem(w, r, &tools.FieldError{Field: "dry_run", Msg: "must be a boolean"})
+				return
+			}
+		}
+
+		// a replace deletes every product, as the single deletes it needs the delete scope
+		principal, _ := auth.FromContext(r.Context())
+		if imp.Strategy == internal.ProductImportReplace && !principal.HasScope(auth.ScopeProductsDelete) {
+			problem(w, r, auth.ErrAuthForbidden)
+			return
+		}
+
+		mapping, err := internal.ParseProductCSVMapping(r.Form["mapping"])
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		if imp.Rows, err = internal.ReadProductsCSV(file, mapping); err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		report, err := d.sv.Import(r.Context(), imp)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		message := "Products imported successfully"
+		if imp.DryRun {
+			message = "Products checked, nothing was imported"
+		}
+
+		respond(w, r, http.StatusOK, map[string]any{
+			"message":  message,
+			"strategy": imp.Strategy,
+			"dry_run":  imp.DryRun,
+			"valid":    len(report.Errors) == 0,
+			"rows":     len(imp.Rows),
+			"created":  report.Created,
+			"updated":  report.Updated,
+			"deleted":  report.Deleted,
+			"errors":   rowErrorsJSON(report.Errors),
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/edwinbm5/go-product-web/internal/platform/codec"
+)
+
+// ProductCSVHeader is the header of the products responses in CSV
+var ProductCSVHeader = []string{"id", "name", "quantity", "code_value", "is_published", "expiration", "price", "version"}
+
+// codecKey is the context key of the codec negotiated for a response
+type codecKey struct{}
+
+// negotiated is the codec of a response and the media type it is sent as
+type negotiated struct {
+	codec     codec.Codec
+	mediaType string
+}
+
+// NegotiationMiddleware is a middleware that chooses the codec of the responses by the Accept
+// header, before the handler runs so a write is not applied when its response can't be sent
+type NegotiationMiddleware struct {
+	codecs *codec.Registry
+	// documents are the codecs of the responses that are not tables of products
+	documents *codec.Registry
+}
+
+func NewNegotiationMiddleware(codecs *codec.Registry) *NegotiationMiddleware {
+	return &NegotiationMiddleware{
+		codecs:    codecs,
+		documents: codecs.Documents(),
+	}
+}
+
+// Handle rejects the requests that accept none of the registered media types, it is used by the
+// routes that respond with products
+func (m *NegotiationMiddleware) Handle(next http.Handler) http.Handler {
+	return negotiate(m.codecs, next)
+}
+
+// HandleDocuments rejects the requests that accept none of the media types of the codecs that encode
+// any value, it is used by the routes that respond with other documents, such as the batches or a
+// deletion, which can't be sent as CSV
+func (m *NegotiationMiddleware) HandleDocuments(next http.Handler) http.Handler {
+	return negotiate(m.documents, next)
+}
+
+// negotiate chooses the codec of the request among the codecs before calling next
+func negotiate(codecs *codec.Registry, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, mediaType, err := codecs.Negotiate(r.Header.Get("Accept"))
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), codecKey{}, negotiated{codec: c, mediaType: mediaType})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// respond writes the body with the codec negotiated for the request, or JSON without one. A body
+// the codec can't encode, such as a message in CSV, is not acceptable
+func respond(w http.ResponseWriter, r *http.Request, status int, body any) {
+	n, ok := r.Context().Value(codecKey{}).(negotiated)
+	if !ok {
+		n = negotiated{codec: codec.JSON{}, mediaType: "application/json"}
+	}
+
+	var buf bytes.Buffer
+	if err := n.codec.Encode(&buf, body); err != nil {
+		if errors.Is(err, codec.ErrUnsupportedValue) {
+			err = fmt.Errorf("%w: %v", codec.ErrNotAcceptable, err)
+		}
+		problem(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", n.mediaType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// productsBody is a response body with products, encoded in CSV as a row per product
+type productsBody struct {
+	body     map[string]any
+	products []ProductJSON
+}
+
+func (p productsBody) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.body)
+}
+
+func (p productsBody) Table() (header []string, rows [][]string) {
+	rows = make([][]string, 0, len(p.products))
+	for _, product := range p.products {
+		rows = append(rows, []string{
+			strconv.Itoa(product.ID),
+			product.Name,
+			strconv.Itoa(product.Quantity),
+			product.CodeValue,
+			strconv.FormatBool(product.IsPublished),
+			product.Expiration,
+			strconv.FormatFloat(product.Price, 'f', -1, 64),
+			strconv.Itoa(product.Version),
+		})
+	}
+
+	header = ProductCSVHeader
+	return
+}
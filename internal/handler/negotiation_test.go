@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edwinbm5/go-product-web/internal/platform/codec"
+	"github.com/edwinbm5/go-product-web/internal/repository"
+	"github.com/edwinbm5/go-product-web/internal/service"
+)
+
+func newTestCodecs() *codec.Registry {
+	return codec.NewRegistry(codec.JSON{}, codec.XML{}, codec.YAML{}, codec.MessagePack{}, codec.CSV{})
+}
+
+// TestDefaultProduct_CreateFormats checks that a product is created from every format with an ISO
+// date, and that a body in an unknown format is rejected before the service is called
+func TestDefaultProduct_CreateFormats(t *testing.T) {
+	codecs := newTestCodecs()
+	d := NewDefaultProduct(service.NewDefaultProduct(repository.NewProductMap(nil, 0), nil), "2006-01-02", codecs)
+	handler := NewNegotiationMiddleware(codecs).Handle(d.Create())
+
+	tests := []struct {
+		contentType string
+		body        string
+		status      int
+	}{
+		{contentType: "application/json", body: `{"name":"A","quantity":1,"code_value":"A","is_published":true,"expiration":"2030-02-02","price":1.5}`, status: http.StatusCreated},
+		{contentType: "application/yaml", body: "name: B\nquantity: 1\ncode_value: B\nis_published: true\nexpiration: 2030-02-02\nprice: 1.5\n", status: http.StatusCreated},
+		{contentType: "application/xml", body: "<product><name>C</name><quantity>1</quantity><code_value>C</code_value><is_published>true</is_published><expiration>2030-02-02</expiration><price>1.5</price></product>", status: http.StatusCreated},
+		{contentType: "text/csv", body: "name,quantity,code_value,is_published,expiration,price\r\nD,1,D,true,2030-02-02,1.5\r\n", status: http.StatusCreated},
+		{contentType: "text/plain", body: "E", status: http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s: got status %d and body %s, want %d", test.contentType, w.Code, w.Body, test.status)
+		}
+	}
+}
+
+// TestNegotiationMiddleware_NotAcceptable checks that the requests accepting no registered media type
+// are rejected before the handler runs, and that the documents are not sent as CSV
+func TestNegotiationMiddleware_NotAcceptable(t *testing.T) {
+	m := NewNegotiationMiddleware(newTestCodecs())
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		respond(w, r, http.StatusOK, map[string]any{"message": "ok"})
+	})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		accept  string
+		status  int
+		want    string
+	}{
+		{name: "yaml", handler: m.Handle(next), accept: "application/yaml", status: http.StatusOK, want: "application/yaml"},
+		{name: "html", handler: m.Handle(next), accept: "text/html", status: http.StatusNotAcceptable, want: ContentTypeProblem},
+		{name: "json refused", handler: m.Handle(next), accept: "*/*, application/json;q=0", status: http.StatusOK, want: "application/xml"},
+		{name: "csv document", handler: m.HandleDocuments(next), accept: "text/csv", status: http.StatusNotAcceptable, want: ContentTypeProblem},
+		// a message is not a table, it can't be sent as CSV once negotiated
+		{name: "csv message", handler: m.Handle(next), accept: "text/csv", status: http.StatusNotAcceptable, want: ContentTypeProblem},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/products", nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		test.handler.ServeHTTP(w, r)
+
+		if w.Code != test.status || w.Header().Get("Content-Type") != test.want {
+			t.Errorf("%s: got status %d and %s, want %d and %s", test.name, w.Code, w.Header().Get("Content-Type"), test.status, test.want)
+		}
+	}
+
+	if calls != 3 {
+		t.Fatalf("got %d calls, want the handler called 3 times", calls)
+	}
+}
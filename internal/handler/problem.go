@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/auth"
+	"github.com/edwinbm5/go-product-web/internal/platform/codec"
+	"github.com/edwinbm5/go-product-web/internal/platform/idempotency"
+	"github.com/edwinbm5/go-product-web/internal/platform/patch"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Types of the problems, as URI references relative to the API
+const (
+	ProblemTypeValidation       = "/problems/validation"
+	ProblemTypeNotFound         = "/problems/not-found"
+	ProblemTypeConflict         = "/problems/conflict"
+	ProblemTypeUnauthorized     = "/problems/unauthorized"
+	ProblemTypeForbidden        = "/problems/forbidden"
+	ProblemTypePrecondition     = "/problems/precondition-failed"
+	ProblemTypeUnsupported      = "/problems/unsupported-media-type"
+	ProblemTypeNotAcceptable    = "/problems/not-acceptable"
+	ProblemTypeIdempotency      = "/problems/idempotency-key"
+	ProblemTypeBatchAborted     = "/problems/batch-aborted"
+	ProblemTypeEventsExpired    = "/problems/events-expired"
+	ProblemTypeAuditUnavailable = "/problems/audit-unavailable"
+	ProblemTypeInternal         = "/problems/internal"
+)
+
+// ContentTypeProblem is the media type of the problem details (RFC 7807)
+const ContentTypeProblem = "application/problem+json"
+
+var (
+	// ErrInvalidBody is returned when the request body can't be read or decoded
+	ErrInvalidBody = errors.New("Invalid request body")
+	// ErrUnsupportedMediaType is returned when the request body has a media type the handler can't decode
+	ErrUnsupportedMediaType = errors.New("Unsupported media type")
+)
+
+// ProblemJSON is the problem details (RFC 7807) of an error response
+type ProblemJSON struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Errors are the invalid fields of a validation problem
+	Errors []FieldErrorJSON `json:"errors,omitempty"`
+	// Reason and Permission tell why the operation was forbidden
+	Reason     string `json:"reason,omitempty"`
+	Permission string `json:"permission,omitempty"`
+}
+
+// FieldErrorJSON is an invalid field, Line is the line of an imported CSV where it was found
+type FieldErrorJSON struct {
+	Line    int    `json:"line,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// problem writes the problem details of an error as the response, the internal errors are logged
+// with the request ID since their detail is not disclosed
+func problem(w http.ResponseWriter, r *http.Request, err error) {
+	p := newProblem(err)
+	p.Instance = r.URL.Path
+	if p.Type == ProblemTypeInternal {
+		log.Printf("handler: request %s %s %s: %v", middleware.GetReqID(r.Context()), r.Method, r.URL.Path, err)
+	}
+
+	bytes, err := json.Marshal(p)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(p.Status)
+	w.Write(bytes)
+}
+
+// newProblem translates an error into its problem details, unknown errors are internal
+// errors and their detail is not disclosed
+func newProblem(err error) (p ProblemJSON) {
+	var (
+		fieldErrs    tools.FieldErrors
+		fieldErr     *tools.FieldError
+		rowErrs      internal.ProductRowErrors
+		forbiddenErr *auth.ForbiddenError
+	)
+
+	switch {
+	case errors.As(err, &rowErrs):
+		p = ProblemJSON{Type: ProblemTypeValidation, Title: "Invalid import", Status: http.StatusBadRequest,
+			Detail: "nothing was imported", Errors: rowErrorsJSON(rowErrs)}
+	case errors.As(err, &fieldErrs):
+		p = ProblemJSON{Type: ProblemTypeValidation, Title: "Invalid request", Status: http.StatusBadRequest}
+		for _, fieldErr := range fieldErrs {
+			p.Errors = append(p.Errors, FieldErrorJSON{Field: fieldErr.Field, Message: fieldErr.Msg})
+		}
+	case errors.As(err, &fieldErr):
+		p = ProblemJSON{Type: ProblemTypeValidation, Title: "Invalid request", Status: http.StatusBadRequest}
+		p.Errors = []FieldErrorJSON{{Field: fieldErr.Field, Message: fieldErr.Msg}}
+	case errors.Is(err, ErrInvalidBody),
+		errors.Is(err, internal.ErrProductInvalidField),
+		errors.Is(err, internal.ErrProductBatchInvalid),
+		errors.Is(err, internal.ErrProductCSV),
+		errors.Is(err, internal.ErrProductImportInvalid),
+		errors.Is(err, patch.ErrPatchInvalid),
+		errors.Is(err, patch.ErrPatchPath),
+		errors.Is(err, tools.ErrInvalidDay),
+		errors.Is(err, tools.ErrInvalidMonth),
+		errors.Is(err, tools.ErrInvalidYear),
+		errors.Is(err, tools.ErrInvalidDate),
+		errors.Is(err, tools.ErrInvalidDateFormat):
+		p = ProblemJSON{Type: ProblemTypeValidation, Title: "Invalid request", Status: http.StatusBadRequest, Detail: err.Error()}
+	case errors.Is(err, internal.ErrProductBatchAborted):
+		p = ProblemJSON{Type: ProblemTypeBatchAborted, Title: "Batch aborted", Status: http.StatusFailedDependency,
+			Detail: "not applied because another operation of the atomic batch failed"}
+	case errors.Is(err, internal.ErrProductNotFound):
+		p = ProblemJSON{Type: ProblemTypeNotFound, Title: "Product not found", Status: http.StatusNotFound, Detail: err.Error()}
+	case errors.Is(err, internal.ErrWebhookNotFound):
+		p = ProblemJSON{Type: ProblemTypeNotFound, Title: "Webhook not found", Status: http.StatusNotFound, Detail: err.Error()}
+	case errors.Is(err, internal.ErrWebhookDeliveryNotFound):
+		p = ProblemJSON{Type: ProblemTypeNotFound, Title: "Delivery not found", Status: http.StatusNotFound, Detail: err.Error()}
+	case errors.Is(err, internal.ErrWebhookDeliveryPending):
+		p = ProblemJSON{Type: ProblemTypeConflict, Title: "Delivery pending", Status: http.StatusConflict, Detail: err.Error()}
+	case errors.Is(err, internal.ErrProductsEmpty):
+		p = ProblemJSON{Type: ProblemTypeNotFound, Title: "Products not found", Status: http.StatusNotFound, Detail: err.Error()}
+	case errors.Is(err, internal.ErrProductCondition):
+		p = ProblemJSON{Type: ProblemTypePrecondition, Title: "Precondition failed", Status: http.StatusPreconditionFailed, Detail: err.Error()}
+	case errors.Is(err, internal.ErrProductEventsExpired):
+		p = ProblemJSON{Type: ProblemTypeEventsExpired, Title: "Events expired", Status: http.StatusGone,
+			Detail: "the events after the Last-Event-ID are no longer kept, read the products again and follow the new events"}
+	case errors.Is(err, internal.ErrAuditUnavailable):
+		p = ProblemJSON{Type: ProblemTypeAuditUnavailable, Title: "Audit log unavailable", Status: http.StatusServiceUnavailable,
+			Detail: "the changes can't be audited, no change is made until they are"}
+	case errors.Is(err, patch.ErrPatchTestFailed):
+		p = ProblemJSON{Type: ProblemTypeConflict, Title: "Patch test failed", Status: http.StatusConflict, Detail: err.Error()}
+	case errors.Is(err, codec.ErrNotAcceptable):
+		p = ProblemJSON{Type: ProblemTypeNotAcceptable, Title: "Not acceptable", Status: http.StatusNotAcceptable, Detail: err.Error()}
+	case errors.Is(err, ErrUnsupportedMediaType):
+		p = ProblemJSON{Type: ProblemTypeUnsupported, Title: "Unsupported media type", Status: http.StatusUnsupportedMediaType, Detail: err.Error()}
+	case errors.Is(err, idempotency.ErrKeyInProgress):
+		p = ProblemJSON{Type: ProblemTypeIdempotency, Title: "Request in progress", Status: http.StatusConflict, Detail: err.Error()}
+	case errors.Is(err, idempotency.ErrKeyMismatch):
+		p = ProblemJSON{Type: ProblemTypeIdempotency, Title: "Idempotency key reused", Status: http.StatusUnprocessableEntity, Detail: err.Error()}
+	case errors.Is(err, internal.ErrProductDuplicated):
+		p = ProblemJSON{Type: ProblemTypeConflict, Title: "Product already exists", Status: http.StatusConflict, Detail: err.Error()}
+	case errors.As(err, &forbiddenErr):
+		p = ProblemJSON{Type: ProblemTypeForbidden, Title: "Forbidden", Status: http.StatusForbidden,
+			Detail: "not allowed to perform this operation", Reason: forbiddenErr.Reason, Permission: forbiddenErr.Permission}
+	case errors.Is(err, auth.ErrAuthForbidden):
+		p = ProblemJSON{Type: ProblemTypeForbidden, Title: "Forbidden", Status: http.StatusForbidden,
+			Detail: "token is not allowed to perform this operation"}
+	case errors.Is(err, auth.ErrAuthTokenNotFound):
+		p = ProblemJSON{Type: ProblemTypeUnauthorized, Title: "Unauthorized", Status: http.StatusUnauthorized, Detail: "token is required"}
+	case errors.Is(err, auth.ErrAuthTokenInvalid):
+		p = ProblemJSON{Type: ProblemTypeUnauthorized, Title: "Unauthorized", Status: http.StatusUnauthorized, Detail: "token is invalid"}
+	default:
+		p = ProblemJSON{Type: ProblemTypeInternal, Title: "Internal server error", Status: http.StatusInternalServerError}
+	}
+
+	return
+}
+
+// rowErrorsJSON converts the errors of the rows of an import into the invalid fields of each line
+func rowErrorsJSON(rowErrs internal.ProductRowErrors) (data []FieldErrorJSON) {
+	data = make([]FieldErrorJSON, 0, len(rowErrs))
+	for _, rowErr := range rowErrs {
+		var (
+			fieldErrs tools.FieldErrors
+			fieldErr  *tools.FieldError
+		)
+
+		switch {
+		case errors.As(rowErr.Err, &fieldErrs):
+			for _, fieldErr := range fieldErrs {
+				data = append(data, FieldErrorJSON{Line: rowErr.Line, Field: fieldErr.Field, Message: fieldErr.Msg})
+			}
+		case errors.As(rowErr.Err, &fieldErr):
+			data = append(data, FieldErrorJSON{Line: rowErr.Line, Field: fieldErr.Field, Message: fieldErr.Msg})
+		default:
+			data = append(data, FieldErrorJSON{Line: rowErr.Line, Message: rowErr.Err.Error()})
+		}
+	}
+	return
+}
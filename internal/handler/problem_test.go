@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// TestProblem_Internal checks that an unknown error is logged with the request ID and answered
+// without its detail
+func TestProblem_Internal(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/products", nil)
+	r = r.WithContext(context.WithValue(r.Context(), middleware.RequestIDKey, "req-1"))
+	w := httptest.NewRecorder()
+
+	problem(w, r, errors.New("disk full"))
+
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "disk full") {
+		t.Fatalf("got %d %s, want 500 without the detail", w.Code, w.Body.String())
+	}
+	if line := logs.String(); !strings.Contains(line, "req-1") || !strings.Contains(line, "disk full") {
+		t.Fatalf("got log %q, want the request ID and the error", line)
+	}
+}
@@ -4,26 +4,37 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/bootcamp-go/web/response"
 	"github.com/edwinbm5/go-product-web/internal"
-	"github.com/edwinbm5/go-product-web/internal/auth"
+	"github.com/edwinbm5/go-product-web/internal/platform/codec"
 	"github.com/edwinbm5/go-product-web/internal/platform/tools"
 	"github.com/go-chi/chi/v5"
 )
 
+// Media types of the patch documents accepted by Update
+const (
+	ContentTypeMergePatch = "application/merge-patch+json"
+	ContentTypeJSONPatch  = "application/json-patch+json"
+)
+
 type DefaultProduct struct {
 	sv internal.ProductService
-	au auth.Auth
+	// dateLayout is the layout of the dates in the responses
+	dateLayout string
+	// codecs read the products of the request bodies by their Content-Type
+	codecs *codec.Registry
 }
 
-func NewDefaultProduct(sv internal.ProductService, au auth.Auth) *DefaultProduct {
+func NewDefaultProduct(sv internal.ProductService, dateLayout string, codecs *codec.Registry) *DefaultProduct {
 	return &DefaultProduct{
-		sv: sv,
-		au: au,
+		sv:         sv,
+		dateLayout: dateLayout,
+		codecs:     codecs,
 	}
 }
 
@@ -35,6 +46,17 @@ type ProductJSON struct {
 	IsPublished bool    `json:"is_published"`
 	Expiration  string  `json:"expiration"`
 	Price       float64 `json:"price"`
+	Version     int     `json:"version"`
+	// DeletedAt and DeletedBy are only set on the products of the trash
+	DeletedAt string `json:"deleted_at,omitempty"`
+	DeletedBy string `json:"deleted_by,omitempty"`
+}
+
+// ExpirationGroupJSON is a group of products expiring on the same day
+type ExpirationGroupJSON struct {
+	DaysRemaining int   `json:"days_remaining"`
+	Count         int   `json:"count"`
+	ProductIDs    []int `json:"product_ids"`
 }
 
 type ProductRequestBody struct {
@@ -46,423 +68,399 @@ type ProductRequestBody struct {
 	Price       float64 `json:"price"`
 }
 
-// GetAll is a handler for get all the products in the database
+// GetAll is a handler for get a page of the products in the database, filtered and sorted by the query string
 func (d *DefaultProduct) GetAll() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		products, err := d.sv.GetAll()
+		query, err := parseProductQuery(r)
 		if err != nil {
-			response.JSON(w, http.StatusInternalServerError, map[string]any{"message": err.Error()})
+			problem(w, r, err)
 			return
 		}
 
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message":  "Total products: " + strconv.Itoa(len(products)),
-			"products": products,
-		})
+		products, total, err := d.sv.GetAll(r.Context(), query)
+		if err != nil && !errors.Is(err, internal.ErrProductsEmpty) {
+			problem(w, r, err)
+			return
+		}
+
+		data := d.productsJSON(products)
+		respond(w, r, http.StatusOK, productsBody{products: data, body: map[string]any{
+			"message":  "Total products: " + strconv.Itoa(total),
+			"products": data,
+			"page":     newPageJSON(r, query, total),
+		}})
 	}
 }
 
-// GetByID is a handler for get by ID a product
-func (d *DefaultProduct) GetByID() http.HandlerFunc {
+// Search is a handler for search the products by name or code value, the best matches first
+func (d *DefaultProduct) Search() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		id := chi.URLParam(r, "id")
-		idInt, err := strconv.Atoi(id)
-		if err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{"message": "Invalid ID"})
+		text := r.URL.Query().Get("q")
+		if strings.TrimSpace(text) == "" {
+			problem(w, r, &tools.FieldError{Field: "q", Msg: "field is required"})
 			return
 		}
 
-		product, err := d.sv.GetByID(idInt)
+		query, err := parseProductQuery(r)
 		if err != nil {
-			response.JSON(w, http.StatusInternalServerError, map[string]any{"message": err.Error()})
+			problem(w, r, err)
 			return
 		}
 
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "Product found",
-			"product": product,
-		})
+		products, total, err := d.sv.Search(r.Context(), text, query)
+		if err != nil && !errors.Is(err, internal.ErrProductsEmpty) {
+			problem(w, r, err)
+			return
+		}
+
+		data := d.productsJSON(products)
+		respond(w, r, http.StatusOK, productsBody{products: data, body: map[string]any{
+			"message":  "Total products: " + strconv.Itoa(total),
+			"products": data,
+			"page":     newPageJSON(r, query, total),
+		}})
 	}
 }
 
-// Create is a handler for Create a new product in the database
-func (d *DefaultProduct) Create() http.HandlerFunc {
+// GetExpiring is a handler for get the products expiring within a duration (30 days by default),
+// grouped by days remaining
+func (d *DefaultProduct) GetExpiring() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-
-		// Validate authentication
-		token := r.Header.Get("token")
-		if token != d.au.GetToken() {
-			response.JSON(w, http.StatusUnauthorized, map[string]any{"message": "Unauthorized"})
-			return
+		within := 30 * 24 * time.Hour
+		if v := r.URL.Query().Get("within"); v != "" {
+			var err error
+			within, err = parseWithin(v)
+			if err != nil {
+				problem(w, r, err)
+				return
+			}
 		}
 
-		// Request - Read into bytes
-		bytes, err := io.ReadAll(r.Body)
+		query, err := parseProductQuery(r)
 		if err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "Invalid request body",
-			})
+			problem(w, r, err)
+			return
+		}
 
+		// the groups count every product of the query, not only those of the page
+		products, groups, total, err := d.sv.GetExpiring(r.Context(), within, query)
+		if err != nil && !errors.Is(err, internal.ErrProductsEmpty) {
+			problem(w, r, err)
 			return
 		}
 
-		// Parse to map (dynamic)
-		bodyMap := map[string]any{}
-		if err := json.Unmarshal(bytes, &bodyMap); err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "Invalid request body",
-			})
+		data := d.productsJSON(products)
+		respond(w, r, http.StatusOK, productsBody{products: data, body: map[string]any{
+			"message":  "Total products expiring: " + strconv.Itoa(total),
+			"products": data,
+			"groups":   groupsJSON(groups),
+			"page":     newPageJSON(r, query, total),
+		}})
+	}
+}
 
+// GetExpired is a handler for get the products already expired, grouped by days since they expired
+func (d *DefaultProduct) GetExpired() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseProductQuery(r)
+		if err != nil {
+			problem(w, r, err)
 			return
 		}
 
-		// Validate required fields
-		if err := tools.CheckFieldExistance(bodyMap, "name", "quantity", "code_value", "expiration", "price"); err != nil {
-			var fieldError *tools.FieldError
-			if errors.As(err, &fieldError) {
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": fmt.Sprintf("%s is required", fieldError.Field),
-				})
-
-				return
-			}
+		// the groups count every product of the query, not only those of the page
+		products, groups, total, err := d.sv.GetExpired(r.Context(), query)
+		if err != nil && !errors.Is(err, internal.ErrProductsEmpty) {
+			problem(w, r, err)
+			return
 		}
 
-		// Parse json to struct (static)
-		var body ProductRequestBody
-		if err := json.Unmarshal(bytes, &body); err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "Invalid request body",
-			})
+		data := d.productsJSON(products)
+		respond(w, r, http.StatusOK, productsBody{products: data, body: map[string]any{
+			"message":  "Total products expired: " + strconv.Itoa(total),
+			"products": data,
+			"groups":   groupsJSON(groups),
+			"page":     newPageJSON(r, query, total),
+		}})
+	}
+}
 
+// GetByID is a handler for get by ID a product
+func (d *DefaultProduct) GetByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseID(r)
+		if err != nil {
+			problem(w, r, err)
 			return
 		}
 
-		// Validate the product
-		product := internal.Product{
-			Name:        body.Name,
-			Quantity:    body.Quantity,
-			CodeValue:   body.CodeValue,
-			IsPublished: body.IsPublished,
-			Expiration:  body.Expiration,
-			Price:       body.Price,
+		product, err := d.sv.GetByID(r.Context(), id)
+		if err != nil {
+			problem(w, r, err)
+			return
 		}
 
-		// Create the product
-		if err := d.sv.Create(&product); err != nil {
-			switch {
-			case errors.Is(err, internal.ErrProductDuplicated):
-				response.JSON(w, http.StatusConflict, map[string]any{
-					"message": "Product already exists",
-				})
-			case errors.Is(err, tools.ErrInvalidDay):
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid day on date",
-				})
-			case errors.Is(err, tools.ErrInvalidMonth):
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid month on date",
-				})
-			case errors.Is(err, tools.ErrInvalidYear):
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid year on date",
-				})
-			default:
-				response.JSON(w, http.StatusInternalServerError, map[string]any{
-					"message": "Internal server error",
-				})
-			}
+		w.Header().Set("ETag", etag(product))
+		if notModified(r, product) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		data := d.productJSON(product)
+		respond(w, r, http.StatusOK, productsBody{products: []ProductJSON{data}, body: map[string]any{
+			"message": "Product found",
+			"product": data,
+		}})
+	}
+}
 
+// Create is a handler for Create a new product in the database
+func (d *DefaultProduct) Create() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		product, err := d.decodeProduct(r)
+		if err != nil {
+			problem(w, r, err)
 			return
 		}
 
-		// Response
-		data := ProductJSON{
-			ID:          product.ID,
-			Name:        product.Name,
-			Quantity:    product.Quantity,
-			CodeValue:   product.CodeValue,
-			IsPublished: product.IsPublished,
-			Expiration:  product.Expiration,
-			Price:       product.Price,
+		// Create the product
+		if err := d.sv.Create(r.Context(), &product); err != nil {
+			problem(w, r, err)
+			return
 		}
 
-		response.JSON(w, http.StatusCreated, map[string]any{
+		// Response
+		w.Header().Set("ETag", etag(product))
+		data := d.productJSON(product)
+		respond(w, r, http.StatusCreated, productsBody{products: []ProductJSON{data}, body: map[string]any{
 			"message": "Product created successfully",
 			"data":    data,
-		})
+		}})
 	}
 }
 
 // UpdateAndCreate is a handler for update or create a product in the database if not exists
 func (d *DefaultProduct) UpdateAndCreate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Validate authentication
-		token := r.Header.Get("token")
-		if token != d.au.GetToken() {
-			response.JSON(w, http.StatusUnauthorized, map[string]any{"message": "Unauthorized"})
+		id, err := parseID(r)
+		if err != nil {
+			problem(w, r, err)
 			return
 		}
 
-		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		product, err := d.decodeProduct(r)
 		if err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "Invalid ID",
-			})
-
+			problem(w, r, err)
 			return
 		}
+		product.ID = id
 
-		bytes, err := io.ReadAll(r.Body)
-		if err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "Invalid request body",
-			})
-
+		if err := d.sv.UpdateAndCreate(r.Context(), &product, parseCondition(r)); err != nil {
+			problem(w, r, err)
 			return
 		}
 
-		bodyMap := map[string]any{}
-		if err := json.Unmarshal(bytes, &bodyMap); err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "Invalid request body",
-			})
-		}
+		w.Header().Set("ETag", etag(product))
+		data := d.productJSON(product)
+		respond(w, r, http.StatusOK, productsBody{products: []ProductJSON{data}, body: map[string]any{
+			"message": "Product updated successfully",
+			"data":    data,
+		}})
+	}
+}
 
-		if err := tools.CheckFieldExistance(bodyMap, "name", "quantity", "code_value", "expiration", "price"); err != nil {
-			var fieldError *tools.FieldError
-			if errors.As(err, &fieldError) {
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": fmt.Sprintf("%s is required", fieldError.Field),
-				})
+// Update is a handler for patch a product in the database, either with a JSON Merge Patch
+// (also for application/json bodies) or a JSON Patch
+func (d *DefaultProduct) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseID(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
 
+		var patch internal.ProductPatch
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case ContentTypeMergePatch, "application/json", "":
+			var mergePatch internal.ProductMergePatch
+			if err := json.NewDecoder(r.Body).Decode(&mergePatch); err != nil || mergePatch == nil {
+				problem(w, r, ErrInvalidBody)
 				return
 			}
-		}
-
-		var body ProductRequestBody
-		if err := json.Unmarshal(bytes, &body); err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "Invalid request body",
-			})
-
+			patch = mergePatch
+		case ContentTypeJSONPatch:
+			var jsonPatch internal.ProductJSONPatch
+			if err := json.NewDecoder(r.Body).Decode(&jsonPatch); err != nil {
+				problem(w, r, ErrInvalidBody)
+				return
+			}
+			patch = jsonPatch
+		default:
+			w.Header().Set("Accept-Patch", ContentTypeMergePatch+", "+ContentTypeJSONPatch)
+			problem(w, r, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType))
 			return
 		}
 
-		product := internal.Product{
-			ID:          id,
-			Name:        body.Name,
-			Quantity:    body.Quantity,
-			CodeValue:   body.CodeValue,
-			IsPublished: body.IsPublished,
-			Expiration:  body.Expiration,
-			Price:       body.Price,
-		}
-
-		if err := d.sv.UpdateAndCreate(&product); err != nil {
-			switch {
-			case errors.Is(err, internal.ErrProductDuplicated):
-				response.JSON(w, http.StatusConflict, map[string]any{
-					"message": "Product already exists",
-				})
-			case errors.Is(err, tools.ErrInvalidDay):
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid day on date",
-				})
-			case errors.Is(err, tools.ErrInvalidMonth):
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid month on date",
-				})
-			case errors.Is(err, tools.ErrInvalidYear):
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid year on date",
-				})
-			default:
-				response.JSON(w, http.StatusInternalServerError, map[string]any{
-					"message": "Internal server error",
-				})
-			}
-
+		product, err := d.sv.Update(r.Context(), id, patch, parseCondition(r))
+		if err != nil {
+			problem(w, r, err)
 			return
 		}
 
-		response.JSON(w, http.StatusOK, map[string]any{
+		w.Header().Set("ETag", etag(product))
+		data := d.productJSON(product)
+		respond(w, r, http.StatusOK, productsBody{products: []ProductJSON{data}, body: map[string]any{
 			"message": "Product updated successfully",
-			"data": ProductJSON{
-				ID:          product.ID,
-				Name:        product.Name,
-				Quantity:    product.Quantity,
-				CodeValue:   product.CodeValue,
-				IsPublished: product.IsPublished,
-				Expiration:  product.Expiration,
-				Price:       product.Price,
-			},
-		})
+			"data":    data,
+		}})
 	}
 }
 
-// Update is a handler for update a product in the database
-func (d *DefaultProduct) Update() http.HandlerFunc {
+// Delete is a handler for move a product to the trash, it can be restored until it is purged
+func (d *DefaultProduct) Delete() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Validate authentication
-		token := r.Header.Get("token")
-		if token != d.au.GetToken() {
-			response.JSON(w, http.StatusUnauthorized, map[string]any{"message": "Unauthorized"})
-			return
-		}
-
-		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		id, err := parseID(r)
 		if err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "Invalid ID",
-			})
-
+			problem(w, r, err)
 			return
 		}
 
-		bodyMap := make(map[string]any)
-		if err := json.NewDecoder(r.Body).Decode(&bodyMap); err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "Invalid request body",
-			})
-
+		if err := d.sv.Delete(r.Context(), id, parseCondition(r)); err != nil {
+			problem(w, r, err)
 			return
 		}
 
-		if name, ok := bodyMap["name"]; ok {
-			_, ok := name.(string)
-			if !ok {
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid name",
-				})
+		respond(w, r, http.StatusOK, map[string]any{
+			"message": "Product deleted successfully",
+		})
+	}
+}
 
-				return
-			}
-		}
+// decodeProduct reads a product from the request body in the format of its Content-Type, with all
+// its fields required. The product is read as a JSON document, so every format is validated alike
+func (d *DefaultProduct) decodeProduct(r *http.Request) (product internal.Product, err error) {
+	c, err := d.codecs.ForContentType(r.Header.Get("Content-Type"))
+	if err != nil {
+		err = fmt.Errorf("%w: %s", ErrUnsupportedMediaType, r.Header.Get("Content-Type"))
+		return
+	}
 
-		if quantity, ok := bodyMap["quantity"]; ok {
-			_, ok := quantity.(int)
-			if !ok {
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid quantity",
-				})
+	doc := map[string]any{}
+	if err = c.Decode(r.Body, &doc); err != nil {
+		err = ErrInvalidBody
+		return
+	}
 
-				return
-			}
-		}
+	// the text formats only have strings
+	if _, ok := c.(codec.Untyped); ok {
+		internal.ProductDocumentFromText(doc)
+	}
 
-		if codeValue, ok := bodyMap["code_value"]; ok {
-			_, ok := codeValue.(string)
-			if !ok {
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid code value",
-				})
+	bytes, err := json.Marshal(doc)
+	if err != nil {
+		err = ErrInvalidBody
+		return
+	}
 
-				return
-			}
-		}
+	product, err = productFromJSON(bytes)
+	return
+}
 
-		if isPublished, ok := bodyMap["is_published"]; ok {
-			_, ok := isPublished.(bool)
-			if !ok {
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid is published",
-				})
+// productFromJSON parses a product with all its fields required
+func productFromJSON(bytes []byte) (product internal.Product, err error) {
+	// Parse to map (dynamic)
+	bodyMap := map[string]any{}
+	if err = json.Unmarshal(bytes, &bodyMap); err != nil {
+		err = ErrInvalidBody
+		return
+	}
 
-				return
-			}
-		}
+	// Validate the fields, every violation is reported at once
+	if err = internal.ProductSchema.Validate(bodyMap); err != nil {
+		return
+	}
 
-		if expiration, ok := bodyMap["expiration"]; ok {
-			_, ok := expiration.(string)
-			if !ok {
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid expiration",
-				})
+	// Parse json to struct (static)
+	var body ProductRequestBody
+	if err = json.Unmarshal(bytes, &body); err != nil {
+		err = ErrInvalidBody
+		return
+	}
 
-				return
-			}
-		}
+	expiration, err := tools.ParseDate(body.Expiration)
+	if err != nil {
+		err = &tools.FieldError{Field: "expiration", Msg: err.Error()}
+		return
+	}
 
-		if price, ok := bodyMap["price"]; ok {
-			_, ok := price.(float64)
-			if !ok {
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid price",
-				})
+	product = internal.Product{
+		Name:        body.Name,
+		Quantity:    body.Quantity,
+		CodeValue:   body.CodeValue,
+		IsPublished: body.IsPublished,
+		Expiration:  expiration,
+		Price:       body.Price,
+	}
+	return
+}
 
-				return
-			}
-		}
+// parseID reads the ID of the URL, of a product or of a webhook and its deliveries
+func parseID(r *http.Request) (id int, err error) {
+	id, err = strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		err = &tools.FieldError{Field: "id", Msg: "must be an integer"}
+		return
+	}
 
-		if err := d.sv.Update(id, bodyMap); err != nil {
-			switch {
-			case errors.Is(err, internal.ErrProductNotFound):
-				response.JSON(w, http.StatusNotFound, map[string]any{
-					"message": "Product not found",
-				})
-			case errors.Is(err, internal.ErrProductDuplicated):
-				response.JSON(w, http.StatusConflict, map[string]any{
-					"message": "Product already exists",
-				})
-			case errors.Is(err, tools.ErrInvalidDay):
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid day on date",
-				})
-			case errors.Is(err, tools.ErrInvalidMonth):
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid month on date",
-				})
-			case errors.Is(err, tools.ErrInvalidYear):
-				response.JSON(w, http.StatusBadRequest, map[string]any{
-					"message": "Invalid year on date",
-				})
-			default:
-				response.JSON(w, http.StatusInternalServerError, map[string]any{
-					"message": "Internal server error",
-				})
-			}
+	return
+}
 
-			return
-		}
+// productJSON converts a product to its response representation
+func (d *DefaultProduct) productJSON(product internal.Product) (data ProductJSON) {
+	data = ProductJSON{
+		ID:          product.ID,
+		Name:        product.Name,
+		Quantity:    product.Quantity,
+		CodeValue:   product.CodeValue,
+		IsPublished: product.IsPublished,
+		Expiration:  product.Expiration.Format(d.dateLayout),
+		Price:       product.Price,
+		Version:     product.Version,
+		DeletedBy:   product.DeletedBy,
+	}
 
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "Product updated successfully",
-		})
+	if !product.DeletedAt.IsZero() {
+		data.DeletedAt = product.DeletedAt.Format(time.RFC3339)
 	}
+	return
 }
 
-// Delete is a handler for delete a product in the database
-func (d *DefaultProduct) Delete() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		id, err := strconv.Atoi(chi.URLParam(r, "id"))
-		if err != nil {
-			response.JSON(w, http.StatusBadRequest, map[string]any{
-				"message": "Invalid ID",
-			})
-
-			return
-		}
-
-		if err := d.sv.Delete(id); err != nil {
-			switch {
-			case errors.Is(err, internal.ErrProductNotFound):
-				response.JSON(w, http.StatusNotFound, map[string]any{
-					"message": "Product not found",
-				})
-			default:
-				response.JSON(w, http.StatusInternalServerError, map[string]any{
-					"message": "Internal server error",
-				})
+// productsJSON converts a list of products to their response representation
+func (d *DefaultProduct) productsJSON(products []internal.Product) (data []ProductJSON) {
+	data = make([]ProductJSON, 0, len(products))
+	for _, product := range products {
+		data = append(data, d.productJSON(product))
+	}
 
-			}
+	return
+}
 
-			return
+// groupsJSON converts the groups of products by days remaining to their response representation
+func groupsJSON(groups []internal.ExpirationGroup) (data []ExpirationGroupJSON) {
+	data = make([]ExpirationGroupJSON, 0, len(groups))
+	for _, group := range groups {
+		ids := make([]int, 0, len(group.Products))
+		for _, product := range group.Products {
+			ids = append(ids, product.ID)
 		}
 
-		response.JSON(w, http.StatusOK, map[string]any{
-			"message": "Product deleted successfully",
+		data = append(data, ExpirationGroupJSON{
+			DaysRemaining: group.DaysRemaining,
+			Count:         len(ids),
+			ProductIDs:    ids,
 		})
-
 	}
+
+	return
 }
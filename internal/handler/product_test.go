@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/repository"
+	"github.com/edwinbm5/go-product-web/internal/service"
+)
+
+// TestDefaultProduct_GetExpiredGroups checks that the groups of the expired products count every
+// product of the query, while the products are those of the page
+func TestDefaultProduct_GetExpiredGroups(t *testing.T) {
+	var products []internal.Product
+	for index, day := range []int{1, 1, 2, 2, 2} {
+		products = append(products, internal.Product{ID: index + 1, Name: "Product", CodeValue: string(rune('A' + index)),
+			Expiration: time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC), Version: 1})
+	}
+	d := NewDefaultProduct(service.NewDefaultProduct(repository.NewProductMap(products, len(products)), nil), "02/01/2006", nil)
+
+	w := httptest.NewRecorder()
+	d.GetExpired().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/expired?page=2&page_size=2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var body struct {
+		Products []ProductJSON         `json:"products"`
+		Groups   []ExpirationGroupJSON `json:"groups"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.Products) != 2 || body.Products[0].ID != 3 {
+		t.Fatalf("got products %+v, want the products 3 and 4", body.Products)
+	}
+	if groups := body.Groups; len(groups) != 2 || groups[0].Count != 2 || groups[1].Count != 3 {
+		t.Fatalf("got groups %+v, want the 5 products in groups of 2 and 3", groups)
+	}
+}
+
+// TestParseWithin checks the durations accepted by the within parameter, a count of days or weeks
+// too big for a duration is refused rather than wrapped around
+func TestParseWithin(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		fails bool
+	}{
+		{value: "30d", want: 30 * 24 * time.Hour},
+		{value: "2w", want: 14 * 24 * time.Hour},
+		{value: "36h", want: 36 * time.Hour},
+		{value: "106751d", want: 106751 * 24 * time.Hour},
+		{value: "106752d", fails: true},
+		{value: "300000d", fails: true},
+		{value: "15251w", fails: true},
+		{value: "0d", fails: true},
+		{value: "-1d", fails: true},
+		{value: "d", fails: true},
+	}
+
+	for _, test := range tests {
+		within, err := parseWithin(test.value)
+		if test.fails {
+			if err == nil {
+				t.Fatalf("%s: got %v, want an error", test.value, within)
+			}
+			continue
+		}
+
+		if err != nil || within != test.want {
+			t.Fatalf("%s: got %v and error %v, want %v", test.value, within, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+const (
+	// DefaultPageSize is the page size used when the request does not set one
+	DefaultPageSize = 50
+	// MaxPageSize is the biggest page size a request can ask for
+	MaxPageSize = 500
+)
+
+// PageJSON is the pagination data returned with a list of products
+type PageJSON struct {
+	Total    int       `json:"total"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
+	Links    LinksJSON `json:"links"`
+}
+
+type LinksJSON struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// parseProductQuery reads the pagination, sorting and filters of the request query string
+func parseProductQuery(r *http.Request) (query internal.ProductQuery, err error) {
+	values := r.URL.Query()
+
+	query.Page = 1
+	if v := values.Get("page"); v != "" {
+		query.Page, err = strconv.Atoi(v)
+		if err != nil || query.Page < 1 {
+			err = &tools.FieldError{Field: "page", Msg: "must be a positive integer"}
+			return
+		}
+	}
+
+	query.PageSize = DefaultPageSize
+	if v := values.Get("page_size"); v != "" {
+		query.PageSize, err = strconv.Atoi(v)
+		if err != nil || query.PageSize < 1 || query.PageSize > MaxPageSize {
+			err = &tools.FieldError{Field: "page_size", Msg: "must be an integer between 1 and " + strconv.Itoa(MaxPageSize)}
+			return
+		}
+	}
+
+	// the offset of the page must fit in an int
+	if query.Page > math.MaxInt/query.PageSize {
+		err = &tools.FieldError{Field: "page", Msg: "must be at most " + strconv.Itoa(math.MaxInt/query.PageSize)}
+		return
+	}
+
+	if v := values.Get("sort"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			s := internal.ProductSort{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+			if !slices.Contains(internal.ProductSortFields, s.Field) {
+				err = &tools.FieldError{Field: "sort", Msg: "can't sort by " + s.Field}
+				return
+			}
+			query.Sort = append(query.Sort, s)
+		}
+	}
+
+	if v := values.Get("is_published"); v != "" {
+		isPublished, parseErr := strconv.ParseBool(v)
+		if parseErr != nil {
+			err = &tools.FieldError{Field: "is_published", Msg: "must be a boolean"}
+			return
+		}
+		query.IsPublished = &isPublished
+	}
+
+	if query.PriceGte, err = parseFloatParam(values, "price_gte"); err != nil {
+		return
+	}
+
+	if query.PriceLte, err = parseFloatParam(values, "price_lte"); err != nil {
+		return
+	}
+
+	if query.ExpiresBefore, err = parseDateParam(values, "expires_before"); err != nil {
+		return
+	}
+
+	if query.ExpiresAfter, err = parseDateParam(values, "expires_after"); err != nil {
+		return
+	}
+
+	return
+}
+
+func parseFloatParam(values url.Values, name string) (f *float64, err error) {
+	v := values.Get(name)
+	if v == "" {
+		return
+	}
+
+	parsed, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		err = &tools.FieldError{Field: name, Msg: "must be a number"}
+		return
+	}
+
+	f = &parsed
+	return
+}
+
+func parseDateParam(values url.Values, name string) (t *time.Time, err error) {
+	v := values.Get(name)
+	if v == "" {
+		return
+	}
+
+	parsed, err := tools.ParseDate(v)
+	if err != nil {
+		err = &tools.FieldError{Field: name, Msg: "must be a date with format dd/mm/yyyy or yyyy-mm-dd"}
+		return
+	}
+
+	t = &parsed
+	return
+}
+
+// parseWithin parses a positive duration, either in days ("30d"), weeks ("2w") or any
+// unit accepted by time.ParseDuration ("36h")
+func parseWithin(v string) (within time.Duration, err error) {
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(v, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(v, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+
+	if unit == 0 {
+		within, err = time.ParseDuration(v)
+	} else {
+		var n int
+		n, err = strconv.Atoi(v[:len(v)-1])
+		// a count past the longest duration would wrap around to a wrong one
+		if err == nil && time.Duration(n) > math.MaxInt64/unit {
+			err = strconv.ErrRange
+		}
+		within = time.Duration(n) * unit
+	}
+
+	if err != nil || within <= 0 {
+		err = &tools.FieldError{Field: "within", Msg: "must be a positive duration like 30d, 2w or 36h"}
+		return
+	}
+
+	return
+}
+
+// newPageJSON builds the pagination data, the links keep every other parameter of the request
+func newPageJSON(r *http.Request, query internal.ProductQuery, total int) (page PageJSON) {
+	page = PageJSON{
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}
+
+	link := func(pageNumber int) string {
+		u := *r.URL
+		values := u.Query()
+		values.Set("page", strconv.Itoa(pageNumber))
+		values.Set("page_size", strconv.Itoa(query.PageSize))
+		u.RawQuery = values.Encode()
+		return u.RequestURI()
+	}
+
+	last := (total + query.PageSize - 1) / query.PageSize
+	if query.Page < last {
+		page.Links.Next = link(query.Page + 1)
+	}
+
+	if query.Page > 1 {
+		// a page past the end links back to the last page
+		prev := query.Page - 1
+		if prev > last {
+			prev = last
+		}
+		if prev >= 1 {
+			page.Links.Prev = link(prev)
+		}
+	}
+
+	return
+}
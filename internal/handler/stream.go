@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+// ContentTypeNDJSON is the media type of the newline delimited JSON of the stream
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// StreamFlushEvery is the number of products written before the stream is flushed to the client
+const StreamFlushEvery = 100
+
+// Stream is a handler for stream every product that matches the filters of the query string as
+// newline delimited JSON, sorted by ID and without pagination. The stream stops when the client
+// disconnects, and an error after the first product ends the response early
+func (d *DefaultProduct) Stream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range []string{"sort", "page", "page_size"} {
+			if r.URL.Query().Has(name) {
+				problem(w, r, &tools.FieldError{Field: name, Msg: "is not supported by the stream, the products are sorted by id"})
+				return
+			}
+		}
+
+		query, err := parseProductQuery(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		// the status is sent with the first product, so the errors before it are still reported
+		started := false
+		start := func() {
+			w.Header().Set("Content-Type", ContentTypeNDJSON)
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+
+		flusher, _ := w.(http.Flusher)
+		encoder := json.NewEncoder(w)
+		written := 0
+
+		err = d.sv.Stream(r.Context(), query, func(product internal.Product) error {
+			if !started {
+				start()
+			}
+
+			if err := encoder.Encode(d.productJSON(product)); err != nil {
+				return err
+			}
+
+			written++
+			if written%StreamFlushEvery == 0 && flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		})
+
+		switch {
+		case started:
+		case err == nil:
+			start()
+		case r.Context().Err() == nil:
+			problem(w, r, err)
+		}
+	}
+}
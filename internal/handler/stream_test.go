@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/repository"
+	"github.com/edwinbm5/go-product-web/internal/service"
+)
+
+// newStreamHandler returns the stream of n products, the products with an even ID are published
+func newStreamHandler(n int) http.HandlerFunc {
+	products := make([]internal.Product, 0, n)
+	for id := 1; id <= n; id++ {
+		products = append(products, internal.Product{ID: id, Name: "Product", CodeValue: fmt.Sprintf("P%d", id), IsPublished: id%2 == 0,
+			Expiration: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), Price: 10, Version: 1})
+	}
+
+	sv := service.NewDefaultProduct(repository.NewProductMap(products, n), nil)
+	return NewDefaultProduct(sv, "02/01/2006", nil).Stream()
+}
+
+// streamIDs decodes the lines of a stream and returns the IDs of the products, in their order
+func streamIDs(t *testing.T, w *httptest.ResponseRecorder) (ids []int) {
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var product ProductJSON
+		if err := json.Unmarshal(scanner.Bytes(), &product); err != nil {
+			t.Fatalf("got line %q, want a product: %v", scanner.Text(), err)
+		}
+		ids = append(ids, product.ID)
+	}
+	return
+}
+
+// TestDefaultProduct_Stream checks that every product of the filters is streamed as a line of JSON
+// in the order of the IDs, across the chunks read from the service
+func TestDefaultProduct_Stream(t *testing.T) {
+	n := 2*service.StreamChunkSize + 5
+	handler := newStreamHandler(n)
+
+	tests := []struct {
+		name  string
+		url   string
+		count int
+	}{
+		{name: "all", url: "/products/stream", count: n},
+		{name: "published", url: "/products/stream?is_published=true", count: n / 2},
+		{name: "none", url: "/products/stream?price_gte=100", count: 0},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.url, nil))
+
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != ContentTypeNDJSON {
+			t.Fatalf("%s: got status %d and content type %q, want %d and %q", test.name, w.Code, w.Header().Get("Content-Type"), http.StatusOK, ContentTypeNDJSON)
+		}
+
+		ids := streamIDs(t, w)
+		if len(ids) != test.count {
+			t.Fatalf("%s: got %d products, want %d", test.name, len(ids), test.count)
+		}
+		for index := 1; index < len(ids); index++ {
+			if ids[index] <= ids[index-1] {
+				t.Fatalf("%s: got ID %d after %d, want the IDs in order", test.name, ids[index], ids[index-1])
+			}
+		}
+	}
+}
+
+// TestDefaultProduct_StreamParameters checks that the sort and the pagination are refused, as the
+// invalid filters, before the stream starts
+func TestDefaultProduct_StreamParameters(t *testing.T) {
+	handler := newStreamHandler(3)
+
+	tests := []struct {
+		query string
+		field string
+	}{
+		{query: "sort=name", field: "sort"},
+		{query: "page=2", field: "page"},
+		{query: "page_size=10", field: "page_size"},
+		{query: "is_published=maybe", field: "is_published"},
+		{query: "price_gte=cheap", field: "price_gte"},
+		{query: "expires_before=tomorrow", field: "expires_before"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/stream?"+test.query, nil))
+
+		if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != ContentTypeProblem {
+			t.Fatalf("%s: got status %d and content type %q, want a 400 problem", test.query, w.Code, w.Header().Get("Content-Type"))
+		}
+
+		var p ProblemJSON
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Errors) != 1 || p.Errors[0].Field != test.field {
+			t.Fatalf("%s: got errors %+v, want the field %s", test.query, p.Errors, test.field)
+		}
+	}
+}
+
+// cancelingRecorder cancels the request when the first product is written, as a client that disconnects
+type cancelingRecorder struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w *cancelingRecorder) Write(data []byte) (int, error) {
+	w.cancel()
+	return w.ResponseRecorder.Write(data)
+}
+
+// TestDefaultProduct_StreamCanceled checks that the stream stops at the end of the chunk being written
+// when the client disconnects, and that no problem is written after the products
+func TestDefaultProduct_StreamCanceled(t *testing.T) {
+	handler := newStreamHandler(3 * service.StreamChunkSize)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &cancelingRecorder{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/stream", nil).WithContext(ctx))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+	if ids := streamIDs(t, w.ResponseRecorder); len(ids) != service.StreamChunkSize {
+		t.Fatalf("got %d products, want the first chunk of %d only", len(ids), service.StreamChunkSize)
+	}
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootcamp-go/web/response"
+	"github.com/edwinbm5/go-product-web/internal/auth"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+// DefaultToken is a handler that exchanges API keys for short-lived signed tokens
+type DefaultToken struct {
+	// keys authenticates the API keys
+	keys auth.Auth
+	// issuer signs the tokens
+	issuer auth.Issuer
+}
+
+func NewDefaultToken(keys auth.Auth, issuer auth.Issuer) *DefaultToken {
+	return &DefaultToken{
+		keys:   keys,
+		issuer: issuer,
+	}
+}
+
+type TokenRequestBody struct {
+	APIKey string   `json:"api_key"`
+	Scopes []string `json:"scopes"`
+}
+
+type TokenJSON struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// Create is a handler for issue a token for an API key, the token can be restricted to some of the key scopes
+func (d *DefaultToken) Create() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body TokenRequestBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			problem(w, r, ErrInvalidBody)
+			return
+		}
+
+		if body.APIKey == "" {
+			problem(w, r, &tools.FieldError{Field: "api_key", Msg: "field is required"})
+			return
+		}
+
+		principal, err := d.keys.Auth(body.APIKey)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		if len(body.Scopes) > 0 {
+			for _, scope := range body.Scopes {
+				if !principal.HasScope(scope) {
+					problem(w, r, fmt.Errorf("%w: api key was not granted %s", auth.ErrAuthForbidden, scope))
+					return
+				}
+			}
+			principal.Scopes = body.Scopes
+		}
+
+		token, expiresAt, err := d.issuer.Issue(principal)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		// tokens must not be cached
+		w.Header().Set("Cache-Control", "no-store")
+		response.JSON(w, http.StatusOK, TokenJSON{
+			AccessToken: token,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(time.Until(expiresAt).Round(time.Second).Seconds()),
+			Scope:       strings.Join(principal.Scopes, " "),
+		})
+	}
+}
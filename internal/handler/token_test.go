@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal/auth"
+)
+
+// TestDefaultToken_Scopes checks that a token is issued with the scopes of its key, or with the
+// ones requested when the key was granted all of them
+func TestDefaultToken_Scopes(t *testing.T) {
+	keys := auth.NewAuthKeys(filepath.Join(t.TempDir(), "keys.json"))
+	key, err := keys.Add("ci", []string{auth.ScopeProductsRead, auth.ScopeProductsWrite}, []string{auth.RoleEditor})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwt := auth.NewAuthJWTHS256([]byte("secret"), "go-product-web", "", time.Minute)
+	handler := NewDefaultToken(keys, jwt).Create()
+
+	tests := []struct {
+		name   string
+		scopes []string
+		status int
+		want   []string
+	}{
+		{name: "key scopes", status: http.StatusOK, want: []string{auth.ScopeProductsRead, auth.ScopeProductsWrite}},
+		{name: "narrowed", scopes: []string{auth.ScopeProductsRead}, status: http.StatusOK, want: []string{auth.ScopeProductsRead}},
+		{name: "widened", scopes: []string{auth.ScopeProductsRead, auth.ScopeProductsDelete}, status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		body, _ := json.Marshal(TokenRequestBody{APIKey: key, Scopes: test.scopes})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/token", strings.NewReader(string(body))))
+
+		if w.Code != test.status {
+			t.Fatalf("%s: got status %d, want %d", test.name, w.Code, test.status)
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+
+		var token TokenJSON
+		if err := json.Unmarshal(w.Body.Bytes(), &token); err != nil {
+			t.Fatal(err)
+		}
+
+		principal, err := jwt.Auth(token.AccessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(principal.Scopes, test.want) || token.Scope != strings.Join(test.want, " ") {
+			t.Errorf("%s: got scopes %v (%q), want %v", test.name, principal.Scopes, token.Scope, test.want)
+		}
+	}
+}
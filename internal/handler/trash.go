@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// GetTrash is a handler for get a page of the deleted products, filtered and sorted by the query string
+func (d *DefaultProduct) GetTrash() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parseProductQuery(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		products, total, err := d.sv.GetTrash(r.Context(), query)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		data := d.productsJSON(products)
+		respond(w, r, http.StatusOK, productsBody{products: data, body: map[string]any{
+			"message":  "Total products in the trash: " + strconv.Itoa(total),
+			"products": data,
+			"page":     newPageJSON(r, query, total),
+		}})
+	}
+}
+
+// Restore is a handler for move a product back from the trash
+func (d *DefaultProduct) Restore() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseID(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		product, err := d.sv.Restore(r.Context(), id)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", etag(product))
+		data := d.productJSON(product)
+		respond(w, r, http.StatusOK, productsBody{products: []ProductJSON{data}, body: map[string]any{
+			"message": "Product restored successfully",
+			"data":    data,
+		}})
+	}
+}
@@ -0,0 +1,325 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
+
+// DefaultWebhook is a handler of the webhooks notified of the changes of the products
+type DefaultWebhook struct {
+	sv internal.WebhookService
+}
+
+func NewDefaultWebhook(sv internal.WebhookService) *DefaultWebhook {
+	return &DefaultWebhook{
+		sv: sv,
+	}
+}
+
+type WebhookRequestBody struct {
+	URL        string   `json:"url"`
+	Events     []string `json:"events"`
+	ProductIDs []int    `json:"product_ids"`
+	Secret     string   `json:"secret"`
+	Active     *bool    `json:"active"`
+}
+
+// WebhookJSON is a webhook, the secret is only shown when the webhook is created
+type WebhookJSON struct {
+	ID         int      `json:"id"`
+	URL        string   `json:"url"`
+	Events     []string `json:"events"`
+	ProductIDs []int    `json:"product_ids"`
+	Secret     string   `json:"secret,omitempty"`
+	Active     bool     `json:"active"`
+	CreatedAt  string   `json:"created_at"`
+	UpdatedAt  string   `json:"updated_at"`
+}
+
+type WebhookAttemptJSON struct {
+	Time       string `json:"time"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// WebhookDeliveryJSON is a delivery with the history of its attempts, NextAttempt is only set while it is pending
+type WebhookDeliveryJSON struct {
+	ID          int                  `json:"id"`
+	WebhookID   int                  `json:"webhook_id"`
+	Status      string               `json:"status"`
+	Event       EventJSON            `json:"event"`
+	Failures    int                  `json:"failures"`
+	NextAttempt string               `json:"next_attempt,omitempty"`
+	CreatedAt   string               `json:"created_at"`
+	Attempts    []WebhookAttemptJSON `json:"attempts"`
+}
+
+// GetAll is a handler for list the webhooks
+func (d *DefaultWebhook) GetAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhooks, err := d.sv.GetAll(r.Context())
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		data := make([]WebhookJSON, 0, len(webhooks))
+		for _, webhook := range webhooks {
+			data = append(data, webhookJSON(webhook, false))
+		}
+
+		respond(w, r, http.StatusOK, map[string]any{
+			"message": "Webhooks found",
+			"data":    data,
+		})
+	}
+}
+
+// GetByID is a handler for get a webhook by its ID
+func (d *DefaultWebhook) GetByID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseID(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		webhook, err := d.sv.GetByID(r.Context(), id)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		respond(w, r, http.StatusOK, map[string]any{
+			"message": "Webhook found",
+			"data":    webhookJSON(webhook, false),
+		})
+	}
+}
+
+// Create is a handler for register a webhook, it is active unless the body says otherwise. The
+// response has the secret of the signatures, generated when the body has none
+func (d *DefaultWebhook) Create() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhook, err := decodeWebhook(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		if err := d.sv.Create(r.Context(), &webhook); err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		respond(w, r, http.StatusCreated, map[string]any{
+			"message": "Webhook created successfully",
+			"data":    webhookJSON(webhook, true),
+		})
+	}
+}
+
+// Update is a handler for replace a webhook, its secret is kept when the body has none
+func (d *DefaultWebhook) Update() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseID(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		webhook, err := decodeWebhook(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+		webhook.ID = id
+
+		if err := d.sv.Update(r.Context(), &webhook); err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		respond(w, r, http.StatusOK, map[string]any{
+			"message": "Webhook updated successfully",
+			"data":    webhookJSON(webhook, false),
+		})
+	}
+}
+
+// Delete is a handler for delete a webhook and its deliveries
+func (d *DefaultWebhook) Delete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseID(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		if err := d.sv.Delete(r.Context(), id); err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		respond(w, r, http.StatusOK, map[string]any{
+			"message": "Webhook deleted successfully",
+		})
+	}
+}
+
+// Deliveries is a handler for the history of the deliveries of a webhook, the newest first,
+// filtered by the status parameter
+func (d *DefaultWebhook) Deliveries() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseID(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		d.deliveries(w, r, internal.WebhookDeliveryQuery{WebhookID: id, Status: r.URL.Query().Get("status")})
+	}
+}
+
+// DeadLetters is a handler for the dead deliveries of every webhook, the newest first
+func (d *DefaultWebhook) DeadLetters() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d.deliveries(w, r, internal.WebhookDeliveryQuery{Status: internal.WebhookDeliveryDead})
+	}
+}
+
+// Redeliver is a handler for queue a delivered or dead delivery again
+func (d *DefaultWebhook) Redeliver() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseID(r)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		delivery, err := d.sv.Redeliver(r.Context(), id)
+		if err != nil {
+			problem(w, r, err)
+			return
+		}
+
+		respond(w, r, http.StatusAccepted, map[string]any{
+			"message": "Delivery queued again",
+			"data":    webhookDeliveryJSON(delivery),
+		})
+	}
+}
+
+// deliveries writes the deliveries that match the query
+func (d *DefaultWebhook) deliveries(w http.ResponseWriter, r *http.Request, query internal.WebhookDeliveryQuery) {
+	deliveries, err := d.sv.Deliveries(r.Context(), query)
+	if err != nil {
+		problem(w, r, err)
+		return
+	}
+
+	data := make([]WebhookDeliveryJSON, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		data = append(data, webhookDeliveryJSON(delivery))
+	}
+
+	respond(w, r, http.StatusOK, map[string]any{
+		"message": "Deliveries found",
+		"data":    data,
+	})
+}
+
+// decodeWebhook reads a webhook from the JSON body, every invalid or unknown field is reported
+func decodeWebhook(r *http.Request) (webhook internal.Webhook, err error) {
+	var doc map[string]any
+	if err = json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		err = ErrInvalidBody
+		return
+	}
+
+	if err = internal.WebhookSchema.ValidateStrict(doc); err != nil {
+		return
+	}
+
+	bytes, err := json.Marshal(doc)
+	if err != nil {
+		err = ErrInvalidBody
+		return
+	}
+
+	var body WebhookRequestBody
+	if err = json.Unmarshal(bytes, &body); err != nil {
+		err = ErrInvalidBody
+		return
+	}
+
+	webhook = internal.Webhook{
+		URL:        body.URL,
+		Events:     body.Events,
+		ProductIDs: body.ProductIDs,
+		Secret:     body.Secret,
+		Active:     body.Active == nil || *body.Active,
+	}
+	return
+}
+
+// webhookJSON converts a webhook to its response representation
+func webhookJSON(webhook internal.Webhook, secret bool) (wh WebhookJSON) {
+	wh = WebhookJSON{
+		ID:         webhook.ID,
+		URL:        webhook.URL,
+		Events:     webhook.Events,
+		ProductIDs: webhook.ProductIDs,
+		Active:     webhook.Active,
+		CreatedAt:  webhook.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:  webhook.UpdatedAt.Format(time.RFC3339),
+	}
+
+	if wh.Events == nil {
+		wh.Events = []string{}
+	}
+	if wh.ProductIDs == nil {
+		wh.ProductIDs = []int{}
+	}
+	if secret {
+		wh.Secret = webhook.Secret
+	}
+	return
+}
+
+// webhookDeliveryJSON converts a delivery to its response representation, without the product
+// of its event
+func webhookDeliveryJSON(delivery internal.WebhookDelivery) (d WebhookDeliveryJSON) {
+	d = WebhookDeliveryJSON{
+		ID:        delivery.ID,
+		WebhookID: delivery.WebhookID,
+		Status:    delivery.Status,
+		Event: EventJSON{
+			Sequence:  delivery.Event.Sequence,
+			Type:      delivery.Event.Type,
+			Time:      delivery.Event.Time.UTC().Format(time.RFC3339),
+			ProductID: delivery.Event.Product.ID,
+		},
+		Failures:  delivery.Failures,
+		CreatedAt: delivery.CreatedAt.Format(time.RFC3339),
+		Attempts:  make([]WebhookAttemptJSON, 0, len(delivery.Attempts)),
+	}
+
+	if delivery.Status == internal.WebhookDeliveryPending {
+		d.NextAttempt = delivery.NextAttempt.Format(time.RFC3339)
+	}
+
+	for _, attempt := range delivery.Attempts {
+		d.Attempts = append(d.Attempts, WebhookAttemptJSON{
+			Time:       attempt.Time.Format(time.RFC3339),
+			StatusCode: attempt.StatusCode,
+			Error:      attempt.Err,
+			DurationMS: attempt.Duration.Milliseconds(),
+		})
+	}
+	return
+}
@@ -0,0 +1,181 @@
+package codec
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotAcceptable is returned when no codec produces a media type of the Accept header
+	ErrNotAcceptable = errors.New("codec: no acceptable media type")
+	// ErrUnsupportedMediaType is returned when no codec reads the media type of a Content-Type header
+	ErrUnsupportedMediaType = errors.New("codec: unsupported media type")
+	// ErrUnsupportedValue is returned when a codec can't encode or decode a value, such as a value
+	// that is not a Table in CSV
+	ErrUnsupportedValue = errors.New("codec: unsupported value")
+)
+
+// Codec encodes and decodes the values of a format. The values are encoded as their JSON
+// representation, so the json tags of a value apply to every format
+type Codec interface {
+	// MediaTypes are the media types of the format, the first one is used in the responses
+	MediaTypes() []string
+	Encode(w io.Writer, v any) (err error)
+	// Decode reads a document into v, a *map[string]any is supported by every codec
+	Decode(r io.Reader, v any) (err error)
+}
+
+// Registry holds the codecs of the formats served by an API, the first one is the default
+type Registry struct {
+	codecs []Codec
+}
+
+// NewRegistry creates a new Registry with the codecs
+func NewRegistry(codecs ...Codec) *Registry {
+	return &Registry{
+		codecs: codecs,
+	}
+}
+
+// Register adds a codec, or replaces the codec registered before with its first media type
+func (r *Registry) Register(codec Codec) {
+	for i, c := range r.codecs {
+		if slices.Contains(c.MediaTypes(), codec.MediaTypes()[0]) {
+			r.codecs[i] = codec
+			return
+		}
+	}
+	r.codecs = append(r.codecs, codec)
+}
+
+// Documents returns a registry with the codecs that encode any value, the codecs that only encode
+// tables are left out. The default codec must encode any value
+func (r *Registry) Documents() *Registry {
+	documents := &Registry{}
+	for _, c := range r.codecs {
+		if _, ok := c.(TablesOnly); !ok {
+			documents.codecs = append(documents.codecs, c)
+		}
+	}
+	return documents
+}
+
+// Default returns the codec used when a request does not choose one
+func (r *Registry) Default() Codec {
+	return r.codecs[0]
+}
+
+// Negotiate returns the media type the Accept header prefers and its codec. An empty header
+// accepts the default codec
+func (r *Registry) Negotiate(accept string) (codec Codec, mediaType string, err error) {
+	if strings.TrimSpace(accept) == "" {
+		codec = r.Default()
+		mediaType = codec.MediaTypes()[0]
+		return
+	}
+
+	// the ranges with the same quality keep the order of the header
+	ranges := parseAccept(accept)
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	for _, rng := range ranges {
+		if rng.quality <= 0 {
+			break
+		}
+
+		// the wildcards match the default codec first
+		for _, c := range r.codecs {
+			for _, t := range c.MediaTypes() {
+				if rng.covers(t) && !rng.excluded(ranges, t) {
+					codec, mediaType = c, t
+					return
+				}
+			}
+		}
+	}
+
+	err = ErrNotAcceptable
+	return
+}
+
+// ForContentType returns the codec of the media type of a Content-Type header. An empty header
+// is read with the default codec
+func (r *Registry) ForContentType(contentType string) (codec Codec, err error) {
+	if strings.TrimSpace(contentType) == "" {
+		codec = r.Default()
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		err = ErrUnsupportedMediaType
+		return
+	}
+
+	for _, c := range r.codecs {
+		if slices.Contains(c.MediaTypes(), mediaType) {
+			codec = c
+			return
+		}
+	}
+
+	err = ErrUnsupportedMediaType
+	return
+}
+
+// mediaRange is a media range of an Accept header, such as text/* or application/json
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept reads the media ranges of an Accept header, the invalid ones are skipped
+func parseAccept(accept string) (ranges []mediaRange) {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+	}
+	return
+}
+
+// excluded reports whether another range of the header refuses the media type with q=0,
+// as in "*/*, text/csv;q=0"
+func (m mediaRange) excluded(ranges []mediaRange, mediaType string) bool {
+	for _, other := range ranges {
+		if other.quality <= 0 && other.mediaType != m.mediaType && other.covers(mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether the range is the media type or a wildcard of it
+func (m mediaRange) covers(mediaType string) bool {
+	if m.mediaType == "*/*" {
+		return true
+	}
+
+	prefix, found := strings.CutSuffix(m.mediaType, "/*")
+	if found {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return m.mediaType == mediaType
+}
@@ -0,0 +1,102 @@
+package codec
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func newTestRegistry() *Registry {
+	return NewRegistry(JSON{}, XML{}, YAML{}, MessagePack{}, CSV{})
+}
+
+func TestRegistry_Negotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+		err    error
+	}{
+		{accept: "", want: "application/json"},
+		{accept: "*/*", want: "application/json"},
+		{accept: "application/yaml", want: "application/yaml"},
+		{accept: "text/yaml", want: "text/yaml"},
+		{accept: "text/*", want: "text/xml"},
+		{accept: "text/csv;q=0.5, application/xml", want: "application/xml"},
+		{accept: "application/xml;q=0.5, text/csv;q=0.9", want: "text/csv"},
+		{accept: "application/msgpack, application/json", want: "application/msgpack"},
+		// the ranges with q=0 are refused, even when a wildcard covers them
+		{accept: "*/*, application/json;q=0", want: "application/xml"},
+		{accept: "text/*, text/xml;q=0", want: "text/yaml"},
+		{accept: "application/json;q=0", err: ErrNotAcceptable},
+		{accept: "*/*;q=0", err: ErrNotAcceptable},
+		{accept: "text/html", err: ErrNotAcceptable},
+		{accept: "not a media type", err: ErrNotAcceptable},
+	}
+
+	r := newTestRegistry()
+	for _, test := range tests {
+		c, mediaType, err := r.Negotiate(test.accept)
+		if !errors.Is(err, test.err) || mediaType != test.want {
+			t.Errorf("%q: got %q and error %v, want %q and %v", test.accept, mediaType, err, test.want, test.err)
+			continue
+		}
+
+		if err == nil && !slices.Contains(c.MediaTypes(), mediaType) {
+			t.Errorf("%q: got codec %T for %s", test.accept, c, mediaType)
+		}
+	}
+}
+
+func TestRegistry_NegotiateDocuments(t *testing.T) {
+	documents := newTestRegistry().Documents()
+
+	if _, _, err := documents.Negotiate("text/csv"); !errors.Is(err, ErrNotAcceptable) {
+		t.Fatalf("got error %v, want CSV not acceptable for the documents", err)
+	}
+	if _, mediaType, err := documents.Negotiate("text/csv, application/yaml;q=0.1"); err != nil || mediaType != "application/yaml" {
+		t.Fatalf("got %q and error %v, want application/yaml", mediaType, err)
+	}
+}
+
+func TestRegistry_ForContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        Codec
+		err         error
+	}{
+		{contentType: "", want: JSON{}},
+		{contentType: "application/json; charset=utf-8", want: JSON{}},
+		{contentType: "application/x-yaml", want: YAML{}},
+		{contentType: "text/xml", want: XML{}},
+		{contentType: "application/vnd.msgpack", want: MessagePack{}},
+		{contentType: "text/csv", want: CSV{}},
+		{contentType: "text/plain", err: ErrUnsupportedMediaType},
+		{contentType: "application/*", err: ErrUnsupportedMediaType},
+		{contentType: "json", err: ErrUnsupportedMediaType},
+	}
+
+	r := newTestRegistry()
+	for _, test := range tests {
+		c, err := r.ForContentType(test.contentType)
+		if !errors.Is(err, test.err) || c != test.want {
+			t.Errorf("%q: got %T and error %v, want %T and %v", test.contentType, c, err, test.want, test.err)
+		}
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := newTestRegistry()
+
+	// a codec with the first media type of a registered codec replaces it
+	r.Register(customJSON{})
+	if c, _ := r.ForContentType("application/json"); c != (customJSON{}) {
+		t.Fatalf("got codec %T, want the codec registered last", c)
+	}
+	if c := r.Default(); c != (customJSON{}) {
+		t.Fatalf("got default codec %T, want the replaced codec to stay the default", c)
+	}
+}
+
+type customJSON struct {
+	JSON
+}
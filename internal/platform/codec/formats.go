@@ -0,0 +1,385 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Table is implemented by the values that can be encoded as CSV, a header and a row per item
+type Table interface {
+	Table() (header []string, rows [][]string)
+}
+
+// Untyped is implemented by the codecs of text formats, such as XML and CSV, whose decoded
+// documents only have strings
+type Untyped interface {
+	Untyped()
+}
+
+// TablesOnly is implemented by the codecs that only encode Table values, such as CSV
+type TablesOnly interface {
+	TablesOnly()
+}
+
+// JSON is the codec of application/json
+type JSON struct{}
+
+func (JSON) MediaTypes() []string {
+	return []string{"application/json"}
+}
+
+func (JSON) Encode(w io.Writer, v any) (err error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	_, err = w.Write(data)
+	return
+}
+
+func (JSON) Decode(r io.Reader, v any) (err error) {
+	err = json.NewDecoder(r).Decode(v)
+	return
+}
+
+// YAML is the codec of application/yaml, the fields keep the order of the JSON representation
+type YAML struct{}
+
+func (YAML) MediaTypes() []string {
+	return []string{"application/yaml", "application/x-yaml", "text/yaml"}
+}
+
+func (YAML) Encode(w io.Writer, v any) (err error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	// JSON is YAML, its nodes are written back in the block style
+	var node yaml.Node
+	if err = yaml.Unmarshal(data, &node); err != nil {
+		return
+	}
+	blockStyle(&node)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(&node); err != nil {
+		return
+	}
+
+	err = encoder.Close()
+	return
+}
+
+// Decode reads the timestamps as the strings written, as in JSON, so a date such as 2030-02-02
+// keeps its format instead of becoming a time
+func (YAML) Decode(r io.Reader, v any) (err error) {
+	var node yaml.Node
+	if err = yaml.NewDecoder(r).Decode(&node); err != nil {
+		return
+	}
+	timestampStrings(&node)
+
+	err = node.Decode(v)
+	return
+}
+
+// timestampStrings tags the timestamps of the nodes as strings
+func timestampStrings(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!timestamp" {
+		node.Tag = "!!str"
+	}
+	for _, child := range node.Content {
+		timestampStrings(child)
+	}
+}
+
+// blockStyle clears the flow style and quotes of the nodes, the encoder quotes the strings that need it
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// MessagePack is the codec of application/msgpack, the integers of the JSON representation
+// are written as integers and the other numbers as floats
+type MessagePack struct{}
+
+func (MessagePack) MediaTypes() []string {
+	return []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}
+}
+
+func (MessagePack) Encode(w io.Writer, v any) (err error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+	if err = decoder.Decode(&value); err != nil {
+		return
+	}
+
+	encoder := msgpack.NewEncoder(w)
+	encoder.UseCompactInts(true)
+	err = encoder.Encode(msgpackValue(value))
+	return
+}
+
+func (MessagePack) Decode(r io.Reader, v any) (err error) {
+	decoder := msgpack.NewDecoder(r)
+	decoder.SetCustomStructTag("json")
+	err = decoder.Decode(v)
+	return
+}
+
+// msgpackValue converts the numbers of a JSON value into integers or floats
+func msgpackValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		n, _ := v.Float64()
+		return n
+	case map[string]any:
+		for key, child := range v {
+			v[key] = msgpackValue(child)
+		}
+	case []any:
+		for index, child := range v {
+			v[index] = msgpackValue(child)
+		}
+	}
+	return value
+}
+
+// XML is the codec of application/xml. The values are written as a response element with an
+// element per field of their JSON representation, and an item element per item of a list
+type XML struct{}
+
+func (XML) MediaTypes() []string {
+	return []string{"application/xml", "text/xml"}
+}
+
+func (XML) Untyped() {}
+
+func (XML) Encode(w io.Writer, v any) (err error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return
+	}
+
+	encoder := xml.NewEncoder(w)
+	if err = xmlElement(encoder, decoder, "response"); err != nil {
+		return
+	}
+
+	err = encoder.Flush()
+	return
+}
+
+// Decode reads the child elements of the root element into a *map[string]any. The elements with
+// children are read as maps, the repeated elements as lists and the others as strings
+func (XML) Decode(r io.Reader, v any) (err error) {
+	doc, ok := v.(*map[string]any)
+	if !ok {
+		err = fmt.Errorf("%w: %T in XML", ErrUnsupportedValue, v)
+		return
+	}
+
+	decoder := xml.NewDecoder(r)
+	for {
+		var token xml.Token
+		if token, err = decoder.Token(); err != nil {
+			return
+		}
+
+		if _, ok := token.(xml.StartElement); ok {
+			break
+		}
+	}
+
+	value, err := xmlValue(decoder)
+	if err != nil {
+		return
+	}
+
+	*doc, ok = value.(map[string]any)
+	if !ok {
+		*doc = map[string]any{}
+	}
+	return
+}
+
+// xmlElement writes the next JSON value of the decoder as an element
+func xmlElement(encoder *xml.Encoder, decoder *json.Decoder, name string) (err error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		text := ""
+		if token != nil {
+			text = fmt.Sprint(token)
+		}
+		err = encoder.EncodeElement(text, start)
+		return
+	}
+
+	if err = encoder.EncodeToken(start); err != nil {
+		return
+	}
+
+	for decoder.More() {
+		child := "item"
+		if delim == '{' {
+			var key json.Token
+			if key, err = decoder.Token(); err != nil {
+				return
+			}
+			child = key.(string)
+		}
+
+		if err = xmlElement(encoder, decoder, child); err != nil {
+			return
+		}
+	}
+
+	// the closing delimiter
+	if _, err = decoder.Token(); err != nil {
+		return
+	}
+
+	err = encoder.EncodeToken(start.End())
+	return
+}
+
+// xmlValue reads the content of the element just started, until its end
+func xmlValue(decoder *xml.Decoder) (value any, err error) {
+	var text strings.Builder
+	var children map[string]any
+	for {
+		var token xml.Token
+		if token, err = decoder.Token(); err != nil {
+			return
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.StartElement:
+			var child any
+			if child, err = xmlValue(decoder); err != nil {
+				return
+			}
+
+			if children == nil {
+				children = make(map[string]any)
+			}
+
+			// the repeated elements are a list
+			switch existing := children[t.Name.Local].(type) {
+			case nil:
+				children[t.Name.Local] = child
+			case []any:
+				children[t.Name.Local] = append(existing, child)
+			default:
+				children[t.Name.Local] = []any{existing, child}
+			}
+		case xml.EndElement:
+			if children != nil {
+				value = children
+			} else {
+				value = strings.TrimSpace(text.String())
+			}
+			return
+		}
+	}
+}
+
+// CSV is the codec of text/csv, it encodes the Table values with CRLF line endings. A document
+// is decoded from the header and the first row
+type CSV struct{}
+
+func (CSV) MediaTypes() []string {
+	return []string{"text/csv"}
+}
+
+func (CSV) Untyped() {}
+
+func (CSV) TablesOnly() {}
+
+func (CSV) Encode(w io.Writer, v any) (err error) {
+	table, ok := v.(Table)
+	if !ok {
+		err = fmt.Errorf("%w: %T in CSV", ErrUnsupportedValue, v)
+		return
+	}
+
+	header, rows := table.Table()
+
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = true
+	if err = writer.Write(header); err != nil {
+		return
+	}
+
+	if err = writer.WriteAll(rows); err != nil {
+		return
+	}
+
+	err = writer.Error()
+	return
+}
+
+func (CSV) Decode(r io.Reader, v any) (err error) {
+	doc, ok := v.(*map[string]any)
+	if !ok {
+		err = fmt.Errorf("%w: %T in CSV", ErrUnsupportedValue, v)
+		return
+	}
+
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return
+	}
+
+	row, err := reader.Read()
+	if err != nil {
+		return
+	}
+
+	*doc = make(map[string]any, len(header))
+	for index, column := range header {
+		if cell := strings.TrimSpace(row[index]); cell != "" {
+			(*doc)[strings.TrimPrefix(strings.TrimSpace(column), "\ufeff")] = cell
+		}
+	}
+	return
+}
@@ -0,0 +1,75 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testDocument is a value with a string, an integer, a float, a boolean and an ISO date
+type testDocument struct {
+	Name        string  `json:"name"`
+	Quantity    int     `json:"quantity"`
+	Price       float64 `json:"price"`
+	IsPublished bool    `json:"is_published"`
+	Expiration  string  `json:"expiration"`
+}
+
+func (d testDocument) Table() (header []string, rows [][]string) {
+	header = []string{"name", "quantity", "price", "is_published", "expiration"}
+	rows = [][]string{{d.Name, fmt.Sprint(d.Quantity), fmt.Sprint(d.Price), fmt.Sprint(d.IsPublished), d.Expiration}}
+	return
+}
+
+// TestCodecs_RoundTrip checks that every codec decodes the document it encodes, the values are
+// compared as text since each format has its own types
+func TestCodecs_RoundTrip(t *testing.T) {
+	value := testDocument{Name: "Product A", Quantity: 3, Price: 9.5, IsPublished: true, Expiration: "2030-02-02"}
+	want := map[string]string{"name": "Product A", "quantity": "3", "price": "9.5", "is_published": "true", "expiration": "2030-02-02"}
+
+	for _, c := range []Codec{JSON{}, XML{}, YAML{}, MessagePack{}, CSV{}} {
+		var buf bytes.Buffer
+		if err := c.Encode(&buf, value); err != nil {
+			t.Fatalf("%s: %v", c.MediaTypes()[0], err)
+		}
+
+		doc := map[string]any{}
+		if err := c.Decode(&buf, &doc); err != nil {
+			t.Fatalf("%s: %v", c.MediaTypes()[0], err)
+		}
+
+		if len(doc) != len(want) {
+			t.Errorf("%s: got document %v, want %v", c.MediaTypes()[0], doc, want)
+		}
+		for field, text := range want {
+			if got := fmt.Sprint(doc[field]); got != text {
+				t.Errorf("%s: got %s %q (%T), want %q", c.MediaTypes()[0], field, got, doc[field], text)
+			}
+		}
+	}
+}
+
+// TestYAML_DecodeDates checks that the dates written by hand are read as the strings written
+func TestYAML_DecodeDates(t *testing.T) {
+	doc := map[string]any{}
+	err := YAML{}.Decode(strings.NewReader("name: Product A\nexpiration: 2030-02-02\nitems:\n  - 2030-02-03T10:00:00Z\n"), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc["expiration"] != "2030-02-02" {
+		t.Fatalf("got expiration %v (%T), want the string 2030-02-02", doc["expiration"], doc["expiration"])
+	}
+	if items, _ := doc["items"].([]any); len(items) != 1 || items[0] != "2030-02-03T10:00:00Z" {
+		t.Fatalf("got items %v, want the timestamp as a string", doc["items"])
+	}
+}
+
+// TestCSV_EncodeValue checks that CSV only encodes tables
+func TestCSV_EncodeValue(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (CSV{}).Encode(&buf, map[string]any{"message": "deleted"}); err == nil || !strings.Contains(err.Error(), ErrUnsupportedValue.Error()) {
+		t.Fatalf("got error %v, want %v", err, ErrUnsupportedValue)
+	}
+}
@@ -0,0 +1,163 @@
+package idempotency
+
+import (
+	"container/list"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// StoreMemoryMaxEntries is the default number of keys kept by a StoreMemory, the oldest are evicted
+const StoreMemoryMaxEntries = 10000
+
+var (
+	// ErrKeyInProgress is returned when a request with the same key is still being processed
+	ErrKeyInProgress = errors.New("idempotency: a request with this key is in progress")
+	// ErrKeyMismatch is returned when a key is reused for a different request
+	ErrKeyMismatch = errors.New("idempotency: key was used for a different request")
+)
+
+// Response is the stored response of a request
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Key is an idempotency key, scoped to the principal that sent it
+type Key struct {
+	Principal string
+	Key       string
+}
+
+// Store keeps the responses of the requests by their idempotency key
+type Store interface {
+	// Begin reserves the key for a request with the fingerprint. If the key already has a response it
+	// is returned, for the same fingerprint only
+	Begin(key Key, fingerprint string) (response *Response, err error)
+	// Complete stores the response of the request that reserved the key
+	Complete(key Key, response Response) (err error)
+	// Abort releases the key, so the request can be retried
+	Abort(key Key) (err error)
+}
+
+type record struct {
+	key         Key
+	fingerprint string
+	// response is nil while the request is in progress
+	response  *Response
+	expiresAt time.Time
+	// element is the place of the record in the order the keys were reserved
+	element *list.Element
+}
+
+// StoreMemory is a Store that keeps the responses in memory until their TTL expires. Past MaxEntries
+// keys, the key reserved first is evicted
+type StoreMemory struct {
+	TTL        time.Duration
+	MaxEntries int
+
+	mu      sync.Mutex
+	records map[Key]*record
+	// order holds the records in the order their keys were reserved
+	order     *list.List
+	lastSweep time.Time
+	// now returns the current time, to expire the records
+	now func() time.Time
+}
+
+// NewStoreMemory creates a new StoreMemory that keeps StoreMemoryMaxEntries keys
+func NewStoreMemory(ttl time.Duration) *StoreMemory {
+	return &StoreMemory{
+		TTL:        ttl,
+		MaxEntries: StoreMemoryMaxEntries,
+		records:    make(map[Key]*record),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Begin reserves the key for a request with the fingerprint
+func (s *StoreMemory) Begin(key Key, fingerprint string) (response *Response, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if r, ok := s.records[key]; ok {
+		if now.Before(r.expiresAt) {
+			switch {
+			case r.fingerprint != fingerprint:
+				err = ErrKeyMismatch
+			case r.response == nil:
+				err = ErrKeyInProgress
+			default:
+				response = r.response
+			}
+			return
+		}
+		s.remove(r)
+	}
+
+	// the requests in progress are the last keys reserved, so the key evicted has its response
+	for s.MaxEntries > 0 && len(s.records) >= s.MaxEntries {
+		s.remove(s.order.Front().Value.(*record))
+	}
+
+	r := &record{
+		key:         key,
+		fingerprint: fingerprint,
+		expiresAt:   now.Add(s.TTL),
+	}
+	r.element = s.order.PushBack(r)
+	s.records[key] = r
+	return
+}
+
+// Complete stores the response of the request, its TTL starts now
+func (s *StoreMemory) Complete(key Key, response Response) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[key]
+	if !ok {
+		return
+	}
+
+	r.response = &response
+	r.expiresAt = s.now().Add(s.TTL)
+	return
+}
+
+// Abort releases the key
+func (s *StoreMemory) Abort(key Key) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.records[key]; ok {
+		s.remove(r)
+	}
+	return
+}
+
+// sweep deletes the expired records, at most once per minute, the caller must hold the lock
+func (s *StoreMemory) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for _, r := range s.records {
+		if !now.Before(r.expiresAt) {
+			s.remove(r)
+		}
+	}
+}
+
+// remove deletes a record, the caller must hold the lock
+func (s *StoreMemory) remove(r *record) {
+	delete(s.records, r.key)
+	s.order.Remove(r.element)
+}
@@ -0,0 +1,111 @@
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newTestStore returns a store with a clock that only moves when the test sets it
+func newTestStore(ttl time.Duration) (s *StoreMemory, now *time.Time) {
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = &clock
+
+	s = NewStoreMemory(ttl)
+	s.now = func() time.Time { return *now }
+	return
+}
+
+// TestStoreMemory_Begin checks that a completed key replays its response for the same fingerprint
+// only, that a key in progress is refused, and that an aborted or expired key can be reserved again
+func TestStoreMemory_Begin(t *testing.T) {
+	s, now := newTestStore(time.Hour)
+	key := Key{Principal: "ci", Key: "k1"}
+
+	if response, err := s.Begin(key, "a"); response != nil || err != nil {
+		t.Fatalf("got response %+v and error %v, want the key reserved", response, err)
+	}
+
+	// the retry of a request in progress is refused, whatever its fingerprint
+	if _, err := s.Begin(key, "a"); !errors.Is(err, ErrKeyInProgress) {
+		t.Fatalf("got error %v, want %v", err, ErrKeyInProgress)
+	}
+
+	// an aborted key is free again
+	if err := s.Abort(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Begin(key, "a"); err != nil {
+		t.Fatalf("got error %v after the abort, want the key reserved", err)
+	}
+
+	want := Response{Status: http.StatusCreated, Header: http.Header{"Location": {"/products/1"}}, Body: []byte(`{"id":1}`)}
+	if err := s.Complete(key, want); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := s.Begin(key, "a")
+	if err != nil || response == nil || response.Status != want.Status || string(response.Body) != string(want.Body) {
+		t.Fatalf("got response %+v and error %v, want %+v", response, err, want)
+	}
+
+	if _, err := s.Begin(key, "b"); !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("got error %v for another fingerprint, want %v", err, ErrKeyMismatch)
+	}
+
+	// the TTL of the response starts when it is completed
+	*now = now.Add(time.Hour)
+	if response, err := s.Begin(key, "b"); response != nil || err != nil {
+		t.Fatalf("got response %+v and error %v once expired, want the key reserved", response, err)
+	}
+}
+
+// TestStoreMemory_Principals checks that the same key sent by two principals, or a key that contains
+// the separator of another principal, are different keys
+func TestStoreMemory_Principals(t *testing.T) {
+	s, _ := newTestStore(time.Hour)
+
+	keys := []Key{
+		{Principal: "ci", Key: "k1"},
+		{Principal: "deploy", Key: "k1"},
+		{Principal: "a:b", Key: "c"},
+		{Principal: "a", Key: "b:c"},
+	}
+	for _, key := range keys {
+		if _, err := s.Begin(key, key.Principal); err != nil {
+			t.Fatalf("%+v: got error %v, want the key reserved", key, err)
+		}
+	}
+}
+
+// TestStoreMemory_MaxEntries checks that the key reserved first is evicted past MaxEntries
+func TestStoreMemory_MaxEntries(t *testing.T) {
+	s, _ := newTestStore(time.Hour)
+	s.MaxEntries = 2
+
+	keys := []Key{{Principal: "ci", Key: "k1"}, {Principal: "ci", Key: "k2"}, {Principal: "ci", Key: "k3"}}
+	for _, key := range keys {
+		if _, err := s.Begin(key, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Complete(key, Response{Status: http.StatusOK}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(s.records) != 2 || s.order.Len() != 2 {
+		t.Fatalf("got %d records and %d in order, want 2", len(s.records), s.order.Len())
+	}
+
+	// the first key was evicted and is reserved again, evicting the second one
+	if response, err := s.Begin(keys[0], "b"); response != nil || err != nil {
+		t.Fatalf("got response %+v and error %v for the evicted key, want it reserved", response, err)
+	}
+	if response, err := s.Begin(keys[2], "a"); response == nil || err != nil {
+		t.Fatalf("got response %+v and error %v for the last key, want it replayed", response, err)
+	}
+	if _, ok := s.records[keys[1]]; ok {
+		t.Fatalf("got the second key kept, want it evicted")
+	}
+}
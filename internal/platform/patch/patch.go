@@ -0,0 +1,143 @@
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	// ErrPatchInvalid is returned when the patch document is malformed
+	ErrPatchInvalid = errors.New("patch: invalid patch")
+	// ErrPatchPath is returned when a path of the patch does not exist in the document
+	ErrPatchPath = errors.New("patch: path not found")
+	// ErrPatchTestFailed is returned when a test operation does not match the document
+	ErrPatchTestFailed = errors.New("patch: test failed")
+)
+
+// Operations of a JSON Patch
+const (
+	OperationAdd     = "add"
+	OperationRemove  = "remove"
+	OperationReplace = "replace"
+	OperationTest    = "test"
+)
+
+// Operation is an operation of a JSON Patch (RFC 6902)
+type Operation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// Merge applies a JSON Merge Patch (RFC 7396) to a document: null members are removed,
+// objects are merged recursively and any other value replaces the member
+func Merge(doc, patch map[string]any) (merged map[string]any) {
+	merged = make(map[string]any, len(doc))
+	for key, value := range doc {
+		merged[key] = value
+	}
+
+	for key, value := range patch {
+		switch v := value.(type) {
+		case nil:
+			delete(merged, key)
+		case map[string]any:
+			target, _ := merged[key].(map[string]any)
+			merged[key] = Merge(target, v)
+		default:
+			merged[key] = v
+		}
+	}
+
+	return
+}
+
+// Apply applies the operations of a JSON Patch (RFC 6902) to a document, atomically: the
+// document is not modified and nothing is returned if an operation fails. Only objects
+// can be traversed by the paths
+func Apply(doc map[string]any, operations []Operation) (patched map[string]any, err error) {
+	result := clone(doc)
+	for index, operation := range operations {
+		if err = apply(result, operation); err != nil {
+			err = fmt.Errorf("%w (operation %d)", err, index)
+			return
+		}
+	}
+
+	patched = result
+	return
+}
+
+func apply(doc map[string]any, operation Operation) (err error) {
+	parent, key, err := resolve(doc, operation.Path)
+	if err != nil {
+		return
+	}
+
+	current, exists := parent[key]
+	switch operation.Op {
+	case OperationAdd:
+		parent[key] = operation.Value
+	case OperationRemove:
+		if !exists {
+			err = fmt.Errorf("%w: %s", ErrPatchPath, operation.Path)
+			return
+		}
+		delete(parent, key)
+	case OperationReplace:
+		if !exists {
+			err = fmt.Errorf("%w: %s", ErrPatchPath, operation.Path)
+			return
+		}
+		parent[key] = operation.Value
+	case OperationTest:
+		if !exists || !reflect.DeepEqual(current, operation.Value) {
+			err = fmt.Errorf("%w: %s", ErrPatchTestFailed, operation.Path)
+			return
+		}
+	default:
+		err = fmt.Errorf("%w: unsupported operation %q", ErrPatchInvalid, operation.Op)
+	}
+
+	return
+}
+
+// resolve returns the object holding the member the JSON Pointer (RFC 6901) refers to
+func resolve(doc map[string]any, pointer string) (parent map[string]any, key string, err error) {
+	if pointer == "" || !strings.HasPrefix(pointer, "/") {
+		err = fmt.Errorf("%w: path %q must be a JSON pointer to a member", ErrPatchInvalid, pointer)
+		return
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	parent = doc
+	for _, token := range tokens[:len(tokens)-1] {
+		next, ok := parent[token].(map[string]any)
+		if !ok {
+			err = fmt.Errorf("%w: %s", ErrPatchPath, pointer)
+			return
+		}
+		parent = next
+	}
+
+	key = tokens[len(tokens)-1]
+	return
+}
+
+// clone copies a document, the nested objects included
+func clone(doc map[string]any) (cloned map[string]any) {
+	cloned = make(map[string]any, len(doc))
+	for key, value := range doc {
+		if object, ok := value.(map[string]any); ok {
+			value = clone(object)
+		}
+		cloned[key] = value
+	}
+	return
+}
@@ -0,0 +1,200 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Index is an inverted index of texts identified by an int ID, it is safe for concurrent use
+type Index struct {
+	mu sync.RWMutex
+	// postings holds, for each term, how many times it appears in each document
+	postings map[string]map[int]int
+	// docs holds the terms of each document, to remove them from postings
+	docs map[int][]string
+	// terms holds every term sorted, to find the terms starting with a prefix
+	terms []string
+}
+
+// Result is a document matching a search
+type Result struct {
+	ID    int
+	Score float64
+}
+
+// NewIndex creates a new empty Index
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[int]int),
+		docs:     make(map[int][]string),
+	}
+}
+
+// Set indexes the texts of a document, replacing the previous texts of the same document
+func (ix *Index) Set(id int, texts ...string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+
+	var terms []string
+	for _, text := range texts {
+		terms = append(terms, Tokenize(text)...)
+	}
+
+	for _, term := range terms {
+		posting, ok := ix.postings[term]
+		if !ok {
+			posting = make(map[int]int)
+			ix.postings[term] = posting
+
+			i := sort.SearchStrings(ix.terms, term)
+			ix.terms = append(ix.terms, "")
+			copy(ix.terms[i+1:], ix.terms[i:])
+			ix.terms[i] = term
+		}
+		posting[id]++
+	}
+
+	ix.docs[id] = terms
+}
+
+// Remove deletes a document from the index
+func (ix *Index) Remove(id int) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+}
+
+func (ix *Index) remove(id int) {
+	for _, term := range ix.docs[id] {
+		posting := ix.postings[term]
+		delete(posting, id)
+		if len(posting) > 0 {
+			continue
+		}
+
+		delete(ix.postings, term)
+		if i := sort.SearchStrings(ix.terms, term); i < len(ix.terms) && ix.terms[i] == term {
+			ix.terms = append(ix.terms[:i], ix.terms[i+1:]...)
+		}
+	}
+
+	delete(ix.docs, id)
+}
+
+// Search returns the documents containing every term of the query, each query term
+// matches the terms starting with it. Results are sorted by relevance, exact matches
+// and rare terms weighting more than prefix matches and common terms
+func (ix *Index) Search(query string) (results []Result) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	queryTerms := Tokenize(query)
+	if len(queryTerms) == 0 {
+		return
+	}
+
+	total := float64(len(ix.docs))
+	var scores map[int]float64
+	for _, queryTerm := range queryTerms {
+		termScores := make(map[int]float64)
+
+		for i := sort.SearchStrings(ix.terms, queryTerm); i < len(ix.terms) && strings.HasPrefix(ix.terms[i], queryTerm); i++ {
+			term := ix.terms[i]
+			posting := ix.postings[term]
+
+			weight := math.Log(1 + total/float64(len(posting)))
+			if term != queryTerm {
+				weight *= float64(len(queryTerm)) / float64(len(term)) / 2
+			}
+
+			for id, frequency := range posting {
+				termScores[id] += weight * float64(frequency)
+			}
+		}
+
+		// every query term must match
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for id, score := range scores {
+			termScore, ok := termScores[id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			scores[id] = score + termScore
+		}
+	}
+
+	results = make([]Result, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, Result{ID: id, Score: score})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	return
+}
+
+// Tokenize splits a text into lower case terms without accents, separated by any
+// character that is not a letter or a digit
+func Tokenize(text string) (terms []string) {
+	var b strings.Builder
+	flush := func() {
+		if b.Len() > 0 {
+			terms = append(terms, b.String())
+			b.Reset()
+		}
+	}
+
+	for _, r := range text {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		b.WriteString(Fold(r))
+	}
+	flush()
+
+	return
+}
+
+// Fold returns the lower case form of a rune without its accent
+func Fold(r rune) string {
+	r = unicode.ToLower(r)
+	if folded, ok := accents[r]; ok {
+		return folded
+	}
+	return string(r)
+}
+
+var accents = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae",
+	'ç': "c", 'ć': "c", 'č': "c",
+	'ď': "d", 'đ': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ľ': "l", 'ĺ': "l",
+	'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'œ': "oe",
+	'ŕ': "r", 'ř': "r",
+	'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss",
+	'ť': "t", 'ţ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y",
+	'ź': "z", 'ż': "z", 'ž': "z",
+}
@@ -4,48 +4,81 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
-	ErrInvalidDay   = fmt.Errorf("Invalid day")
-	ErrInvalidMonth = fmt.Errorf("Invalid month")
-	ErrInvalidYear  = fmt.Errorf("Invalid year")
-	ErrInvalidDate  = fmt.Errorf("Invalid date")
+	ErrInvalidDay        = fmt.Errorf("Invalid day")
+	ErrInvalidMonth      = fmt.Errorf("Invalid month")
+	ErrInvalidYear       = fmt.Errorf("Invalid year")
+	ErrInvalidDate       = fmt.Errorf("Invalid date")
+	ErrInvalidDateFormat = fmt.Errorf("Invalid date format")
 )
 
-// ParseDate parses a date in the format dd/mm/yyyy and returns an error if the date is invalid
-func ParseDate(expiration string) (err error) {
-	date := strings.Split(expiration, "/")
+const (
+	// DateLayoutLegacy is the dd/mm/yyyy layout used by the legacy clients and the storage file
+	DateLayoutLegacy = "02/01/2006"
+	// DateLayoutISO is the ISO-8601 yyyy-mm-dd layout
+	DateLayoutISO = "2006-01-02"
+)
+
+// DateLayout returns the layout of a date format name, "dd/mm/yyyy" (the default) or "iso8601"
+func DateLayout(format string) (layout string, err error) {
+	switch strings.ToLower(format) {
+	case "", "dd/mm/yyyy", "legacy":
+		layout = DateLayoutLegacy
+	case "iso8601", "iso", "yyyy-mm-dd":
+		layout = DateLayoutISO
+	default:
+		err = fmt.Errorf("%w: %s", ErrInvalidDateFormat, format)
+	}
 
-	// Validate date format (dd/mm/yyyy)
-	if len(date) != 3 {
+	return
+}
+
+// ParseDate parses a date in the format dd/mm/yyyy or yyyy-mm-dd and returns an error if
+// the date does not exist in the calendar. The date is returned at midnight UTC
+func ParseDate(value string) (date time.Time, err error) {
+	var day, month, year string
+	switch {
+	case strings.Count(value, "/") == 2:
+		parts := strings.Split(value, "/")
+		day, month, year = parts[0], parts[1], parts[2]
+	case strings.Count(value, "-") == 2:
+		parts := strings.Split(value, "-")
+		year, month, day = parts[0], parts[1], parts[2]
+	default:
 		err = ErrInvalidDate
 		return
 	}
 
-	// Validate day
-	day, _ := strconv.Atoi(date[0])
-	if day < 1 || day > 31 {
-		err = ErrInvalidDay
-
+	// Validate year
+	y, err := strconv.Atoi(year)
+	if err != nil || y < 1999 || y > 2099 {
+		err = ErrInvalidYear
 		return
 	}
 
 	// Validate month
-	month, _ := strconv.Atoi(date[1])
-	if month < 1 || month > 12 {
+	m, err := strconv.Atoi(month)
+	if err != nil || m < 1 || m > 12 {
 		err = ErrInvalidMonth
-
 		return
 	}
 
-	// Validate year
-	year, err := strconv.Atoi(date[2])
-	if year < 1999 || year > 2099 {
-		err = ErrInvalidYear
-
+	// Validate day, against the length of the month
+	d, err := strconv.Atoi(day)
+	if err != nil || d < 1 || d > DaysIn(time.Month(m), y) {
+		err = ErrInvalidDay
 		return
 	}
 
+	date = time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
 	return
 }
+
+// DaysIn returns the number of days of a month
+func DaysIn(month time.Month, year int) int {
+	// day 0 of the next month is the last day of this month
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+		err   error
+	}{
+		{value: "15/12/2021", want: time.Date(2021, 12, 15, 0, 0, 0, 0, time.UTC)},
+		{value: "2021-12-15", want: time.Date(2021, 12, 15, 0, 0, 0, 0, time.UTC)},
+		{value: "5/1/2021", want: time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC)},
+		// the length of february
+		{value: "31/02/2021", err: ErrInvalidDay},
+		{value: "29/02/2021", err: ErrInvalidDay},
+		{value: "29/02/2020", want: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{value: "2020-02-29", want: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{value: "2100-02-29", err: ErrInvalidYear},
+		{value: "31/04/2021", err: ErrInvalidDay},
+		{value: "00/01/2021", err: ErrInvalidDay},
+		{value: "01/13/2021", err: ErrInvalidMonth},
+		{value: "01/00/2021", err: ErrInvalidMonth},
+		// the parts must be numbers
+		{value: "aa/01/2021", err: ErrInvalidDay},
+		{value: "01/jan/2021", err: ErrInvalidMonth},
+		{value: "01/01/year", err: ErrInvalidYear},
+		{value: "2021-01-1x", err: ErrInvalidDay},
+		// the years from 1999 to 2099
+		{value: "01/01/1999", want: time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "31/12/2099", want: time.Date(2099, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{value: "31/12/1998", err: ErrInvalidYear},
+		{value: "01/01/2100", err: ErrInvalidYear},
+		// the separators
+		{value: "", err: ErrInvalidDate},
+		{value: "15.12.2021", err: ErrInvalidDate},
+		{value: "15/12-2021", err: ErrInvalidDate},
+		{value: "15/12/2021/1", err: ErrInvalidDate},
+	}
+
+	for _, test := range tests {
+		got, err := ParseDate(test.value)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%q: got error %v, want %v", test.value, err, test.err)
+			continue
+		}
+
+		if !got.Equal(test.want) {
+			t.Errorf("%q: got date %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestDateLayout(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+		err    error
+	}{
+		{format: "", want: DateLayoutLegacy},
+		{format: "dd/mm/yyyy", want: DateLayoutLegacy},
+		{format: "LEGACY", want: DateLayoutLegacy},
+		{format: "iso8601", want: DateLayoutISO},
+		{format: "yyyy-mm-dd", want: DateLayoutISO},
+		{format: "mm/dd/yyyy", err: ErrInvalidDateFormat},
+		{format: "rfc3339", err: ErrInvalidDateFormat},
+	}
+
+	for _, test := range tests {
+		got, err := DateLayout(test.format)
+		if !errors.Is(err, test.err) || got != test.want {
+			t.Errorf("%q: got layout %q and error %v, want %q and %v", test.format, got, err, test.want, test.err)
+		}
+	}
+}
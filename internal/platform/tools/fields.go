@@ -2,6 +2,7 @@ package tools
 
 import (
 	"fmt"
+	"strings"
 )
 
 type FieldError struct {
@@ -13,16 +14,13 @@ func (e *FieldError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Field, e.Msg)
 }
 
-// CheckFieldExistance is a function that checks if the required fields exist in the fields map
-func CheckFieldExistance(fields map[string]any, requiredFields ...string) (err error) {
-	for _, field := range requiredFields {
-		if _, ok := fields[field]; !ok {
-			err = &FieldError{
-				Field: field,
-				Msg:   "field is required",
-			}
-			return
-		}
+// FieldErrors is a list of field errors, to report every invalid field at once
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fieldErr := range e {
+		msgs = append(msgs, fieldErr.Error())
 	}
-	return
-}
\ No newline at end of file
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,311 @@
+package validate
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+// Rule checks a value, it returns the message of the violation or an empty string if the value is valid.
+// A nil value is a missing field, which only Required rejects
+type Rule func(value any) (msg string)
+
+// Field is a field with the rules its value must follow
+type Field struct {
+	Name  string
+	Rules []Rule
+}
+
+// Schema is the list of the fields of a payload, in the order the errors are reported
+type Schema []Field
+
+// Validate checks every field of the values and returns all the violations as tools.FieldErrors,
+// the first violated rule of each field is reported
+func (s Schema) Validate(values map[string]any) (err error) {
+	var errs tools.FieldErrors
+	for _, field := range s {
+		if msg := field.check(values[field.Name]); msg != "" {
+			errs = append(errs, &tools.FieldError{Field: field.Name, Msg: msg})
+		}
+	}
+
+	if len(errs) > 0 {
+		err = errs
+	}
+	return
+}
+
+// ValidatePartial checks only the fields present in the values, as in a partial update, and reports
+// the fields unknown to the schema
+func (s Schema) ValidatePartial(values map[string]any) (err error) {
+	var errs tools.FieldErrors
+	for _, field := range s {
+		value, ok := values[field.Name]
+		if !ok {
+			continue
+		}
+
+		if value == nil {
+			errs = append(errs, &tools.FieldError{Field: field.Name, Msg: "can't be null"})
+			continue
+		}
+
+		if msg := field.check(value); msg != "" {
+			errs = append(errs, &tools.FieldError{Field: field.Name, Msg: msg})
+		}
+	}
+
+	errs = append(errs, s.unknown(values)...)
+
+	if len(errs) > 0 {
+		err = errs
+	}
+	return
+}
+
+// ValidateStrict checks every field of the values like Validate, and reports the fields unknown to the schema
+func (s Schema) ValidateStrict(values map[string]any) (err error) {
+	var errs tools.FieldErrors
+	if err = s.Validate(values); err != nil {
+		errs = err.(tools.FieldErrors)
+	}
+
+	errs = append(errs, s.unknown(values)...)
+
+	err = nil
+	if len(errs) > 0 {
+		err = errs
+	}
+	return
+}
+
+// unknown returns an error for each field of the values that is not in the schema, sorted by name
+func (s Schema) unknown(values map[string]any) (errs tools.FieldErrors) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if !s.Has(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		errs = append(errs, &tools.FieldError{Field: name, Msg: "unknown field"})
+	}
+	return
+}
+
+// Has reports whether the schema has a field with the name
+func (s Schema) Has(name string) bool {
+	for _, field := range s {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Field) check(value any) (msg string) {
+	for _, rule := range f.Rules {
+		if msg = rule(value); msg != "" {
+			return
+		}
+	}
+	return
+}
+
+// Required rejects the missing values
+func Required() Rule {
+	return func(value any) (msg string) {
+		if value == nil {
+			msg = "field is required"
+		}
+		return
+	}
+}
+
+// String only accepts strings
+func String() Rule {
+	return func(value any) (msg string) {
+		if _, ok := value.(string); value != nil && !ok {
+			msg = "must be a string"
+		}
+		return
+	}
+}
+
+// Bool only accepts booleans
+func Bool() Rule {
+	return func(value any) (msg string) {
+		if _, ok := value.(bool); value != nil && !ok {
+			msg = "must be a boolean"
+		}
+		return
+	}
+}
+
+// Number only accepts numbers
+func Number() Rule {
+	return func(value any) (msg string) {
+		if _, ok := number(value); value != nil && !ok {
+			msg = "must be a number"
+		}
+		return
+	}
+}
+
+// Integer only accepts numbers without a fractional part, JSON numbers are decoded as float64
+func Integer() Rule {
+	return func(value any) (msg string) {
+		if value == nil {
+			return
+		}
+
+		if n, ok := number(value); !ok || n != math.Trunc(n) {
+			msg = "must be an integer"
+		}
+		return
+	}
+}
+
+// Min rejects the numbers lower than min
+func Min(min float64) Rule {
+	return func(value any) (msg string) {
+		if n, ok := number(value); ok && n < min {
+			msg = fmt.Sprintf("must be greater than or equal to %v", min)
+		}
+		return
+	}
+}
+
+// Positive rejects the numbers lower than or equal to zero
+func Positive() Rule {
+	return func(value any) (msg string) {
+		if n, ok := number(value); ok && n <= 0 {
+			msg = "must be positive"
+		}
+		return
+	}
+}
+
+// Length rejects the strings whose number of characters is not between min and max
+func Length(min, max int) Rule {
+	return func(value any) (msg string) {
+		s, ok := value.(string)
+		if !ok {
+			return
+		}
+
+		if n := utf8.RuneCountInString(s); n < min || n > max {
+			msg = fmt.Sprintf("must have between %d and %d characters", min, max)
+		}
+		return
+	}
+}
+
+// Pattern rejects the strings that don't match the regular expression, described to the client by desc
+func Pattern(expr, desc string) Rule {
+	re := regexp.MustCompile(expr)
+	return func(value any) (msg string) {
+		if s, ok := value.(string); ok && !re.MatchString(s) {
+			msg = "must be " + desc
+		}
+		return
+	}
+}
+
+// Date accepts the dates parsed by tools.ParseDate, either as a string or a time.Time
+func Date() Rule {
+	return func(value any) (msg string) {
+		switch v := value.(type) {
+		case nil:
+		case time.Time:
+			if v.IsZero() {
+				msg = "must be a valid date"
+			}
+		case string:
+			if _, err := tools.ParseDate(v); err != nil {
+				msg = err.Error()
+			}
+		default:
+			msg = "must be a date with format dd/mm/yyyy or yyyy-mm-dd"
+		}
+		return
+	}
+}
+
+// URL accepts the absolute URLs with one of the schemes
+func URL(schemes ...string) Rule {
+	return func(value any) (msg string) {
+		s, ok := value.(string)
+		if !ok {
+			return
+		}
+
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" || !slices.Contains(schemes, u.Scheme) {
+			msg = "must be an absolute URL with scheme " + strings.Join(schemes, " or ")
+		}
+		return
+	}
+}
+
+// OneOf only accepts the strings in values
+func OneOf(values ...string) Rule {
+	return func(value any) (msg string) {
+		if s, ok := value.(string); ok && !slices.Contains(values, s) {
+			msg = "must be one of " + strings.Join(values, ", ")
+		}
+		return
+	}
+}
+
+// Each checks every item of a list with the rules, the first violation is reported with its index
+func Each(rules ...Rule) Rule {
+	return func(value any) (msg string) {
+		var items []any
+		switch v := value.(type) {
+		case nil:
+			return
+		case []any:
+			items = v
+		case []string:
+			for _, item := range v {
+				items = append(items, item)
+			}
+		case []int:
+			for _, item := range v {
+				items = append(items, item)
+			}
+		default:
+			return "must be a list"
+		}
+
+		for index, item := range items {
+			if msg = (Field{Rules: rules}).check(item); msg != "" {
+				msg = fmt.Sprintf("item %d %s", index, msg)
+				return
+			}
+		}
+		return
+	}
+}
+
+// number converts the numeric values into a float64
+func number(value any) (n float64, ok bool) {
+	switch v := value.(type) {
+	case float64:
+		n, ok = v, true
+	case int:
+		n, ok = float64(v), true
+	}
+	return
+}
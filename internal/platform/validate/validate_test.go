@@ -0,0 +1,125 @@
+package validate
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+var testSchema = Schema{
+	{Name: "name", Rules: []Rule{Required(), String(), Length(1, 10)}},
+	{Name: "quantity", Rules: []Rule{Required(), Integer(), Min(0)}},
+	{Name: "price", Rules: []Rule{Required(), Number(), Positive()}},
+	{Name: "expiration", Rules: []Rule{Date()}},
+	{Name: "ids", Rules: []Rule{Each(Integer(), Positive())}},
+	{Name: "events", Rules: []Rule{Each(String(), OneOf("created", "deleted"))}},
+}
+
+// fieldErrors returns the field and the message of every error, as "field: message"
+func fieldErrors(t *testing.T, err error) (got []string) {
+	if err == nil {
+		return
+	}
+
+	var errs tools.FieldErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got error %v, want tools.FieldErrors", err)
+	}
+	for _, fieldErr := range errs {
+		got = append(got, fieldErr.Error())
+	}
+	return
+}
+
+func TestSchema_ValidateStrict(t *testing.T) {
+	valid := func(fields map[string]any) map[string]any {
+		values := map[string]any{"name": "Product", "quantity": float64(3), "price": 9.5}
+		for name, value := range fields {
+			values[name] = value
+		}
+		return values
+	}
+
+	tests := []struct {
+		name   string
+		values map[string]any
+		want   []string
+	}{
+		{name: "valid", values: valid(map[string]any{"expiration": "01/01/2030", "ids": []any{float64(1), float64(2)}})},
+		{name: "quantity as a JSON number", values: valid(map[string]any{"quantity": float64(0)})},
+		{
+			name:   "missing fields",
+			values: map[string]any{},
+			want:   []string{"name: field is required", "quantity: field is required", "price: field is required"},
+		},
+		{
+			name:   "unknown fields sorted after the schema",
+			values: valid(map[string]any{"zeta": 1, "alpha": true}),
+			want:   []string{"alpha: unknown field", "zeta: unknown field"},
+		},
+		{
+			name:   "type mismatches",
+			values: map[string]any{"name": float64(1), "quantity": "3", "price": true, "expiration": float64(2030)},
+			want: []string{
+				"name: must be a string",
+				"quantity: must be an integer",
+				"price: must be a number",
+				"expiration: must be a date with format dd/mm/yyyy or yyyy-mm-dd",
+			},
+		},
+		{
+			name:   "first violated rule of each field",
+			values: valid(map[string]any{"name": "", "quantity": 1.5, "price": float64(-1)}),
+			want:   []string{"name: must have between 1 and 10 characters", "quantity: must be an integer", "price: must be positive"},
+		},
+		{
+			name:   "nested items reported with their index",
+			values: valid(map[string]any{"ids": []any{float64(1), float64(0)}, "events": []any{"created", "updated"}}),
+			want:   []string{"ids: item 1 must be positive", "events: item 1 must be one of created, deleted"},
+		},
+		{
+			name:   "nested items of the wrong type",
+			values: valid(map[string]any{"ids": []any{"1"}, "events": "created"}),
+			want:   []string{"ids: item 0 must be an integer", "events: must be a list"},
+		},
+		{
+			name:   "violations and unknown fields at once",
+			values: map[string]any{"name": "Product", "quantity": float64(-1), "price": float64(1), "extra": nil},
+			want:   []string{"quantity: must be greater than or equal to 0", "extra: unknown field"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fieldErrors(t, testSchema.ValidateStrict(tt.values)); !slices.Equal(got, tt.want) {
+				t.Fatalf("got errors %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchema_ValidatePartial(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]any
+		want   []string
+	}{
+		{name: "missing fields are not required", values: map[string]any{"price": float64(2)}},
+		{name: "null fields", values: map[string]any{"name": nil}, want: []string{"name: can't be null"}},
+		{
+			name:   "type mismatches and unknown fields",
+			values: map[string]any{"quantity": "many", "id": float64(1)},
+			want:   []string{"quantity: must be an integer", "id: unknown field"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fieldErrors(t, testSchema.ValidatePartial(tt.values)); !slices.Equal(got, tt.want) {
+				t.Fatalf("got errors %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package internal
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 type Product struct {
 	ID          int
@@ -8,8 +11,20 @@ type Product struct {
 	Quantity    int
 	CodeValue   string
 	IsPublished bool
-	Expiration  string
+	Expiration  time.Time
 	Price       float64
+	// Version starts at 1 and is incremented on every write
+	Version int
+	// DeletedAt and DeletedBy are set while the product is in the trash
+	DeletedAt time.Time
+	DeletedBy string
+}
+
+// ProductDeletion is when and by whom a product was deleted, it is kept in the trash until it is
+// restored or purged
+type ProductDeletion struct {
+	At time.Time
+	By string
 }
 
 var (
@@ -18,4 +33,6 @@ var (
 	ErrProductInternal     = errors.New("Product can't be processed")
 	ErrProductsEmpty       = errors.New("Products are empty")
 	ErrProductInvalidField = errors.New("Product field is invalid")
+	// ErrProductCondition is returned when the stored product does not meet the condition of a write
+	ErrProductCondition = errors.New("Product does not meet the condition")
 )
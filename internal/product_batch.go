@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Types of the writes of a batch
+const (
+	ProductWriteCreate = "create"
+	ProductWriteUpsert = "upsert"
+	ProductWritePatch  = "patch"
+	ProductWriteDelete = "delete"
+	// ProductWritePurge removes a stored product or a product of the trash for good, it is written by
+	// the imports that replace the catalog and is not accepted by the batch endpoint
+	ProductWritePurge = "purge"
+)
+
+var (
+	// ErrProductBatchAborted is the result of the writes of an atomic batch that were not applied
+	// because another write of the batch failed
+	ErrProductBatchAborted = errors.New("Product batch aborted")
+	// ErrProductBatchInvalid is returned when the type of a write is unknown
+	ErrProductBatchInvalid = errors.New("Product batch is invalid")
+)
+
+// ProductWrite is a write of a batch
+type ProductWrite struct {
+	Type string
+	// ID is the product patched, deleted or purged
+	ID int
+	// Product is the product created or upserted
+	Product Product
+	// Patch is the patch of the product, applied to the stored product
+	Patch ProductPatch
+	// Condition is the condition of the upserts, patches and deletes
+	Condition ProductCondition
+	// Deletion marks the product moved to the trash by a delete
+	Deletion ProductDeletion
+}
+
+// ProductWriteResult is the result of a write of a batch, the written product or the error
+type ProductWriteResult struct {
+	Product Product
+	Err     error
+}
+
+// ProductBatchError is returned when a write of an atomic batch fails
+type ProductBatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *ProductBatchError) Error() string {
+	return fmt.Sprintf("%s: write %d: %v", ErrProductBatchAborted, e.Index, e.Err)
+}
+
+func (e *ProductBatchError) Unwrap() error {
+	return e.Err
+}
+
+// NewProductBatchResults returns the results of a batch that failed, with the error of the failed
+// write and ErrProductBatchAborted for the others. An error that is not a ProductBatchError failed
+// the whole batch, so it is the error of every write
+func NewProductBatchResults(size int, err error) (results []ProductWriteResult) {
+	var batchErr *ProductBatchError
+	isBatchErr := errors.As(err, &batchErr)
+
+	results = make([]ProductWriteResult, size)
+	for index := range results {
+		results[index].Err = ErrProductBatchAborted
+		if !isBatchErr && err != nil {
+			results[index].Err = err
+		}
+	}
+
+	if isBatchErr && batchErr.Index < size {
+		results[batchErr.Index].Err = batchErr.Err
+	}
+	return
+}
@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"slices"
+)
+
+// ProductCondition is the condition a stored product must meet to be written, the repositories check
+// it atomically with the write (compare-and-swap). The zero value is always met
+type ProductCondition struct {
+	// IfMatch are the versions the product must have one of, when not nil
+	IfMatch []int
+	// IfNoneMatch are the versions the product must not have
+	IfNoneMatch []int
+	// Exists requires the product to exist, and Absent requires it not to exist
+	Exists bool
+	Absent bool
+}
+
+// Met tells if the stored product meets the condition, stored is nil when the product does not exist
+func (c ProductCondition) Met(stored *Product) bool {
+	if stored == nil {
+		return !c.Exists && c.IfMatch == nil
+	}
+
+	if c.Absent || slices.Contains(c.IfNoneMatch, stored.Version) {
+		return false
+	}
+
+	return c.IfMatch == nil || slices.Contains(c.IfMatch, stored.Version)
+}
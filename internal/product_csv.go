@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+// ProductCSVColumns are the columns of an exported CSV, named as the JSON fields. The id
+// column, and the version column of the CSV responses, are ignored by the imports
+var ProductCSVColumns = []string{"id", "name", "quantity", "code_value", "is_published", "expiration", "price"}
+
+// ProductCSVIgnore is the field of the mapped columns that are not imported
+const ProductCSVIgnore = "-"
+
+// bom is the byte order mark of UTF-8, Excel needs it to read the accents of a CSV
+const bom = "\ufeff"
+
+var (
+	// ErrProductCSV is returned when a CSV can't be read or its header is invalid
+	ErrProductCSV = errors.New("Product CSV is invalid")
+)
+
+// ProductCSVMapping maps the columns of a CSV to the product fields, the columns that are
+// not mapped must be named as a product field
+type ProductCSVMapping map[string]string
+
+// ParseProductCSVMapping parses a mapping written as column=field pairs, separated by commas
+func ParseProductCSVMapping(values []string) (mapping ProductCSVMapping, err error) {
+	mapping = make(ProductCSVMapping)
+	for _, value := range values {
+		for _, pair := range strings.Split(value, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+
+			column, field, ok := strings.Cut(pair, "=")
+			field = strings.TrimSpace(field)
+			if !ok || field != ProductCSVIgnore && !ProductSchema.Has(field) {
+				err = &tools.FieldError{Field: "mapping", Msg: fmt.Sprintf("%q must be column=field, with a product field or %s", pair, ProductCSVIgnore)}
+				return
+			}
+
+			mapping[columnKey(column)] = field
+		}
+	}
+	return
+}
+
+// ProductRow is a product read from a line of an import, or the errors of its fields
+type ProductRow struct {
+	Line    int
+	Product Product
+	Err     error
+}
+
+// ReadProductsCSV reads the products of a CSV with a header line. The cells are validated as the
+// fields of a JSON product, so every invalid field of a row is reported
+func ReadProductsCSV(r io.Reader, mapping ProductCSVMapping) (rows []ProductRow, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrProductCSV, err)
+		return
+	}
+
+	// the fields of the columns, the columns of the id and the ignored ones have no field
+	fields := make([]string, len(header))
+	var unknown []string
+	for index, column := range header {
+		if index == 0 {
+			column = strings.TrimPrefix(column, bom)
+		}
+
+		field, ok := mapping[columnKey(column)]
+		if !ok {
+			field = columnKey(column)
+		}
+
+		switch {
+		case field == ProductCSVIgnore, field == "id", field == "version":
+		case ProductSchema.Has(field) && !slices.Contains(fields, field):
+			fields[index] = field
+		default:
+			unknown = append(unknown, column)
+		}
+	}
+
+	if len(unknown) > 0 {
+		err = &tools.FieldError{Field: "columns", Msg: fmt.Sprintf("unknown or repeated columns %s, map them to a product field or %s", strings.Join(unknown, ", "), ProductCSVIgnore)}
+		return
+	}
+
+	for {
+		record, readErr := reader.Read()
+		if readErr == io.EOF {
+			break
+		}
+
+		// a malformed line is an error of its row, the reader goes on with the next line
+		var row ProductRow
+		var parseErr *csv.ParseError
+		switch {
+		case errors.As(readErr, &parseErr):
+			row.Line, row.Err = parseErr.StartLine, fmt.Errorf("%w: %v", ErrProductCSV, parseErr.Err)
+		case readErr != nil:
+			err = fmt.Errorf("%w: %v", ErrProductCSV, readErr)
+			return
+		case len(record) != len(header):
+			row.Line, _ = reader.FieldPos(0)
+			row.Err = fmt.Errorf("%w: the line has %d cells and the header %d", ErrProductCSV, len(record), len(header))
+		default:
+			row.Line, _ = reader.FieldPos(0)
+			row.Product, row.Err = productFromDocument(0, productCSVDocument(fields, record))
+		}
+
+		rows = append(rows, row)
+	}
+	return
+}
+
+// productCSVDocument converts the cells of a row into a product document
+func productCSVDocument(fields, record []string) (doc map[string]any) {
+	doc = make(map[string]any)
+	for index, field := range fields {
+		if cell := strings.TrimSpace(record[index]); field != "" && cell != "" {
+			doc[field] = cell
+		}
+	}
+
+	ProductDocumentFromText(doc)
+	return
+}
+
+// ProductDocumentFromText converts the strings of the numeric and boolean fields of a document
+// read from a text format such as CSV. The strings that are not numbers or booleans are kept, so
+// the validation reports them
+func ProductDocumentFromText(doc map[string]any) {
+	for field, value := range doc {
+		text, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		switch field {
+		case "quantity", "price":
+			if n, err := strconv.ParseFloat(strings.TrimSpace(text), 64); err == nil {
+				doc[field] = n
+			}
+		case "is_published":
+			if b, err := strconv.ParseBool(strings.TrimSpace(text)); err == nil {
+				doc[field] = b
+			}
+		}
+	}
+}
+
+// WriteProductsCSV writes the products with the ProductCSVColumns header and CRLF line endings.
+// The excel flavor starts with a byte order mark, so Excel reads it as UTF-8
+func WriteProductsCSV(w io.Writer, products []Product, dateLayout string, excel bool) (err error) {
+	if excel {
+		if _, err = io.WriteString(w, bom); err != nil {
+			return
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = true
+
+	if err = writer.Write(ProductCSVColumns); err != nil {
+		return
+	}
+
+	for _, product := range products {
+		err = writer.Write([]string{
+			strconv.Itoa(product.ID),
+			product.Name,
+			strconv.Itoa(product.Quantity),
+			product.CodeValue,
+			strconv.FormatBool(product.IsPublished),
+			product.Expiration.Format(dateLayout),
+			strconv.FormatFloat(product.Price, 'f', -1, 64),
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	writer.Flush()
+	err = writer.Error()
+	return
+}
+
+// columnKey normalizes the name of a column, so "Code Value" maps to code_value
+func columnKey(column string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(column)), " ", "_")
+}
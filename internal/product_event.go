@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"errors"
+	"time"
+)
+
+// Types of the events of the products
+const (
+	ProductEventCreated = "created"
+	ProductEventUpdated = "updated"
+	ProductEventDeleted = "deleted"
+	// ProductEventRestored is a product moved back from the trash
+	ProductEventRestored = "restored"
+)
+
+var (
+	// ErrProductEventsExpired is returned when the events after a sequence are no longer in the log,
+	// the catalog must be read again before following the events
+	ErrProductEventsExpired = errors.New("Product events expired")
+)
+
+// ProductEvent is a change made on a product. Deleted products have their ID only
+type ProductEvent struct {
+	// Sequence is assigned by the log, it is incremented on every event
+	Sequence int64
+	Type     string
+	Product  Product
+	Time     time.Time
+}
+
+// ProductEventQuery selects the events followed by Watch
+type ProductEventQuery struct {
+	// After is the sequence of the last event received, 0 follows only the new events
+	After int64
+	// IDs are the products whose events are followed, all the products when empty
+	IDs []int
+}
+
+// Match reports whether the event is of a product of the query
+func (q ProductEventQuery) Match(event ProductEvent) bool {
+	if len(q.IDs) == 0 {
+		return true
+	}
+
+	for _, id := range q.IDs {
+		if id == event.Product.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// ProductEventLog keeps the last events of the products in order
+type ProductEventLog interface {
+	// Append assigns the next sequences to the events and adds them to the log. The events that
+	// can't be added must not be skipped silently, Since answers ErrProductEventsExpired after them
+	Append(events []ProductEvent) (err error)
+	// Since returns the events after the sequence. ErrProductEventsExpired is returned when some of
+	// them were already dropped from the log, or the sequence is ahead of the log
+	Since(after int64) (events []ProductEvent, err error)
+	// Last returns the sequence of the last event, 0 when the log is empty
+	Last() (sequence int64)
+	// Changed returns a channel that is closed on the next Append
+	Changed() <-chan struct{}
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Strategies of an import
+const (
+	// ProductImportInsert creates the products, a code value that already exists is an error
+	ProductImportInsert = "insert"
+	// ProductImportUpsert updates the products with the same code value and creates the others
+	ProductImportUpsert = "upsert"
+	// ProductImportReplace deletes every product and creates the imported ones, the products whose
+	// code values are imported are purged
+	ProductImportReplace = "replace"
+)
+
+// ProductImportStrategies are the strategies of an import
+var ProductImportStrategies = []string{ProductImportInsert, ProductImportUpsert, ProductImportReplace}
+
+var (
+	// ErrProductImportInvalid is returned when an import has invalid rows, nothing is imported
+	ErrProductImportInvalid = errors.New("Product import is invalid")
+)
+
+// ProductImport is a list of products to import with its strategy
+type ProductImport struct {
+	Rows     []ProductRow
+	Strategy string
+	// DryRun checks the rows and counts the changes without applying them
+	DryRun bool
+}
+
+// ProductImportReport is the result of an import, the changes applied or that would be applied
+// by a dry run, and the errors of the rows
+type ProductImportReport struct {
+	Created int
+	Updated int
+	Deleted int
+	Errors  ProductRowErrors
+}
+
+// ProductRowError is the error of a line of an import
+type ProductRowError struct {
+	Line int
+	Err  error
+}
+
+func (e *ProductRowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *ProductRowError) Unwrap() error {
+	return e.Err
+}
+
+// ProductRowErrors are the errors of the rows of an import
+type ProductRowErrors []*ProductRowError
+
+func (e ProductRowErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%s: %s", ErrProductImportInvalid, strings.Join(msgs, "; "))
+}
+
+func (e ProductRowErrors) Unwrap() error {
+	return ErrProductImportInvalid
+}
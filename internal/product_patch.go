@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/edwinbm5/go-product-web/internal/platform/patch"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+// ProductPatch modifies the fields of a product, the patched product is not validated yet
+type ProductPatch interface {
+	Apply(product Product) (patched Product, err error)
+}
+
+// ProductMergePatch is a JSON Merge Patch (RFC 7396) of a product, with its fields named as in the JSON payloads
+type ProductMergePatch map[string]any
+
+// Apply merges the patch into the product, the fields of the patch are validated first so a field
+// removed with null is reported as such
+func (m ProductMergePatch) Apply(product Product) (patched Product, err error) {
+	if err = ProductSchema.ValidatePartial(m); err != nil {
+		return
+	}
+
+	patched, err = productFromDocument(product.ID, patch.Merge(productDocument(product), m))
+	return
+}
+
+// ProductJSONPatch is a JSON Patch (RFC 6902) of a product. The expiration is compared as a date by
+// the test operations, whatever its format
+type ProductJSONPatch []patch.Operation
+
+// Apply applies the operations to the product, all of them or none
+func (j ProductJSONPatch) Apply(product Product) (patched Product, err error) {
+	operations := make([]patch.Operation, len(j))
+	for index, operation := range j {
+		if value, ok := operation.Value.(string); ok && operation.Path == "/expiration" {
+			if date, err := tools.ParseDate(value); err == nil {
+				operation.Value = date.Format(tools.DateLayoutISO)
+			}
+		}
+		operations[index] = operation
+	}
+
+	doc, err := patch.Apply(productDocument(product), operations)
+	if err != nil {
+		return
+	}
+
+	patched, err = productFromDocument(product.ID, doc)
+	return
+}
+
+// productDocument converts a product into the JSON document patched by the clients
+func productDocument(product Product) map[string]any {
+	return map[string]any{
+		"name":         product.Name,
+		"quantity":     float64(product.Quantity),
+		"code_value":   product.CodeValue,
+		"is_published": product.IsPublished,
+		"expiration":   product.Expiration.Format(tools.DateLayoutISO),
+		"price":        product.Price,
+	}
+}
+
+// productFromDocument converts a patched document back into a product, the document
+// must follow the ProductSchema without unknown fields
+func productFromDocument(id int, doc map[string]any) (product Product, err error) {
+	if err = ProductSchema.ValidateStrict(doc); err != nil {
+		return
+	}
+
+	expiration, err := tools.ParseDate(doc["expiration"].(string))
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrProductInvalidField, err)
+		return
+	}
+
+	isPublished, _ := doc["is_published"].(bool)
+	product = Product{
+		ID:          id,
+		Name:        doc["name"].(string),
+		Quantity:    int(doc["quantity"].(float64)),
+		CodeValue:   doc["code_value"].(string),
+		IsPublished: isPublished,
+		Expiration:  expiration,
+		Price:       doc["price"].(float64),
+	}
+	return
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+func TestProductMergePatch_Apply(t *testing.T) {
+	product := Product{ID: 1, Name: "Product", Quantity: 1, CodeValue: "P1", Expiration: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), Price: 10}
+
+	patched, err := ProductMergePatch{"quantity": float64(5), "price": 2.5}.Apply(product)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.Quantity != 5 || patched.Price != 2.5 || patched.Name != product.Name {
+		t.Fatalf("got %+v", patched)
+	}
+
+	// every invalid field of the patch is reported, the nulls and the unknown fields included
+	_, err = ProductMergePatch{"name": nil, "quantity": -1.5, "price": "free", "color": "red"}.Apply(product)
+
+	var errs tools.FieldErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got error %v, want field errors", err)
+	}
+
+	want := map[string]string{
+		"name":     "can't be null",
+		"quantity": "must be an integer",
+		"price":    "must be a number",
+		"color":    "unknown field",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got errors %v, want %d of them", errs, len(want))
+	}
+	for _, fieldErr := range errs {
+		if want[fieldErr.Field] != fieldErr.Msg {
+			t.Errorf("got %s: %s, want %s", fieldErr.Field, fieldErr.Msg, want[fieldErr.Field])
+		}
+	}
+}
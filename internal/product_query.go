@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProductSort is a field to sort the products by
+type ProductSort struct {
+	Field string
+	Desc  bool
+}
+
+// ProductSortFields are the fields the products can be sorted by
+var ProductSortFields = []string{"id", "name", "quantity", "code_value", "is_published", "expiration", "price"}
+
+// ProductQuery holds the filters, sorting and pagination used to list products.
+// Nil filters are not applied and a PageSize lower than 1 returns every product
+type ProductQuery struct {
+	Page     int
+	PageSize int
+	Sort     []ProductSort
+
+	IsPublished   *bool
+	PriceGte      *float64
+	PriceLte      *float64
+	ExpiresBefore *time.Time
+	ExpiresAfter  *time.Time
+}
+
+// Match reports whether the product passes all the filters of the query
+func (q ProductQuery) Match(product Product) bool {
+	if q.IsPublished != nil && product.IsPublished != *q.IsPublished {
+		return false
+	}
+
+	if q.PriceGte != nil && product.Price < *q.PriceGte {
+		return false
+	}
+
+	if q.PriceLte != nil && product.Price > *q.PriceLte {
+		return false
+	}
+
+	if q.ExpiresBefore != nil && !product.Expiration.Before(*q.ExpiresBefore) {
+		return false
+	}
+
+	if q.ExpiresAfter != nil && !product.Expiration.After(*q.ExpiresAfter) {
+		return false
+	}
+
+	return true
+}
+
+// Apply sorts the products that already passed the filters and returns the requested page,
+// total is the number of products before paginating
+func (q ProductQuery) Apply(products []Product) (page []Product, total int) {
+	total = len(products)
+
+	if len(q.Sort) > 0 {
+		sort.SliceStable(products, func(i, j int) bool {
+			for _, s := range q.Sort {
+				c := compareProducts(products[i], products[j], s.Field)
+				if c == 0 {
+					continue
+				}
+				if s.Desc {
+					return c > 0
+				}
+				return c < 0
+			}
+			return false
+		})
+	}
+
+	if q.PageSize < 1 {
+		page = products
+		return
+	}
+
+	pageNumber := q.Page
+	if pageNumber < 1 {
+		pageNumber = 1
+	}
+
+	// the page is compared before multiplying so a huge page number can't overflow the offset
+	if total == 0 || pageNumber-1 > (total-1)/q.PageSize {
+		page = []Product{}
+		return
+	}
+
+	start := (pageNumber - 1) * q.PageSize
+	end := total
+	if total-start > q.PageSize {
+		end = start + q.PageSize
+	}
+
+	page = products[start:end]
+	return
+}
+
+// compareProducts compares a field of two products, returning -1, 0 or 1
+func compareProducts(a, b Product, field string) int {
+	switch field {
+	case "id":
+		return compareOrdered(a.ID, b.ID)
+	case "name":
+		return strings.Compare(a.Name, b.Name)
+	case "quantity":
+		return compareOrdered(a.Quantity, b.Quantity)
+	case "code_value":
+		return strings.Compare(a.CodeValue, b.CodeValue)
+	case "is_published":
+		switch {
+		case a.IsPublished == b.IsPublished:
+			return 0
+		case a.IsPublished:
+			return 1
+		default:
+			return -1
+		}
+	case "expiration":
+		return a.Expiration.Compare(b.Expiration)
+	case "price":
+		return compareOrdered(a.Price, b.Price)
+	default:
+		return 0
+	}
+}
+
+func compareOrdered[T int | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"math"
+	"testing"
+)
+
+func TestProductQuery_Apply(t *testing.T) {
+	products := make([]Product, 10)
+	for index := range products {
+		products[index].ID = index + 1
+	}
+
+	cases := []struct {
+		name      string
+		query     ProductQuery
+		wantFirst int
+		wantLen   int
+	}{
+		{name: "first page", query: ProductQuery{Page: 1, PageSize: 4}, wantFirst: 1, wantLen: 4},
+		{name: "last page", query: ProductQuery{Page: 3, PageSize: 4}, wantFirst: 9, wantLen: 2},
+		{name: "past the end", query: ProductQuery{Page: 4, PageSize: 4}},
+		{name: "offset overflow", query: ProductQuery{Page: 4611686018427387904, PageSize: 4}},
+		{name: "max page", query: ProductQuery{Page: math.MaxInt, PageSize: math.MaxInt}},
+		{name: "no pagination", query: ProductQuery{}, wantFirst: 1, wantLen: 10},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			page, total := c.query.Apply(append([]Product(nil), products...))
+			if total != len(products) {
+				t.Errorf("got total %d, want %d", total, len(products))
+			}
+			if len(page) != c.wantLen {
+				t.Fatalf("got %d products, want %d", len(page), c.wantLen)
+			}
+			if c.wantLen > 0 && page[0].ID != c.wantFirst {
+				t.Errorf("got first ID %d, want %d", page[0].ID, c.wantFirst)
+			}
+		})
+	}
+}
@@ -1,10 +1,31 @@
 package internal
 
+import "time"
+
 type ProductRepository interface {
-	GetAll() (products []Product, err error)
+	GetAll(query ProductQuery) (products []Product, total int, err error)
+	Search(text string, query ProductQuery) (products []Product, total int, err error)
 	GetByID(id int) (product Product, err error)
+	// Cursor returns up to limit products that match the filters of the query, in the order of their
+	// IDs and after the product with the ID after. A catalog is read in chunks by passing the ID of the
+	// last product read, 0 starts from the first product
+	Cursor(after int, limit int, query ProductQuery) (products []Product, err error)
 	Create(product *Product) (err error)
-	UpdateAndCreate(product *Product) (err error)
-	Update(id int, fields map[string]any) (err error)
-	Delete(id int) (err error)
+	// UpdateAndCreate, Update and Delete only write the product if it meets the condition, or else return
+	// ErrProductCondition. The version of the written product is incremented
+	UpdateAndCreate(product *Product, condition ProductCondition) (err error)
+	Update(product *Product, condition ProductCondition) (err error)
+	// Delete moves the product to the trash, marked with the deletion. The products of the trash are
+	// left out of the other reads and writes, their code values are taken only if configured so
+	Delete(id int, condition ProductCondition, deletion ProductDeletion) (err error)
+	// Batch applies all the writes or none of them, in order. A failed write is returned as a
+	// ProductBatchError. The written products are returned, deleted products as they are in the trash
+	Batch(writes []ProductWrite) (products []Product, err error)
+	// GetTrash returns the products of the trash that match the query
+	GetTrash(query ProductQuery) (products []Product, total int, err error)
+	// Restore moves a product back from the trash, ErrProductDuplicated is returned when its code
+	// value was taken meanwhile. The version of the restored product is incremented
+	Restore(id int) (product Product, err error)
+	// Purge removes for good the products of the trash deleted before the time
+	Purge(before time.Time) (products []Product, err error)
 }
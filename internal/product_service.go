@@ -1,10 +1,47 @@
 package internal
 
+import (
+	"context"
+	"time"
+)
+
+// ProductService is the business logic of the products, ctx carries the request scoped
+// values such as the principal performing the operation
 type ProductService interface {
-	GetAll() (products []Product, err error)
-	GetByID(id int) (product Product, err error)
-	Create(product *Product) (err error)
-	UpdateAndCreate(product *Product) (err error)
-	Update(id int, fields map[string]any) (err error)
-	Delete(id int) (err error)
+	GetAll(ctx context.Context, query ProductQuery) (products []Product, total int, err error)
+	Search(ctx context.Context, text string, query ProductQuery) (products []Product, total int, err error)
+	// GetExpiring and GetExpired return the page of the products of the query with the groups by days
+	// remaining of all of them, from a single read of the products
+	GetExpiring(ctx context.Context, within time.Duration, query ProductQuery) (products []Product, groups []ExpirationGroup, total int, err error)
+	GetExpired(ctx context.Context, query ProductQuery) (products []Product, groups []ExpirationGroup, total int, err error)
+	GetByID(ctx context.Context, id int) (product Product, err error)
+	// Stream calls fn with every product that matches the filters of the query, in the order of their
+	// IDs, until fn fails or ctx is done. The products are read in chunks, so the memory used does not
+	// grow with the catalog
+	Stream(ctx context.Context, query ProductQuery, fn func(product Product) error) (err error)
+	// Watch calls fn with the events of the query, first the ones after query.After and then the new
+	// ones as they are published, until fn fails or ctx is done. fn is called at once, and with no
+	// events every heartbeat while there are no new events
+	Watch(ctx context.Context, query ProductEventQuery, fn func(events []ProductEvent) error) (err error)
+	Create(ctx context.Context, product *Product) (err error)
+	UpdateAndCreate(ctx context.Context, product *Product, condition ProductCondition) (err error)
+	Update(ctx context.Context, id int, patch ProductPatch, condition ProductCondition) (product Product, err error)
+	// Delete moves the product to the trash, marked with the principal of ctx
+	Delete(ctx context.Context, id int, condition ProductCondition) (err error)
+	// GetTrash returns the deleted products that match the query, until they are purged
+	GetTrash(ctx context.Context, query ProductQuery) (products []Product, total int, err error)
+	Restore(ctx context.Context, id int) (product Product, err error)
+	// Batch applies the writes and returns the result of each of them. An atomic batch applies all
+	// the writes or none, and returns the ProductBatchError of the failed write
+	Batch(ctx context.Context, writes []ProductWrite, atomic bool) (results []ProductWriteResult, err error)
+	// Import applies all the rows of an import or none. Invalid rows are returned as ProductRowErrors,
+	// and a dry run reports them without an error
+	Import(ctx context.Context, imp ProductImport) (report ProductImportReport, err error)
+}
+
+// ExpirationGroup is a group of products with the same days remaining until they expire,
+// expired products have negative days remaining
+type ExpirationGroup struct {
+	DaysRemaining int
+	Products      []Product
 }
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"github.com/edwinbm5/go-product-web/internal/platform/validate"
+)
+
+// ProductSchema are the rules of the product fields, named as in the JSON payloads
+var ProductSchema = validate.Schema{
+	{Name: "name", Rules: []validate.Rule{validate.Required(), validate.String(), validate.Length(1, 100)}},
+	{Name: "quantity", Rules: []validate.Rule{validate.Required(), validate.Integer(), validate.Min(0)}},
+	{Name: "code_value", Rules: []validate.Rule{validate.Required(), validate.String(), validate.Length(1, 32),
+		validate.Pattern(`^[A-Za-z0-9_-]+$`, "letters, digits, dashes or underscores")}},
+	{Name: "is_published", Rules: []validate.Rule{validate.Bool()}},
+	{Name: "expiration", Rules: []validate.Rule{validate.Required(), validate.Date()}},
+	{Name: "price", Rules: []validate.Rule{validate.Required(), validate.Number(), validate.Positive()}},
+}
+
+// ValidateProduct checks every field of a product against the ProductSchema
+func ValidateProduct(product Product) (err error) {
+	err = ProductSchema.Validate(map[string]any{
+		"name":         product.Name,
+		"quantity":     product.Quantity,
+		"code_value":   product.CodeValue,
+		"is_published": product.IsPublished,
+		"expiration":   product.Expiration,
+		"price":        product.Price,
+	})
+	return
+}
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
+
+// ProductEvents is a repository that publishes every change made on another repository into an
+// event log. The events are appended in the same order as the changes
+type ProductEvents struct {
+	rp  internal.ProductRepository
+	log internal.ProductEventLog
+
+	mu sync.Mutex
+	// now returns the time of the events
+	now func() time.Time
+}
+
+// NewProductEvents creates a new ProductEvents
+func NewProductEvents(rp internal.ProductRepository, log internal.ProductEventLog) *ProductEvents {
+	return &ProductEvents{
+		rp:  rp,
+		log: log,
+		now: time.Now,
+	}
+}
+
+// GetAll returns the products in the database that match the query
+func (p *ProductEvents) GetAll(query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	products, total, err = p.rp.GetAll(query)
+	return
+}
+
+// Search returns the products whose name or code value match the text
+func (p *ProductEvents) Search(text string, query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	products, total, err = p.rp.Search(text, query)
+	return
+}
+
+// GetByID returns a product by its ID
+func (p *ProductEvents) GetByID(id int) (product internal.Product, err error) {
+	product, err = p.rp.GetByID(id)
+	return
+}
+
+// Cursor returns up to limit products that match the query after the product with the ID after
+func (p *ProductEvents) Cursor(after int, limit int, query internal.ProductQuery) (products []internal.Product, err error) {
+	products, err = p.rp.Cursor(after, limit, query)
+	return
+}
+
+// Creates a new product in the database
+func (p *ProductEvents) Create(product *internal.Product) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err = p.rp.Create(product); err != nil {
+		return
+	}
+
+	err = p.publish(internal.ProductEvent{Type: internal.ProductEventCreated, Product: *product})
+	return
+}
+
+// Updates a product in the database or creates it if it does not exist
+func (p *ProductEvents) UpdateAndCreate(product *internal.Product, condition internal.ProductCondition) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	exists, err := p.exists(product.ID)
+	if err != nil {
+		return
+	}
+
+	if err = p.rp.UpdateAndCreate(product, condition); err != nil {
+		return
+	}
+
+	stored, err := p.rp.GetByID(product.ID)
+	if err != nil {
+		return
+	}
+
+	event := internal.ProductEvent{Type: internal.ProductEventCreated, Product: stored}
+	if exists {
+		event.Type = internal.ProductEventUpdated
+	}
+
+	err = p.publish(event)
+	return
+}
+
+// Updates a product in the database
+func (p *ProductEvents) Update(product *internal.Product, condition internal.ProductCondition) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err = p.rp.Update(product, condition); err != nil {
+		return
+	}
+
+	stored, err := p.rp.GetByID(product.ID)
+	if err != nil {
+		return
+	}
+
+	err = p.publish(internal.ProductEvent{Type: internal.ProductEventUpdated, Product: stored})
+	return
+}
+
+// Delete moves a product to the trash
+func (p *ProductEvents) Delete(id int, condition internal.ProductCondition, deletion internal.ProductDeletion) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err = p.rp.Delete(id, condition, deletion); err != nil {
+		return
+	}
+
+	err = p.publish(internal.ProductEvent{Type: internal.ProductEventDeleted, Product: internal.Product{ID: id}})
+	return
+}
+
+// GetTrash returns the products of the trash that match the query
+func (p *ProductEvents) GetTrash(query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	products, total, err = p.rp.GetTrash(query)
+	return
+}
+
+// Restore moves a product back from the trash
+func (p *ProductEvents) Restore(id int) (product internal.Product, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if product, err = p.rp.Restore(id); err != nil {
+		return
+	}
+
+	err = p.publish(internal.ProductEvent{Type: internal.ProductEventRestored, Product: product})
+	return
+}
+
+// Purge removes the products of the trash deleted before the time, their deletion was already published
+func (p *ProductEvents) Purge(before time.Time) (products []internal.Product, err error) {
+	products, err = p.rp.Purge(before)
+	return
+}
+
+// Batch applies all the writes or none of them, and publishes an event per write
+func (p *ProductEvents) Batch(writes []internal.ProductWrite) (products []internal.Product, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// an upsert creates the product unless it was stored before it or written by the batch
+	exists := make(map[int]bool)
+	for _, write := range writes {
+		if write.Type != internal.ProductWriteUpsert {
+			continue
+		}
+
+		if _, ok := exists[write.Product.ID]; ok {
+			continue
+		}
+
+		if exists[write.Product.ID], err = p.exists(write.Product.ID); err != nil {
+			return
+		}
+	}
+
+	if products, err = p.rp.Batch(writes); err != nil {
+		return
+	}
+
+	// the purge of a product of the trash has no event, its deletion was already published
+	events := make([]internal.ProductEvent, 0, len(writes))
+	for index, write := range writes {
+		event := internal.ProductEvent{Type: internal.ProductEventUpdated, Product: products[index]}
+		switch {
+		case write.Type == internal.ProductWriteCreate:
+			event.Type = internal.ProductEventCreated
+		case write.Type == internal.ProductWritePurge && !products[index].DeletedAt.IsZero():
+			continue
+		case write.Type == internal.ProductWriteDelete || write.Type == internal.ProductWritePurge:
+			event = internal.ProductEvent{Type: internal.ProductEventDeleted, Product: internal.Product{ID: products[index].ID}}
+		case write.Type == internal.ProductWriteUpsert && !exists[write.Product.ID]:
+			event.Type = internal.ProductEventCreated
+		}
+		exists[products[index].ID] = event.Type != internal.ProductEventDeleted
+		events = append(events, event)
+	}
+
+	err = p.publish(events...)
+	return
+}
+
+// exists reports whether the product is stored
+func (p *ProductEvents) exists(id int) (ok bool, err error) {
+	_, err = p.rp.GetByID(id)
+	switch {
+	case err == nil:
+		ok = true
+	case errors.Is(err, internal.ErrProductNotFound):
+		err = nil
+	}
+	return
+}
+
+// publish appends the events into the log. A write is reported as made even if its events are
+// lost, the log then tells the clients that follow it to read the products again
+func (p *ProductEvents) publish(events ...internal.ProductEvent) (err error) {
+	now := p.now()
+	for index := range events {
+		events[index].Time = now
+	}
+
+	if appendErr := p.log.Append(events); appendErr != nil {
+		log.Printf("events: %d events not published: %v", len(events), appendErr)
+	}
+	return
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/storage"
+)
+
+// failingEventLog is an event log whose appends fail
+type failingEventLog struct {
+	*storage.EventLog
+}
+
+func (l failingEventLog) Append(events []internal.ProductEvent) (err error) {
+	return errors.New("disk full")
+}
+
+// TestProductEvents_PublishFailure checks that a write is reported as made when its events can't
+// be published, since it is already committed
+func TestProductEvents_PublishFailure(t *testing.T) {
+	rp := NewProductEvents(NewProductMap(nil, 0), failingEventLog{storage.NewEventLog("", 10)})
+
+	product := newTestProduct("A")
+	if err := rp.Create(&product); err != nil {
+		t.Fatalf("got error %v, want the create reported as made", err)
+	}
+
+	if _, err := rp.GetByID(product.ID); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,601 @@
+package repository
+
+import (
+	"cmp"
+	"container/list"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/platform/search"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+// ProductMap is a repository that stores products indexed by ID and CodeValue, keeping
+// the order of their IDs for listing. It is safe for concurrent use
+type ProductMap struct {
+	mu sync.RWMutex
+	// db indexes the elements of order by product ID
+	db map[int]*list.Element
+	// codes indexes the product IDs by CodeValue
+	codes map[string]int
+	// order holds the products in the order of their IDs
+	order  *list.List
+	lastID int
+	// index is the full-text index of the name and code value of the products
+	index *search.Index
+	// trash holds the deleted products in the order they were deleted
+	trash *list.List
+	// trashIDs indexes the elements of trash by product ID
+	trashIDs map[int]*list.Element
+	// trashCodes counts the products of trash by CodeValue, deleted products may share one
+	trashCodes map[string]int
+	// undo undoes the last write, nil once it is undone
+	undo func()
+
+	// ReserveTrashedCodes keeps the code values of the products of the trash taken until they are purged
+	ReserveTrashedCodes bool
+}
+
+// NewProductMap creates a new ProductMap, the products of db with a deletion are put in the trash
+// and the others are kept in the order of their IDs
+func NewProductMap(db []internal.Product, lastID int) *ProductMap {
+	p := &ProductMap{
+		db:         make(map[int]*list.Element, len(db)),
+		codes:      make(map[string]int, len(db)),
+		order:      list.New(),
+		lastID:     lastID,
+		index:      search.NewIndex(),
+		trash:      list.New(),
+		trashIDs:   make(map[int]*list.Element),
+		trashCodes: make(map[string]int),
+	}
+
+	for _, pr := range sortedByID(db) {
+		if !pr.DeletedAt.IsZero() {
+			p.trashInsert(pr, 0)
+			continue
+		}
+
+		p.db[pr.ID] = p.order.PushBack(pr)
+		p.codes[pr.CodeValue] = pr.ID
+		p.index.Set(pr.ID, pr.Name, pr.CodeValue)
+	}
+
+	return p
+}
+
+// GetAll returns the products in the database that match the query
+func (p *ProductMap) GetAll(query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.order.Len() == 0 {
+		err = internal.ErrProductsEmpty
+		return
+	}
+
+	products = make([]internal.Product, 0, p.order.Len())
+	for e := p.order.Front(); e != nil; e = e.Next() {
+		if pr := e.Value.(internal.Product); query.Match(pr) {
+			products = append(products, pr)
+		}
+	}
+
+	products, total = query.Apply(products)
+
+	return
+}
+
+// Search returns the products whose name or code value match the text, sorted by relevance
+// unless the query sets another order
+func (p *ProductMap) Search(text string, query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	products = make([]internal.Product, 0)
+	for _, result := range p.index.Search(text) {
+		e, ok := p.db[result.ID]
+		if !ok {
+			continue
+		}
+
+		if pr := e.Value.(internal.Product); query.Match(pr) {
+			products = append(products, pr)
+		}
+	}
+
+	products, total = query.Apply(products)
+
+	return
+}
+
+// GetByID returns a product by its ID
+func (p *ProductMap) GetByID(id int) (product internal.Product, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	e, ok := p.db[id]
+	if !ok {
+		err = internal.ErrProductNotFound
+		err = fmt.Errorf("%w: The product with ID %d does not exist", err, id)
+		return
+	}
+
+	product = e.Value.(internal.Product)
+	return
+}
+
+// Cursor returns up to limit products that match the query after the product with the ID after,
+// the list keeps the products in the order of their IDs since they are created with increasing IDs
+func (p *ProductMap) Cursor(after int, limit int, query internal.ProductQuery) (products []internal.Product, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	// the cursor resumes after its product, or after the lower IDs if its product was deleted
+	e := p.order.Front()
+	if cursor, ok := p.db[after]; ok {
+		e = cursor.Next()
+	} else {
+		for e != nil && e.Value.(internal.Product).ID <= after {
+			e = e.Next()
+		}
+	}
+
+	products = make([]internal.Product, 0, limit)
+	for ; e != nil && len(products) < limit; e = e.Next() {
+		if pr := e.Value.(internal.Product); query.Match(pr) {
+			products = append(products, pr)
+		}
+	}
+
+	return
+}
+
+// Creates a new product in the database
+func (p *ProductMap) Create(product *internal.Product) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	*product, p.undo, err = p.write(internal.ProductWrite{Type: internal.ProductWriteCreate, Product: *product})
+	return
+}
+
+// create adds the product to the database, the caller must hold the write lock
+func (p *ProductMap) create(product *internal.Product) (err error) {
+	if p.taken(product.CodeValue, 0) {
+		err = internal.ErrProductDuplicated
+		err = fmt.Errorf("%w: The Code value %s already exists", err, product.CodeValue)
+		return
+	}
+
+	if product.Expiration.IsZero() {
+		err = fmt.Errorf("%w: The expiration date is required", tools.ErrInvalidDate)
+		return
+	}
+
+	p.lastID++
+	product.ID = p.lastID
+	product.Version = 1
+
+	p.db[product.ID] = p.order.PushBack(*product)
+	p.codes[product.CodeValue] = product.ID
+	p.index.Set(product.ID, product.Name, product.CodeValue)
+
+	return
+}
+
+// Updates a product in the database or creates it if it does not exist
+func (p *ProductMap) UpdateAndCreate(product *internal.Product, condition internal.ProductCondition) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	*product, p.undo, err = p.write(internal.ProductWrite{Type: internal.ProductWriteUpsert, Product: *product, Condition: condition})
+	return
+}
+
+// Updates a product in the database, all its fields are replaced
+func (p *ProductMap) Update(product *internal.Product, condition internal.ProductCondition) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// a failed write leaves nothing to undo
+	p.undo = nil
+
+	e, ok := p.db[product.ID]
+	if !ok {
+		err = internal.ErrProductNotFound
+		err = fmt.Errorf("%w: The product with ID %d does not exist", err, product.ID)
+		return
+	}
+
+	old := e.Value.(internal.Product)
+	if err = p.update(e, product, condition); err != nil {
+		return
+	}
+
+	p.undo = p.undoUpdate(old, *product)
+	return
+}
+
+// update replaces the product of the element, the caller must hold the write lock
+func (p *ProductMap) update(e *list.Element, product *internal.Product, condition internal.ProductCondition) (err error) {
+	old := e.Value.(internal.Product)
+	if !condition.Met(&old) {
+		err = fmt.Errorf("%w: The product with ID %d is at version %d", internal.ErrProductCondition, old.ID, old.Version)
+		return
+	}
+
+	if p.taken(product.CodeValue, product.ID) {
+		err = internal.ErrProductDuplicated
+		err = fmt.Errorf("%w: The Code value %s already exists", err, product.CodeValue)
+		return
+	}
+
+	if product.Expiration.IsZero() {
+		err = fmt.Errorf("%w: The expiration date is required", tools.ErrInvalidDate)
+		return
+	}
+
+	product.Version = old.Version + 1
+
+	delete(p.codes, old.CodeValue)
+	p.codes[product.CodeValue] = product.ID
+	e.Value = *product
+	p.index.Set(product.ID, product.Name, product.CodeValue)
+
+	return
+}
+
+// Delete moves a product to the trash
+func (p *ProductMap) Delete(id int, condition internal.ProductCondition, deletion internal.ProductDeletion) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, p.undo, err = p.write(internal.ProductWrite{Type: internal.ProductWriteDelete, ID: id, Condition: condition, Deletion: deletion})
+	return
+}
+
+// GetTrash returns the products of the trash that match the query, in the order they were deleted
+func (p *ProductMap) GetTrash(query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	products = make([]internal.Product, 0, p.trash.Len())
+	for e := p.trash.Front(); e != nil; e = e.Next() {
+		if pr := e.Value.(internal.Product); query.Match(pr) {
+			products = append(products, pr)
+		}
+	}
+
+	products, total = query.Apply(products)
+
+	return
+}
+
+// Restore moves a product back from the trash, in the place of its ID
+func (p *ProductMap) Restore(id int) (product internal.Product, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.undo = nil
+
+	e, ok := p.trashIDs[id]
+	if !ok {
+		err = internal.ErrProductNotFound
+		err = fmt.Errorf("%w: The product with ID %d is not in the trash", err, id)
+		return
+	}
+
+	old := e.Value.(internal.Product)
+	product = old
+	if owner, ok := p.codes[product.CodeValue]; ok {
+		err = internal.ErrProductDuplicated
+		err = fmt.Errorf("%w: The Code value %s was taken by the product with ID %d", err, product.CodeValue, owner)
+		return
+	}
+
+	next := p.trashRemove(e)
+	product.DeletedAt, product.DeletedBy = time.Time{}, ""
+	product.Version++
+
+	p.insert(product)
+
+	p.undo = func() {
+		p.remove(p.db[id])
+		p.trashInsert(old, next)
+	}
+
+	return
+}
+
+// Purge removes the products of the trash deleted before the time
+func (p *ProductMap) Purge(before time.Time) (products []internal.Product, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// the undo puts back each product before the one that followed it, in reverse order
+	var next []int
+	for e := p.trash.Front(); e != nil; {
+		pr := e.Value.(internal.Product)
+		if !pr.DeletedAt.Before(before) {
+			e = e.Next()
+			continue
+		}
+
+		products = append(products, pr)
+		following := e.Next()
+		next = append(next, p.trashRemove(e))
+		e = following
+	}
+
+	p.undo = func() {
+		for i := len(products) - 1; i >= 0; i-- {
+			p.trashInsert(products[i], next[i])
+		}
+	}
+	return
+}
+
+// Undo undoes the last write made on the repository, the writes before it can't be undone. It lets a
+// write be dropped when it can't be saved, the caller must make sure no other write was made since
+func (p *ProductMap) Undo() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.undo != nil {
+		p.undo()
+		p.undo = nil
+	}
+}
+
+// LastID returns the last ID given to a product, the deleted ones included
+func (p *ProductMap) LastID() (id int) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	id = p.lastID
+	return
+}
+
+// Batch applies all the writes or none of them, the applied writes are undone when a write fails
+func (p *ProductMap) Batch(writes []internal.ProductWrite) (products []internal.Product, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.undo = nil
+
+	var undo []func()
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		products = nil
+	}()
+
+	products = make([]internal.Product, 0, len(writes))
+	for index, write := range writes {
+		product, undoWrite, writeErr := p.write(write)
+		if writeErr != nil {
+			err = &internal.ProductBatchError{Index: index, Err: writeErr}
+			return
+		}
+
+		undo = append(undo, undoWrite)
+		products = append(products, product)
+	}
+
+	p.undo = func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+
+	return
+}
+
+// write applies a write of a batch and returns the function that undoes it, the caller must hold the write lock
+func (p *ProductMap) write(write internal.ProductWrite) (product internal.Product, undo func(), err error) {
+	id := write.ID
+	if write.Type == internal.ProductWriteUpsert {
+		id = write.Product.ID
+	}
+
+	// old is the product before the write, nil if it does not exist
+	var old *internal.Product
+	e, exists := p.db[id]
+	if exists {
+		stored := e.Value.(internal.Product)
+		old = &stored
+	}
+
+	switch write.Type {
+	case internal.ProductWriteCreate, internal.ProductWriteUpsert:
+		product = write.Product
+		if write.Type == internal.ProductWriteUpsert && exists {
+			if err = p.update(e, &product, write.Condition); err != nil {
+				return
+			}
+			undo = p.undoUpdate(*old, product)
+			return
+		}
+
+		if !write.Condition.Met(nil) {
+			err = fmt.Errorf("%w: The product with ID %d does not exist", internal.ErrProductCondition, id)
+			return
+		}
+
+		lastID := p.lastID
+		if err = p.create(&product); err != nil {
+			return
+		}
+
+		undo = func() {
+			p.remove(p.db[product.ID])
+			p.lastID = lastID
+		}
+	case internal.ProductWritePatch:
+		if !exists {
+			err = fmt.Errorf("%w: The product with ID %d does not exist", internal.ErrProductNotFound, id)
+			return
+		}
+
+		if product, err = write.Patch.Apply(*old); err != nil {
+			return
+		}
+
+		if err = p.update(e, &product, write.Condition); err != nil {
+			return
+		}
+		undo = p.undoUpdate(*old, product)
+	case internal.ProductWriteDelete:
+		if !exists {
+			err = fmt.Errorf("%w: The product with ID %d does not exist", internal.ErrProductNotFound, id)
+			return
+		}
+
+		if !write.Condition.Met(old) {
+			err = fmt.Errorf("%w: The product with ID %d is at version %d", internal.ErrProductCondition, id, old.Version)
+			return
+		}
+
+		// the product is the last product of the trash when the writes are undone in reverse order
+		p.remove(e)
+		product = trashed(*old, write.Deletion)
+		p.trashInsert(product, 0)
+
+		undo = func() {
+			p.trashRemove(p.trashIDs[id])
+			p.insert(*old)
+		}
+	case internal.ProductWritePurge:
+		if exists {
+			if !write.Condition.Met(old) {
+				err = fmt.Errorf("%w: The product with ID %d is at version %d", internal.ErrProductCondition, id, old.Version)
+				return
+			}
+
+			p.remove(e)
+			product = *old
+			undo = func() { p.insert(*old) }
+			return
+		}
+
+		te, ok := p.trashIDs[id]
+		if !ok {
+			err = fmt.Errorf("%w: The product with ID %d does not exist", internal.ErrProductNotFound, id)
+			return
+		}
+
+		product = te.Value.(internal.Product)
+		next := p.trashRemove(te)
+		undo = func() { p.trashInsert(product, next) }
+	default:
+		err = fmt.Errorf("%w: unknown write %q", internal.ErrProductBatchInvalid, write.Type)
+	}
+
+	return
+}
+
+// undoUpdate returns the function that puts back the old product, its element is looked up when undone
+// since a later write of a batch may have deleted it and the undo of the delete inserted a new one
+func (p *ProductMap) undoUpdate(old, product internal.Product) func() {
+	return func() {
+		delete(p.codes, product.CodeValue)
+		p.codes[old.CodeValue] = old.ID
+		p.db[old.ID].Value = old
+		p.index.Set(old.ID, old.Name, old.CodeValue)
+	}
+}
+
+// taken reports whether the code value belongs to a product other than the one with the ID, or
+// to a product of the trash when their code values are reserved. The caller must hold the lock
+func (p *ProductMap) taken(code string, id int) bool {
+	if owner, ok := p.codes[code]; ok {
+		return owner != id
+	}
+
+	return p.ReserveTrashedCodes && p.trashCodes[code] > 0
+}
+
+// trashInsert puts a product in the trash before the product with the ID next, or at the end when
+// next is 0. The caller must hold the write lock
+func (p *ProductMap) trashInsert(product internal.Product, next int) {
+	if e, ok := p.trashIDs[next]; ok {
+		p.trashIDs[product.ID] = p.trash.InsertBefore(product, e)
+	} else {
+		p.trashIDs[product.ID] = p.trash.PushBack(product)
+	}
+	p.trashCodes[product.CodeValue]++
+}
+
+// trashRemove takes the product of the element out of the trash and returns the ID of the product
+// that followed it, or 0 if it was the last one. An ID rather than the element, since the undo of a
+// later write of a batch may put that product back in a new element. The caller must hold the write lock
+func (p *ProductMap) trashRemove(e *list.Element) (next int) {
+	if following := e.Next(); following != nil {
+		next = following.Value.(internal.Product).ID
+	}
+
+	product := p.trash.Remove(e).(internal.Product)
+	delete(p.trashIDs, product.ID)
+	if p.trashCodes[product.CodeValue]--; p.trashCodes[product.CodeValue] == 0 {
+		delete(p.trashCodes, product.CodeValue)
+	}
+	return
+}
+
+// insert adds a product in the place of its ID, the list is kept in the order of the IDs so the
+// product goes after the last lower ID. The caller must hold the write lock
+func (p *ProductMap) insert(product internal.Product) {
+	e := p.order.Back()
+	for e != nil && e.Value.(internal.Product).ID > product.ID {
+		e = e.Prev()
+	}
+	if e != nil {
+		p.db[product.ID] = p.order.InsertAfter(product, e)
+	} else {
+		p.db[product.ID] = p.order.PushFront(product)
+	}
+	p.codes[product.CodeValue] = product.ID
+	p.index.Set(product.ID, product.Name, product.CodeValue)
+}
+
+// remove deletes the product of the element, the caller must hold the write lock
+func (p *ProductMap) remove(e *list.Element) {
+	product := e.Value.(internal.Product)
+	delete(p.codes, product.CodeValue)
+	delete(p.db, product.ID)
+	p.order.Remove(e)
+	p.index.Remove(product.ID)
+}
+
+// sortedByID returns the products in the order of their IDs, a stored product restored from the
+// trash may be loaded after products with higher IDs. The products of the trash keep their order
+func sortedByID(db []internal.Product) (products []internal.Product) {
+	products = make([]internal.Product, 0, len(db))
+	var trash []internal.Product
+	for _, pr := range db {
+		if !pr.DeletedAt.IsZero() {
+			trash = append(trash, pr)
+			continue
+		}
+		products = append(products, pr)
+	}
+
+	slices.SortFunc(products, func(a, b internal.Product) int { return cmp.Compare(a.ID, b.ID) })
+	products = append(products, trash...)
+	return
+}
+
+// trashed returns the product marked with the deletion
+func trashed(product internal.Product, deletion internal.ProductDeletion) internal.Product {
+	product.DeletedAt, product.DeletedBy = deletion.At, deletion.By
+	return product
+}
@@ -0,0 +1,338 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
+
+// benchmarkSize is the number of products stored before the benchmarks start
+const benchmarkSize = 10000
+
+// newBenchmarkProducts returns the products of a database with IDs from 1 to n
+func newBenchmarkProducts(n int) (db []internal.Product) {
+	db = make([]internal.Product, 0, n)
+	for id := 1; id <= n; id++ {
+		product := newTestProduct(fmt.Sprintf("P%d", id))
+		product.ID = id
+		product.Version = 1
+		db = append(db, product)
+	}
+	return
+}
+
+func benchmarkGetByID(b *testing.B, rp internal.ProductRepository) {
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rp.GetByID(i%benchmarkSize + 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkCreate creates products with new code values, every create checks the code value is not taken
+func benchmarkCreate(b *testing.B, rp internal.ProductRepository) {
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		product := newTestProduct(fmt.Sprintf("N%d", i))
+		if err := rp.Create(&product); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkUpdate(b *testing.B, rp internal.ProductRepository) {
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := i%benchmarkSize + 1
+		product := newTestProduct(fmt.Sprintf("P%d", id))
+		product.ID = id
+		product.Quantity = i
+		if err := rp.Update(&product, internal.ProductCondition{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkDelete deletes a product and creates another one while the timer is stopped, so the
+// database keeps its size
+func benchmarkDelete(b *testing.B, rp internal.ProductRepository) {
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		product := newTestProduct(fmt.Sprintf("D%d", i))
+		if err := rp.Create(&product); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+
+		if err := rp.Delete(product.ID, internal.ProductCondition{}, internal.ProductDeletion{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProductMap_GetByID(b *testing.B) {
+	benchmarkGetByID(b, NewProductMap(newBenchmarkProducts(benchmarkSize), benchmarkSize))
+}
+
+func BenchmarkProductSlice_GetByID(b *testing.B) {
+	benchmarkGetByID(b, NewProductSlice(newBenchmarkProducts(benchmarkSize), benchmarkSize))
+}
+
+func BenchmarkProductMap_Create(b *testing.B) {
+	benchmarkCreate(b, NewProductMap(newBenchmarkProducts(benchmarkSize), benchmarkSize))
+}
+
+func BenchmarkProductSlice_Create(b *testing.B) {
+	benchmarkCreate(b, NewProductSlice(newBenchmarkProducts(benchmarkSize), benchmarkSize))
+}
+
+func BenchmarkProductMap_Update(b *testing.B) {
+	benchmarkUpdate(b, NewProductMap(newBenchmarkProducts(benchmarkSize), benchmarkSize))
+}
+
+func BenchmarkProductSlice_Update(b *testing.B) {
+	benchmarkUpdate(b, NewProductSlice(newBenchmarkProducts(benchmarkSize), benchmarkSize))
+}
+
+func BenchmarkProductMap_Delete(b *testing.B) {
+	benchmarkDelete(b, NewProductMap(newBenchmarkProducts(benchmarkSize), benchmarkSize))
+}
+
+func BenchmarkProductSlice_Delete(b *testing.B) {
+	benchmarkDelete(b, NewProductSlice(newBenchmarkProducts(benchmarkSize), benchmarkSize))
+}
+
+// TestProductMap_BatchRollback checks that a failed batch leaves the products as they were, in the
+// order of their IDs, when it deletes neighbour products and patches a deleted one before
+func TestProductMap_BatchRollback(t *testing.T) {
+	rp := NewProductMap(newBenchmarkProducts(4), 4)
+	before, _, err := rp.GetAll(internal.ProductQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = rp.Batch([]internal.ProductWrite{
+		{Type: internal.ProductWritePatch, ID: 2, Patch: internal.ProductMergePatch{"name": "Patched"}},
+		{Type: internal.ProductWriteDelete, ID: 3},
+		{Type: internal.ProductWriteDelete, ID: 2},
+		{Type: internal.ProductWriteCreate, Product: newTestProduct("P5")},
+		{Type: internal.ProductWriteDelete, ID: 99},
+	})
+	if !errors.Is(err, internal.ErrProductNotFound) {
+		t.Fatalf("got error %v, want %v", err, internal.ErrProductNotFound)
+	}
+
+	after, _, err := rp.GetAll(internal.ProductQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(before, after) {
+		t.Fatalf("got products %+v, want %+v", after, before)
+	}
+
+	if trash, _, _ := rp.GetTrash(internal.ProductQuery{}); len(trash) != 0 {
+		t.Fatalf("got trash %+v, want it empty", trash)
+	}
+
+	// the code values and the ID of the create are free again
+	product := newTestProduct("P5")
+	if err := rp.Create(&product); err != nil || product.ID != 5 {
+		t.Fatalf("got ID %d and error %v, want ID 5", product.ID, err)
+	}
+}
+
+// trashIDs returns the IDs of the products of the trash, in the order they were deleted
+func trashIDs(t *testing.T, rp internal.ProductRepository) (ids []int) {
+	products, _, err := rp.GetTrash(internal.ProductQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids = make([]int, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+	return
+}
+
+// TestProductMap_TrashIndex checks that the code values of the trash stay reserved and its order is
+// kept through the deletes, restores and purges and their undo, also when products share a code value
+func TestProductMap_TrashIndex(t *testing.T) {
+	rp := NewProductMap(newBenchmarkProducts(4), 4)
+	rp.ReserveTrashedCodes = true
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for id := 1; id <= 3; id++ {
+		deletion := internal.ProductDeletion{At: start.Add(time.Duration(id) * time.Hour)}
+		if err := rp.Delete(id, internal.ProductCondition{}, deletion); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	product := newTestProduct("P2")
+	if err := rp.Create(&product); !errors.Is(err, internal.ErrProductDuplicated) {
+		t.Fatalf("got error %v for a code value of the trash, want %v", err, internal.ErrProductDuplicated)
+	}
+
+	// a failed batch puts the purged product back in its place
+	_, err := rp.Batch([]internal.ProductWrite{
+		{Type: internal.ProductWritePurge, ID: 2},
+		{Type: internal.ProductWriteDelete, ID: 4},
+		{Type: internal.ProductWritePurge, ID: 4},
+		{Type: internal.ProductWriteDelete, ID: 99},
+	})
+	if !errors.Is(err, internal.ErrProductNotFound) {
+		t.Fatalf("got error %v, want %v", err, internal.ErrProductNotFound)
+	}
+	if ids := trashIDs(t, rp); !slices.Equal(ids, []int{1, 2, 3}) {
+		t.Fatalf("got trash %v after the failed batch, want [1 2 3]", ids)
+	}
+
+	// a restore and a purge undone leave the trash as it was
+	if _, err := rp.Restore(2); err != nil {
+		t.Fatal(err)
+	}
+	if ids := trashIDs(t, rp); !slices.Equal(ids, []int{1, 3}) {
+		t.Fatalf("got trash %v after the restore, want [1 3]", ids)
+	}
+	rp.Undo()
+
+	if purged, err := rp.Purge(start.Add(150 * time.Minute)); err != nil || len(purged) != 2 {
+		t.Fatalf("got %d products purged and error %v, want 2", len(purged), err)
+	}
+	if ids := trashIDs(t, rp); !slices.Equal(ids, []int{3}) {
+		t.Fatalf("got trash %v after the purge, want [3]", ids)
+	}
+	rp.Undo()
+
+	if ids := trashIDs(t, rp); !slices.Equal(ids, []int{1, 2, 3}) {
+		t.Fatalf("got trash %v after the undo, want [1 2 3]", ids)
+	}
+	if err := rp.Create(&product); !errors.Is(err, internal.ErrProductDuplicated) {
+		t.Fatalf("got error %v after the undo, want %v", err, internal.ErrProductDuplicated)
+	}
+
+	// a code value shared by two products of the trash is reserved until both are purged
+	rp.ReserveTrashedCodes = false
+	if err := rp.Create(&product); err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.Delete(product.ID, internal.ProductCondition{}, internal.ProductDeletion{At: start.Add(5 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	rp.ReserveTrashedCodes = true
+
+	if _, err := rp.Purge(start.Add(150 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	again := newTestProduct("P2")
+	if err := rp.Create(&again); !errors.Is(err, internal.ErrProductDuplicated) {
+		t.Fatalf("got error %v with the code value still in the trash, want %v", err, internal.ErrProductDuplicated)
+	}
+
+	if _, err := rp.Batch([]internal.ProductWrite{{Type: internal.ProductWritePurge, ID: product.ID}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.Create(&again); err != nil {
+		t.Fatalf("got error %v once the code value left the trash, want none", err)
+	}
+}
+
+// searchIDs returns the IDs of the products matching the text, in their order of relevance
+func searchIDs(t *testing.T, rp internal.ProductRepository, text string) (ids []int) {
+	products, _, err := rp.Search(text, internal.ProductQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids = make([]int, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+	return
+}
+
+// testSearchIndex checks that the search index follows the writes of the repository: the name and the
+// code value are tokenized, the old terms of an update are removed, a deleted product is only found
+// again once restored, and a create refused for its duplicated code value is not indexed
+func testSearchIndex(t *testing.T, rp internal.ProductRepository) {
+	names := []string{"Crème Brûlée", "Café-au-lait 250g", "Brûlée sugar"}
+	for index, name := range names {
+		product := newTestProduct(fmt.Sprintf("SKU-%d", index+1))
+		product.Name = name
+		if err := rp.Create(&product); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{text: "creme", want: []int{1}},
+		{text: "BRULEE", want: []int{1, 3}},
+		{text: "lait 250", want: []int{2}},
+		{text: "cafe au", want: []int{2}},
+		{text: "sku 3", want: []int{3}},
+		{text: "bru sug", want: []int{3}},
+		{text: "creme sugar", want: []int{}},
+		{text: "--", want: []int{}},
+	}
+	for _, tt := range tests {
+		if got := searchIDs(t, rp, tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("search %q: got %v, want %v", tt.text, got, tt.want)
+		}
+	}
+
+	// an update replaces the terms of the product
+	product, _ := rp.GetByID(1)
+	product.Name, product.CodeValue = "Flan", "SKU-9"
+	if err := rp.Update(&product, internal.ProductCondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchIDs(t, rp, "creme"); len(got) != 0 {
+		t.Fatalf("got %v for the old name, want nothing", got)
+	}
+	if got := searchIDs(t, rp, "flan sku 9"); !slices.Equal(got, []int{1}) {
+		t.Fatalf("got %v for the new name, want [1]", got)
+	}
+
+	// a duplicated code value is refused and leaves the index as it was
+	duplicated := newTestProduct("SKU-9")
+	duplicated.Name = "Flan duplicated"
+	if err := rp.Create(&duplicated); !errors.Is(err, internal.ErrProductDuplicated) {
+		t.Fatalf("got error %v, want %v", err, internal.ErrProductDuplicated)
+	}
+	if got := searchIDs(t, rp, "flan"); !slices.Equal(got, []int{1}) {
+		t.Fatalf("got %v after the duplicated create, want [1]", got)
+	}
+
+	// a deleted product is left out of the search until it is restored
+	if err := rp.Delete(3, internal.ProductCondition{}, internal.ProductDeletion{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchIDs(t, rp, "brulee"); len(got) != 0 {
+		t.Fatalf("got %v after the delete, want nothing", got)
+	}
+	if _, err := rp.Restore(3); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchIDs(t, rp, "brulee"); !slices.Equal(got, []int{3}) {
+		t.Fatalf("got %v after the restore, want [3]", got)
+	}
+}
+
+func TestProductMap_Search(t *testing.T) {
+	testSearchIndex(t, NewProductMap(nil, 0))
+}
+
+func TestProductSlice_Search(t *testing.T) {
+	testSearchIndex(t, NewProductSlice(nil, 0))
+}
@@ -1,44 +1,113 @@
 package repository
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/platform/search"
 	"github.com/edwinbm5/go-product-web/internal/platform/tools"
 )
 
-// ProductSlice is a repository that stores products in a slice
+// ProductSlice is a repository that stores products in a slice, it is safe for concurrent use.
+// It is kept as the baseline the benchmarks of ProductMap are compared with
 type ProductSlice struct {
+	mu     sync.RWMutex
 	db     []internal.Product
 	lastID int
+	// index is the full-text index of the name and code value of the products
+	index *search.Index
+	// trash holds the deleted products in the order they were deleted
+	trash []internal.Product
+
+	// ReserveTrashedCodes keeps the code values of the products of the trash taken until they are purged
+	ReserveTrashedCodes bool
 }
 
-// NewProductSlice creates a new ProductSlice
+// NewProductSlice creates a new ProductSlice, the products of db with a deletion are put in the trash
+// and the others are kept in the order of their IDs
 func NewProductSlice(db []internal.Product, lastID int) *ProductSlice {
-	if db == nil {
-		db = make([]internal.Product, 0)
+	products := make([]internal.Product, 0, len(db))
+	var trash []internal.Product
+
+	index := search.NewIndex()
+	for _, pr := range sortedByID(db) {
+		if !pr.DeletedAt.IsZero() {
+			trash = append(trash, pr)
+			continue
+		}
+
+		products = append(products, pr)
+		index.Set(pr.ID, pr.Name, pr.CodeValue)
 	}
 
 	return &ProductSlice{
-		db:     db,
+		db:     products,
 		lastID: lastID,
+		index:  index,
+		trash:  trash,
 	}
 }
 
-// GetAll returns all the products in the database
-func (p *ProductSlice) GetAll() (products []internal.Product, err error) {
+// GetAll returns the products in the database that match the query
+func (p *ProductSlice) GetAll(query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if len(p.db) == 0 {
 		err = internal.ErrProductsEmpty
 		return
 	}
 
-	products = p.db
+	// copy the products so callers can't modify the database
+	products = make([]internal.Product, 0, len(p.db))
+	for _, pr := range p.db {
+		if query.Match(pr) {
+			products = append(products, pr)
+		}
+	}
+
+	products, total = query.Apply(products)
+
+	return
+}
+
+// Search returns the products whose name or code value match the text, sorted by relevance
+// unless the query sets another order
+func (p *ProductSlice) Search(text string, query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	positions := make(map[int]int, len(p.db))
+	for index, pr := range p.db {
+		positions[pr.ID] = index
+	}
+
+	products = make([]internal.Product, 0)
+	for _, result := range p.index.Search(text) {
+		index, ok := positions[result.ID]
+		if !ok {
+			continue
+		}
+
+		if pr := p.db[index]; query.Match(pr) {
+			products = append(products, pr)
+		}
+	}
+
+	products, total = query.Apply(products)
 
 	return
 }
 
 // GetByID returns a product by its ID
 func (p *ProductSlice) GetByID(id int) (product internal.Product, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	for _, prod := range p.db {
 		if prod.ID == id {
 			product = prod
@@ -51,114 +120,141 @@ func (p *ProductSlice) GetByID(id int) (product internal.Product, err error) {
 	return
 }
 
+// Cursor returns up to limit products that match the query after the product with the ID after,
+// the slice keeps the products in the order of their IDs since they are created with increasing IDs
+func (p *ProductSlice) Cursor(after int, limit int, query internal.ProductQuery) (products []internal.Product, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	start, _ := slices.BinarySearchFunc(p.db, after+1, func(pr internal.Product, id int) int {
+		return cmp.Compare(pr.ID, id)
+	})
+
+	products = make([]internal.Product, 0, limit)
+	for _, pr := range p.db[start:] {
+		if len(products) == limit {
+			break
+		}
+
+		if query.Match(pr) {
+			products = append(products, pr)
+		}
+	}
+
+	return
+}
+
 // Creates a new product in the database
 func (p *ProductSlice) Create(product *internal.Product) (err error) {
-	for _, pr := range p.db {
-		if pr.CodeValue == (*product).CodeValue {
-			err = internal.ErrProductDuplicated
-			err = fmt.Errorf("%w: The Code value %s already exists", err, (*product).CodeValue)
-			return
-		}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err = p.create(product)
+	return
+}
+
+// create adds the product to the database, the caller must hold the write lock
+func (p *ProductSlice) create(product *internal.Product) (err error) {
+	if p.taken(product.CodeValue, 0) {
+		err = internal.ErrProductDuplicated
+		err = fmt.Errorf("%w: The Code value %s already exists", err, product.CodeValue)
+		return
 	}
 
-	err = tools.ParseDate(product.Expiration)
-	if err != nil {
-		err = fmt.Errorf("%w: The expiration date %s is not valid", err, product.Expiration)
+	if product.Expiration.IsZero() {
+		err = fmt.Errorf("%w: The expiration date is required", tools.ErrInvalidDate)
 		return
 	}
 
 	p.lastID++
 	product.ID = p.lastID
+	product.Version = 1
 
 	p.db = append(p.db, *product)
+	p.index.Set(product.ID, product.Name, product.CodeValue)
 
 	return
 }
 
 // Updates a product in the database or creates it if it does not exist
-func (p *ProductSlice) UpdateAndCreate(product *internal.Product) (err error) {
+func (p *ProductSlice) UpdateAndCreate(product *internal.Product, condition internal.ProductCondition) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	for _, pr := range p.db {
 		if pr.ID == product.ID {
-			err = p.Update(product.ID, map[string]any{
-				"CodeValue":   product.CodeValue,
-				"Name":        product.Name,
-				"Price":       product.Price,
-				"Expiration":  product.Expiration,
-				"IsPublished": product.IsPublished,
-				"Quantity":    product.Quantity,
-				"ID":          product.ID,
-			})
-
+			err = p.update(product, condition)
 			return
 		}
 	}
 
-	err = p.Create(product)
+	if !condition.Met(nil) {
+		err = fmt.Errorf("%w: The product with ID %d does not exist", internal.ErrProductCondition, product.ID)
+		return
+	}
+
+	err = p.create(product)
 
 	return
 }
 
-// Updates a product in the database
-func (p *ProductSlice) Update(id int, fields map[string]any) (err error) {
-	productExist := false
-	productIndex := 0
+// Updates a product in the database, all its fields are replaced
+func (p *ProductSlice) Update(product *internal.Product, condition internal.ProductCondition) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-	for index, pr := range p.db {
-		if pr.ID == id {
-			productExist = true
-			productIndex = index
-		}
+	err = p.update(product, condition)
+	return
+}
+
+// update replaces a product, the caller must hold the write lock
+func (p *ProductSlice) update(product *internal.Product, condition internal.ProductCondition) (err error) {
+	if p.taken(product.CodeValue, product.ID) {
+		err = internal.ErrProductDuplicated
+		err = fmt.Errorf("%w: The Code value %s already exists", err, product.CodeValue)
+		return
 	}
 
-	if !productExist {
+	productIndex := slices.IndexFunc(p.db, func(pr internal.Product) bool { return pr.ID == product.ID })
+	if productIndex < 0 {
 		err = internal.ErrProductNotFound
-		err = fmt.Errorf("%w: The product with ID %d does not exist", err, id)
+		err = fmt.Errorf("%w: The product with ID %d does not exist", err, product.ID)
 		return
 	}
 
-	product := p.db[productIndex]
-
-	err = tools.ParseDate(product.Expiration)
-	if err != nil {
-		err = tools.ErrInvalidDate
+	old := p.db[productIndex]
+	if !condition.Met(&old) {
+		err = fmt.Errorf("%w: The product with ID %d is at version %d", internal.ErrProductCondition, old.ID, old.Version)
 		return
 	}
 
-	for key := range fields {
-		switch key {
-		case "CodeValue", "codevalue":
-			for _, pr := range p.db {
-				if pr.CodeValue == fields["codevalue"] && pr.ID != id {
-					err = internal.ErrProductDuplicated
-					err = fmt.Errorf("%w: The Code value %s already exists", err, product.CodeValue)
-					return
-				}
-			}
-			product.CodeValue = fields[key].(string)
-		case "Name", "name":
-			product.Name = fields[key].(string)
-		case "Expiration", "expiration":
-			product.Expiration = fields[key].(string)
-		case "Price", "price":
-			product.Price = fields[key].(float64)
-		case "Quantity", "quantity":
-			product.Quantity = fields[key].(int)
-		case "IsPublished", "ispublished":
-			product.IsPublished = fields[key].(bool)
-		default:
-		}
+	if product.Expiration.IsZero() {
+		err = fmt.Errorf("%w: The expiration date is required", tools.ErrInvalidDate)
+		return
 	}
 
-	p.db[productIndex] = product
+	product.Version = old.Version + 1
+	p.db[productIndex] = *product
+	p.index.Set(product.ID, product.Name, product.CodeValue)
 
 	return
 }
 
-// Deletes a product from the database
-func (p *ProductSlice) Delete(id int) (err error) {
+// Delete moves a product to the trash
+func (p *ProductSlice) Delete(id int, condition internal.ProductCondition, deletion internal.ProductDeletion) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	for index, product := range p.db {
 		if product.ID == id {
+			if !condition.Met(&product) {
+				err = fmt.Errorf("%w: The product with ID %d is at version %d", internal.ErrProductCondition, id, product.Version)
+				return
+			}
+
 			p.db = append(p.db[:index], p.db[index+1:]...)
+			p.index.Remove(id)
+			p.trash = append(p.trash, trashed(product, deletion))
 			return
 		}
 	}
@@ -167,3 +263,197 @@ func (p *ProductSlice) Delete(id int) (err error) {
 
 	return
 }
+
+// GetTrash returns the products of the trash that match the query, in the order they were deleted
+func (p *ProductSlice) GetTrash(query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	products = make([]internal.Product, 0, len(p.trash))
+	for _, pr := range p.trash {
+		if query.Match(pr) {
+			products = append(products, pr)
+		}
+	}
+
+	products, total = query.Apply(products)
+
+	return
+}
+
+// Restore moves a product back from the trash, in the place of its ID
+func (p *ProductSlice) Restore(id int) (product internal.Product, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	index := slices.IndexFunc(p.trash, func(pr internal.Product) bool { return pr.ID == id })
+	if index < 0 {
+		err = internal.ErrProductNotFound
+		err = fmt.Errorf("%w: The product with ID %d is not in the trash", err, id)
+		return
+	}
+
+	product = p.trash[index]
+	if owner := slices.IndexFunc(p.db, func(pr internal.Product) bool { return pr.CodeValue == product.CodeValue }); owner >= 0 {
+		err = internal.ErrProductDuplicated
+		err = fmt.Errorf("%w: The Code value %s was taken by the product with ID %d", err, product.CodeValue, p.db[owner].ID)
+		return
+	}
+
+	p.trash = slices.Delete(p.trash, index, index+1)
+	product.DeletedAt, product.DeletedBy = time.Time{}, ""
+	product.Version++
+
+	// the slice is kept in the order of the IDs
+	position, _ := slices.BinarySearchFunc(p.db, id, func(pr internal.Product, id int) int {
+		return cmp.Compare(pr.ID, id)
+	})
+	p.db = slices.Insert(p.db, position, product)
+	p.index.Set(id, product.Name, product.CodeValue)
+
+	return
+}
+
+// Purge removes the products of the trash deleted before the time
+func (p *ProductSlice) Purge(before time.Time) (products []internal.Product, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.trash = slices.DeleteFunc(p.trash, func(pr internal.Product) bool {
+		if pr.DeletedAt.Before(before) {
+			products = append(products, pr)
+			return true
+		}
+		return false
+	})
+
+	return
+}
+
+// Batch applies all the writes or none of them, the database is restored from a copy when a write fails
+func (p *ProductSlice) Batch(writes []internal.ProductWrite) (products []internal.Product, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	saved, trash, lastID := slices.Clone(p.db), slices.Clone(p.trash), p.lastID
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		for _, product := range products {
+			p.index.Remove(product.ID)
+		}
+		p.db, p.trash, p.lastID = saved, trash, lastID
+		for _, product := range p.db {
+			if slices.ContainsFunc(products, func(pr internal.Product) bool { return pr.ID == product.ID }) {
+				p.index.Set(product.ID, product.Name, product.CodeValue)
+			}
+		}
+		products = nil
+	}()
+
+	products = make([]internal.Product, 0, len(writes))
+	for index, write := range writes {
+		product, writeErr := p.write(write)
+		if writeErr != nil {
+			err = &internal.ProductBatchError{Index: index, Err: writeErr}
+			return
+		}
+
+		products = append(products, product)
+	}
+
+	return
+}
+
+// write applies a write of a batch, the caller must hold the write lock
+func (p *ProductSlice) write(write internal.ProductWrite) (product internal.Product, err error) {
+	switch write.Type {
+	case internal.ProductWriteCreate:
+		product = write.Product
+		err = p.createIf(&product, write.Condition)
+	case internal.ProductWriteUpsert:
+		product = write.Product
+		if slices.ContainsFunc(p.db, func(pr internal.Product) bool { return pr.ID == product.ID }) {
+			err = p.update(&product, write.Condition)
+			return
+		}
+		err = p.createIf(&product, write.Condition)
+	case internal.ProductWritePatch:
+		index := slices.IndexFunc(p.db, func(pr internal.Product) bool { return pr.ID == write.ID })
+		if index < 0 {
+			err = fmt.Errorf("%w: The product with ID %d does not exist", internal.ErrProductNotFound, write.ID)
+			return
+		}
+
+		if product, err = write.Patch.Apply(p.db[index]); err != nil {
+			return
+		}
+		err = p.update(&product, write.Condition)
+	case internal.ProductWriteDelete:
+		index := slices.IndexFunc(p.db, func(pr internal.Product) bool { return pr.ID == write.ID })
+		if index < 0 {
+			err = fmt.Errorf("%w: The product with ID %d does not exist", internal.ErrProductNotFound, write.ID)
+			return
+		}
+
+		if !write.Condition.Met(&p.db[index]) {
+			err = fmt.Errorf("%w: The product with ID %d is at version %d", internal.ErrProductCondition, write.ID, p.db[index].Version)
+			return
+		}
+
+		product = trashed(p.db[index], write.Deletion)
+		p.db = slices.Delete(p.db, index, index+1)
+		p.index.Remove(write.ID)
+		p.trash = append(p.trash, product)
+	case internal.ProductWritePurge:
+		if index := slices.IndexFunc(p.db, func(pr internal.Product) bool { return pr.ID == write.ID }); index >= 0 {
+			if !write.Condition.Met(&p.db[index]) {
+				err = fmt.Errorf("%w: The product with ID %d is at version %d", internal.ErrProductCondition, write.ID, p.db[index].Version)
+				return
+			}
+
+			product = p.db[index]
+			p.db = slices.Delete(p.db, index, index+1)
+			p.index.Remove(write.ID)
+			return
+		}
+
+		index := slices.IndexFunc(p.trash, func(pr internal.Product) bool { return pr.ID == write.ID })
+		if index < 0 {
+			err = fmt.Errorf("%w: The product with ID %d does not exist", internal.ErrProductNotFound, write.ID)
+			return
+		}
+
+		product = p.trash[index]
+		p.trash = slices.Delete(p.trash, index, index+1)
+	default:
+		err = fmt.Errorf("%w: unknown write %q", internal.ErrProductBatchInvalid, write.Type)
+	}
+
+	return
+}
+
+// taken reports whether the code value belongs to a product other than the one with the ID, or
+// to a product of the trash when their code values are reserved. The caller must hold the lock
+func (p *ProductSlice) taken(code string, id int) bool {
+	if index := slices.IndexFunc(p.db, func(pr internal.Product) bool { return pr.CodeValue == code }); index >= 0 {
+		return p.db[index].ID != id
+	}
+
+	return p.ReserveTrashedCodes && slices.ContainsFunc(p.trash, func(pr internal.Product) bool {
+		return pr.CodeValue == code
+	})
+}
+
+// createIf creates the product if the condition is met by a missing product, the caller must hold the write lock
+func (p *ProductSlice) createIf(product *internal.Product, condition internal.ProductCondition) (err error) {
+	if !condition.Met(nil) {
+		err = fmt.Errorf("%w: The product with ID %d does not exist", internal.ErrProductCondition, product.ID)
+		return
+	}
+
+	err = p.create(product)
+	return
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
+
+// newTestProduct returns a product ready to be created with the code value
+func newTestProduct(code string) internal.Product {
+	return internal.Product{
+		Name:       "Product " + code,
+		Quantity:   1,
+		CodeValue:  code,
+		Expiration: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Price:      10,
+	}
+}
+
+// TestProductSlice_Concurrent calls every method of the repository from many goroutines at once,
+// run it with -race
+func TestProductSlice_Concurrent(t *testing.T) {
+	const (
+		workers = 16
+		perWork = 50
+	)
+
+	rp := NewProductSlice(nil, 0)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		ids     = make(map[int]string)
+		deleted = make(map[int]bool)
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < perWork; i++ {
+				product := newTestProduct(fmt.Sprintf("W%d-%d", w, i))
+				if err := rp.Create(&product); err != nil {
+					t.Errorf("create: %v", err)
+					return
+				}
+
+				// an upsert of an unknown ID creates the product with the next ID
+				upsert := newTestProduct(fmt.Sprintf("U%d-%d", w, i))
+				if err := rp.UpdateAndCreate(&upsert, internal.ProductCondition{}); err != nil {
+					t.Errorf("upsert: %v", err)
+					return
+				}
+
+				mu.Lock()
+				for _, pr := range []internal.Product{product, upsert} {
+					if code, ok := ids[pr.ID]; ok {
+						t.Errorf("ID %d given to %s and %s", pr.ID, code, pr.CodeValue)
+					}
+					ids[pr.ID] = pr.CodeValue
+				}
+				mu.Unlock()
+
+				if _, err := rp.GetByID(product.ID); err != nil {
+					t.Errorf("get by ID: %v", err)
+				}
+
+				if _, _, err := rp.GetAll(internal.ProductQuery{}); err != nil {
+					t.Errorf("get all: %v", err)
+				}
+
+				product.Quantity++
+				if err := rp.Update(&product, internal.ProductCondition{IfMatch: []int{1}}); err != nil {
+					t.Errorf("update: %v", err)
+				}
+
+				upsert.Price++
+				if err := rp.UpdateAndCreate(&upsert, internal.ProductCondition{Exists: true}); err != nil {
+					t.Errorf("upsert existing: %v", err)
+				}
+
+				if i%2 == 0 {
+					if err := rp.Delete(upsert.ID, internal.ProductCondition{}, internal.ProductDeletion{At: time.Now()}); err != nil {
+						t.Errorf("delete: %v", err)
+					}
+
+					mu.Lock()
+					deleted[upsert.ID] = true
+					mu.Unlock()
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	if want := workers * perWork * 2; len(ids) != want {
+		t.Fatalf("got %d IDs, want %d", len(ids), want)
+	}
+
+	products, total, err := rp.GetAll(internal.ProductQuery{})
+	if err != nil {
+		t.Fatalf("get all: %v", err)
+	}
+
+	if want := len(ids) - len(deleted); total != want || len(products) != want {
+		t.Fatalf("got %d products, want %d", total, want)
+	}
+
+	for _, pr := range products {
+		code, ok := ids[pr.ID]
+		switch {
+		case !ok:
+			t.Errorf("product %d was never created", pr.ID)
+		case deleted[pr.ID]:
+			t.Errorf("product %d was deleted", pr.ID)
+		case code != pr.CodeValue:
+			t.Errorf("product %d has code %s, want %s", pr.ID, pr.CodeValue, code)
+		case pr.Version != 2:
+			t.Errorf("product %d is at version %d, want 2", pr.ID, pr.Version)
+		}
+	}
+}
+
+// TestProductSlice_ConcurrentDuplicates creates the same code value from many goroutines, only one
+// of them must succeed
+func TestProductSlice_ConcurrentDuplicates(t *testing.T) {
+	const workers = 32
+
+	rp := NewProductSlice(nil, 0)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created int
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			product := newTestProduct("SAME")
+			err := rp.Create(&product)
+			switch {
+			case err == nil:
+				mu.Lock()
+				created++
+				mu.Unlock()
+			case !errors.Is(err, internal.ErrProductDuplicated):
+				t.Errorf("create: %v", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if created != 1 {
+		t.Fatalf("created %d products with the same code value, want 1", created)
+	}
+}
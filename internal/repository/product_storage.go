@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/storage"
+)
+
+// ProductUndoer is a repository that can undo its last write
+type ProductUndoer interface {
+	internal.ProductRepository
+	// Undo undoes the last write made on the repository
+	Undo()
+	// LastID returns the last ID given, it is saved with the snapshots so the IDs of the products
+	// deleted for good are not given again
+	LastID() (id int)
+}
+
+// ProductStorage is a repository that saves every change made on another repository into a storage.
+// Each change is appended to the storage log before returning, or undone when it can't be appended,
+// and every compactEvery changes the whole repository is saved as a new snapshot
+type ProductStorage struct {
+	rp ProductUndoer
+	st storage.Storage
+
+	// mu keeps the log in the same order as the changes made on the repository
+	mu           sync.Mutex
+	compactEvery int
+	pending      int
+}
+
+// NewProductStorage creates a new ProductStorage, a compactEvery lower than 1 saves a snapshot on every change
+func NewProductStorage(rp ProductUndoer, st storage.Storage, compactEvery int) *ProductStorage {
+	return &ProductStorage{
+		rp:           rp,
+		st:           st,
+		compactEvery: compactEvery,
+	}
+}
+
+// GetAll returns the products in the database that match the query
+func (p *ProductStorage) GetAll(query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	products, total, err = p.rp.GetAll(query)
+	return
+}
+
+// Search returns the products whose name or code value match the text
+func (p *ProductStorage) Search(text string, query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	products, total, err = p.rp.Search(text, query)
+	return
+}
+
+// GetByID returns a product by its ID
+func (p *ProductStorage) GetByID(id int) (product internal.Product, err error) {
+	product, err = p.rp.GetByID(id)
+	return
+}
+
+// Cursor returns up to limit products that match the query after the product with the ID after
+func (p *ProductStorage) Cursor(after int, limit int, query internal.ProductQuery) (products []internal.Product, err error) {
+	products, err = p.rp.Cursor(after, limit, query)
+	return
+}
+
+// Creates a new product in the database
+func (p *ProductStorage) Create(product *internal.Product) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err = p.rp.Create(product); err != nil {
+		return
+	}
+
+	err = p.append(storage.Operation{Type: storage.OperationCreate, Product: *product})
+	return
+}
+
+// Updates a product in the database or creates it if it does not exist
+func (p *ProductStorage) UpdateAndCreate(product *internal.Product, condition internal.ProductCondition) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err = p.rp.UpdateAndCreate(product, condition); err != nil {
+		return
+	}
+
+	stored, err := p.rp.GetByID(product.ID)
+	if err != nil {
+		return
+	}
+
+	err = p.append(storage.Operation{Type: storage.OperationUpdate, Product: stored})
+	return
+}
+
+// Updates a product in the database
+func (p *ProductStorage) Update(product *internal.Product, condition internal.ProductCondition) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err = p.rp.Update(product, condition); err != nil {
+		return
+	}
+
+	stored, err := p.rp.GetByID(product.ID)
+	if err != nil {
+		return
+	}
+
+	err = p.append(storage.Operation{Type: storage.OperationUpdate, Product: stored})
+	return
+}
+
+// Delete moves a product to the trash, it is logged with its deletion
+func (p *ProductStorage) Delete(id int, condition internal.ProductCondition, deletion internal.ProductDeletion) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// a missing product fails the delete below with the same error
+	stored, _ := p.rp.GetByID(id)
+	if err = p.rp.Delete(id, condition, deletion); err != nil {
+		return
+	}
+
+	err = p.append(storage.Operation{Type: storage.OperationTrash, Product: trashed(stored, deletion)})
+	return
+}
+
+// GetTrash returns the products of the trash that match the query
+func (p *ProductStorage) GetTrash(query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	products, total, err = p.rp.GetTrash(query)
+	return
+}
+
+// Restore moves a product back from the trash
+func (p *ProductStorage) Restore(id int) (product internal.Product, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if product, err = p.rp.Restore(id); err != nil {
+		return
+	}
+
+	err = p.append(storage.Operation{Type: storage.OperationRestore, Product: product})
+	return
+}
+
+// Purge removes the products of the trash deleted before the time, and logs them as deleted
+func (p *ProductStorage) Purge(before time.Time) (products []internal.Product, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if products, err = p.rp.Purge(before); err != nil || len(products) == 0 {
+		return
+	}
+
+	batch := storage.Operation{Type: storage.OperationBatch}
+	for _, product := range products {
+		batch.Operations = append(batch.Operations, storage.Operation{Type: storage.OperationDelete, Product: internal.Product{ID: product.ID}})
+	}
+
+	err = p.append(batch)
+	return
+}
+
+// Batch applies all the writes or none of them, and logs them as a single operation
+func (p *ProductStorage) Batch(writes []internal.ProductWrite) (products []internal.Product, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if products, err = p.rp.Batch(writes); err != nil {
+		return
+	}
+
+	batch := storage.Operation{Type: storage.OperationBatch}
+	for index, write := range writes {
+		operation := storage.Operation{Type: storage.OperationUpdate, Product: products[index]}
+		switch write.Type {
+		case internal.ProductWriteCreate:
+			operation.Type = storage.OperationCreate
+		case internal.ProductWriteDelete:
+			operation.Type = storage.OperationTrash
+		case internal.ProductWritePurge:
+			operation = storage.Operation{Type: storage.OperationDelete, Product: internal.Product{ID: products[index].ID}}
+		}
+		batch.Operations = append(batch.Operations, operation)
+	}
+
+	err = p.append(batch)
+	return
+}
+
+// append writes the operation into the storage log, and compacts the log into a snapshot when it is due.
+// The write of the operation is undone when it can't be logged, so it is not served nor saved later
+func (p *ProductStorage) append(operation storage.Operation) (err error) {
+	if err = p.st.Append(operation); err != nil {
+		p.rp.Undo()
+		err = fmt.Errorf("%w: %v", internal.ErrProductInternal, err)
+		return
+	}
+
+	p.pending += max(len(operation.Operations), 1)
+	if p.pending < p.compactEvery {
+		return
+	}
+
+	// the operation is already safe in the log, a failed compaction is retried on the next change
+	if err := p.compact(); err == nil {
+		p.pending = 0
+	}
+
+	return
+}
+
+// compact saves the current state of the repository as a new snapshot, with the products of the trash
+// and the last ID
+func (p *ProductStorage) compact() (err error) {
+	products, _, err := p.rp.GetAll(internal.ProductQuery{})
+	if err != nil && !errors.Is(err, internal.ErrProductsEmpty) {
+		return
+	}
+
+	trash, _, err := p.rp.GetTrash(internal.ProductQuery{})
+	if err != nil {
+		return
+	}
+
+	err = p.st.Save(append(products, trash...), p.rp.LastID())
+	return
+}
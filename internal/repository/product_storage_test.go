@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/storage"
+)
+
+// failingStorage is a storage whose log fails while fail is set
+type failingStorage struct {
+	fail bool
+}
+
+func (f *failingStorage) Open() (err error)                                          { return }
+func (f *failingStorage) Load() (products []internal.Product, lastID int, err error) { return }
+func (f *failingStorage) Save(products []internal.Product, lastID int) (err error)   { return }
+func (f *failingStorage) Close() (err error)                                         { return }
+func (f *failingStorage) Append(operation storage.Operation) (err error) {
+	if f.fail {
+		err = errors.New("disk full")
+	}
+	return
+}
+
+// TestProductStorage_AppendFailure checks that a write that can't be logged is not applied
+func TestProductStorage_AppendFailure(t *testing.T) {
+	st := &failingStorage{}
+	rp := NewProductStorage(NewProductMap(nil, 0), st, 100)
+
+	first, second := newTestProduct("A"), newTestProduct("B")
+	if err := rp.Create(&first); err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.Create(&second); err != nil {
+		t.Fatal(err)
+	}
+	if err := rp.Delete(second.ID, internal.ProductCondition{}, internal.ProductDeletion{At: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	st.fail = true
+	writes := []struct {
+		name  string
+		write func() error
+	}{
+		{name: "create", write: func() error {
+			product := newTestProduct("C")
+			return rp.Create(&product)
+		}},
+		{name: "update", write: func() error {
+			product := first
+			product.Quantity = 100
+			return rp.Update(&product, internal.ProductCondition{})
+		}},
+		{name: "upsert", write: func() error {
+			product := first
+			product.Name = "Changed"
+			return rp.UpdateAndCreate(&product, internal.ProductCondition{})
+		}},
+		{name: "delete", write: func() error {
+			return rp.Delete(first.ID, internal.ProductCondition{}, internal.ProductDeletion{At: time.Now()})
+		}},
+		{name: "restore", write: func() error {
+			_, err := rp.Restore(second.ID)
+			return err
+		}},
+		{name: "batch", write: func() error {
+			_, err := rp.Batch([]internal.ProductWrite{
+				{Type: internal.ProductWriteCreate, Product: newTestProduct("D")},
+				{Type: internal.ProductWritePatch, ID: first.ID, Patch: internal.ProductMergePatch{"name": "Patched"}},
+				{Type: internal.ProductWriteDelete, ID: first.ID},
+			})
+			return err
+		}},
+	}
+
+	for _, w := range writes {
+		if err := w.write(); !errors.Is(err, internal.ErrProductInternal) {
+			t.Fatalf("%s: got error %v, want %v", w.name, err, internal.ErrProductInternal)
+		}
+
+		products, _, err := rp.GetAll(internal.ProductQuery{})
+		if err != nil {
+			t.Fatalf("%s: %v", w.name, err)
+		}
+		if len(products) != 1 || products[0] != first {
+			t.Fatalf("%s: got products %+v, want %+v", w.name, products, first)
+		}
+
+		trash, _, err := rp.GetTrash(internal.ProductQuery{})
+		if err != nil {
+			t.Fatalf("%s: %v", w.name, err)
+		}
+		if len(trash) != 1 || trash[0].ID != second.ID {
+			t.Fatalf("%s: got trash %+v, want the product %d", w.name, trash, second.ID)
+		}
+	}
+
+	// the ID of the create that was undone is given again
+	st.fail = false
+	product := newTestProduct("C")
+	if err := rp.Create(&product); err != nil {
+		t.Fatal(err)
+	}
+	if product.ID != second.ID+1 {
+		t.Fatalf("got ID %d, want %d", product.ID, second.ID+1)
+	}
+}
+
+// TestProductStorage_RestoreReopen checks that a product restored from the trash is loaded back in
+// the order of its ID, as the cursors expect
+func TestProductStorage_RestoreReopen(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "products.json")
+
+	st := storage.NewStorageDefault(filePath)
+	if err := st.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the snapshot is saved after the delete, with the product in the trash after the others
+	rp := NewProductStorage(NewProductMap(nil, 0), st, 4)
+	for _, code := range []string{"A", "B", "C"} {
+		product := newTestProduct(code)
+		if err := rp.Create(&product); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rp.Delete(1, internal.ProductCondition{}, internal.ProductDeletion{At: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.Restore(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	st = storage.NewStorageDefault(filePath)
+	if err := st.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	products, lastID, err := st.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewProductMap(products, lastID)
+	cursor, err := reopened.Cursor(0, 10, internal.ProductQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	for _, pr := range cursor {
+		ids = append(ids, pr.ID)
+	}
+	if !slices.Equal(ids, []int{1, 2, 3}) {
+		t.Fatalf("got IDs %v, want [1 2 3]", ids)
+	}
+
+	if cursor, _ = reopened.Cursor(2, 10, internal.ProductQuery{}); len(cursor) != 1 || cursor[0].ID != 3 {
+		t.Fatalf("got %+v after the ID 2, want the product 3", cursor)
+	}
+}
+
+// TestProductStorage_PurgeReopen checks that the IDs of the products purged from the trash are not
+// given again after a restart, whether the purge is in the snapshot or in the log only
+func TestProductStorage_PurgeReopen(t *testing.T) {
+	for _, compactEvery := range []int{1, 100} {
+		filePath := filepath.Join(t.TempDir(), "products.json")
+
+		st := storage.NewStorageDefault(filePath)
+		if err := st.Open(); err != nil {
+			t.Fatal(err)
+		}
+
+		rp := NewProductStorage(NewProductMap(nil, 0), st, compactEvery)
+		for _, code := range []string{"A", "B", "C"} {
+			product := newTestProduct(code)
+			if err := rp.Create(&product); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rp.Delete(3, internal.ProductCondition{}, internal.ProductDeletion{At: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		if purged, err := rp.Purge(time.Now().Add(time.Second)); err != nil || len(purged) != 1 {
+			t.Fatalf("got purged %+v and error %v, want the product 3", purged, err)
+		}
+		if err := st.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		st = storage.NewStorageDefault(filePath)
+		if err := st.Open(); err != nil {
+			t.Fatal(err)
+		}
+
+		products, lastID, err := st.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		product := newTestProduct("D")
+		if err := NewProductMap(products, lastID).Create(&product); err != nil {
+			t.Fatal(err)
+		}
+		if product.ID != 4 {
+			t.Fatalf("compact every %d: got ID %d after the purge of the product 3, want 4", compactEvery, product.ID)
+		}
+		st.Close()
+	}
+}
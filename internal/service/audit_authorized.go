@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/auth"
+)
+
+// AuditAuthorized is a service that checks the permission to read the audit log before calling
+// another service, the entries tell who changed every product
+type AuditAuthorized struct {
+	sv     internal.AuditService
+	policy auth.Policy
+}
+
+// NewAuditAuthorized creates a new AuditAuthorized service
+func NewAuditAuthorized(sv internal.AuditService, policy auth.Policy) *AuditAuthorized {
+	return &AuditAuthorized{
+		sv:     sv,
+		policy: policy,
+	}
+}
+
+// History returns the changes made on a product
+func (a *AuditAuthorized) History(ctx context.Context, productID int) (entries []internal.AuditEntry, err error) {
+	if err = a.authorize(ctx); err != nil {
+		return
+	}
+
+	entries, err = a.sv.History(ctx, productID)
+	return
+}
+
+// Query returns the entries that match the query
+func (a *AuditAuthorized) Query(ctx context.Context, query internal.AuditQuery) (entries []internal.AuditEntry, err error) {
+	if err = a.authorize(ctx); err != nil {
+		return
+	}
+
+	entries, err = a.sv.Query(ctx, query)
+	return
+}
+
+// authorize checks the permission of the principal of the context
+func (a *AuditAuthorized) authorize(ctx context.Context) (err error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		principal = auth.Anonymous
+	}
+
+	err = a.policy.Authorize(principal, auth.PermissionAuditRead)
+	return
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
+
+// AuditMaxLimit is the maximum number of audit entries returned by a query
+const AuditMaxLimit = 1000
+
+type AuditDefault struct {
+	log internal.AuditLog
+}
+
+// NewAuditDefault creates a new AuditDefault service
+func NewAuditDefault(log internal.AuditLog) *AuditDefault {
+	return &AuditDefault{
+		log: log,
+	}
+}
+
+// History returns the changes made on a product, the oldest first, those of a purged product included
+func (a *AuditDefault) History(ctx context.Context, productID int) (entries []internal.AuditEntry, err error) {
+	if entries, err = a.log.Query(internal.AuditQuery{ProductID: productID}); err != nil {
+		return
+	}
+
+	slices.Reverse(entries)
+	return
+}
+
+// Query returns the entries that match the query, the newest first, up to AuditMaxLimit
+func (a *AuditDefault) Query(ctx context.Context, query internal.AuditQuery) (entries []internal.AuditEntry, err error) {
+	if query.Limit < 1 || query.Limit > AuditMaxLimit {
+		query.Limit = AuditMaxLimit
+	}
+
+	entries, err = a.log.Query(query)
+	return
+}
@@ -0,0 +1,395 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/auth"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// ProductAudited is a service that records every change made through another service into an audit log,
+// with the principal and the request ID of the context. The changes are made one at a time, so the
+// product read before a change is the one it replaced. No change is made while the entries of the
+// previous ones can't be recorded
+type ProductAudited struct {
+	sv  internal.ProductService
+	log internal.AuditLog
+
+	mu sync.Mutex
+	// pending are the entries of the changes made that the log failed to record
+	pending []internal.AuditEntry
+	// now returns the time of the entries
+	now func() time.Time
+}
+
+// NewProductAudited creates a new ProductAudited service
+func NewProductAudited(sv internal.ProductService, log internal.AuditLog) *ProductAudited {
+	return &ProductAudited{
+		sv:  sv,
+		log: log,
+		now: time.Now,
+	}
+}
+
+// GetAll returns the products in the database that match the query
+func (p *ProductAudited) GetAll(ctx context.Context, query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	products, total, err = p.sv.GetAll(ctx, query)
+	return
+}
+
+// Search returns the products whose name or code value match the text
+func (p *ProductAudited) Search(ctx context.Context, text string, query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	products, total, err = p.sv.Search(ctx, text, query)
+	return
+}
+
+// GetExpiring returns the page of the products that expire within the given duration, and their groups
+func (p *ProductAudited) GetExpiring(ctx context.Context, within time.Duration, query internal.ProductQuery) (products []internal.Product, groups []internal.ExpirationGroup, total int, err error) {
+	products, groups, total, err = p.sv.GetExpiring(ctx, within, query)
+	return
+}
+
+// GetExpired returns the page of the products whose expiration date already passed, and their groups
+func (p *ProductAudited) GetExpired(ctx context.Context, query internal.ProductQuery) (products []internal.Product, groups []internal.ExpirationGroup, total int, err error) {
+	products, groups, total, err = p.sv.GetExpired(ctx, query)
+	return
+}
+
+// GetByID returns a product by its ID
+func (p *ProductAudited) GetByID(ctx context.Context, id int) (product internal.Product, err error) {
+	product, err = p.sv.GetByID(ctx, id)
+	return
+}
+
+// Stream calls fn with every product that matches the query
+func (p *ProductAudited) Stream(ctx context.Context, query internal.ProductQuery, fn func(product internal.Product) error) (err error) {
+	err = p.sv.Stream(ctx, query, fn)
+	return
+}
+
+// Watch calls fn with the events of the query
+func (p *ProductAudited) Watch(ctx context.Context, query internal.ProductEventQuery, fn func(events []internal.ProductEvent) error) (err error) {
+	err = p.sv.Watch(ctx, query, fn)
+	return
+}
+
+// GetTrash returns the deleted products that match the query
+func (p *ProductAudited) GetTrash(ctx context.Context, query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	products, total, err = p.sv.GetTrash(ctx, query)
+	return
+}
+
+// Create saves a new product
+func (p *ProductAudited) Create(ctx context.Context, product *internal.Product) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err = p.ready(); err != nil {
+		return
+	}
+
+	if err = p.sv.Create(ctx, product); err != nil {
+		return
+	}
+
+	err = p.record(ctx, p.entry(internal.AuditCreate, nil, product))
+	return
+}
+
+// UpdateAndCreate replaces a product or creates it, and records the change as the update or the create it made
+func (p *ProductAudited) UpdateAndCreate(ctx context.Context, product *internal.Product, condition internal.ProductCondition) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err = p.ready(); err != nil {
+		return
+	}
+
+	before, err := p.stored(ctx, product.ID)
+	if err != nil {
+		return
+	}
+
+	if err = p.sv.UpdateAndCreate(ctx, product, condition); err != nil {
+		return
+	}
+
+	operation := internal.AuditUpdate
+	if before == nil {
+		operation = internal.AuditCreate
+	}
+
+	err = p.record(ctx, p.entry(operation, before, product))
+	return
+}
+
+// Update patches a product
+func (p *ProductAudited) Update(ctx context.Context, id int, patch internal.ProductPatch, condition internal.ProductCondition) (product internal.Product, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err = p.ready(); err != nil {
+		return
+	}
+
+	before, err := p.stored(ctx, id)
+	if err != nil {
+		return
+	}
+
+	if product, err = p.sv.Update(ctx, id, patch, condition); err != nil {
+		return
+	}
+
+	err = p.record(ctx, p.entry(internal.AuditUpdate, before, &product))
+	return
+}
+
+// Delete moves a product to the trash
+func (p *ProductAudited) Delete(ctx context.Context, id int, condition internal.ProductCondition) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err = p.ready(); err != nil {
+		return
+	}
+
+	before, err := p.stored(ctx, id)
+	if err != nil {
+		return
+	}
+
+	if err = p.sv.Delete(ctx, id, condition); err != nil {
+		return
+	}
+
+	err = p.record(ctx, p.entry(internal.AuditDelete, before, nil))
+	return
+}
+
+// Restore moves a product back from the trash
+func (p *ProductAudited) Restore(ctx context.Context, id int) (product internal.Product, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err = p.ready(); err != nil {
+		return
+	}
+
+	if product, err = p.sv.Restore(ctx, id); err != nil {
+		return
+	}
+
+	err = p.record(ctx, p.entry(internal.AuditRestore, nil, &product))
+	return
+}
+
+// Batch applies the writes and records an entry per write applied
+func (p *ProductAudited) Batch(ctx context.Context, writes []internal.ProductWrite, atomic bool) (results []internal.ProductWriteResult, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err = p.ready(); err != nil {
+		results = internal.NewProductBatchResults(len(writes), err)
+		return
+	}
+
+	// current holds the products as the writes leave them, nil once deleted
+	current := make(map[int]*internal.Product)
+	for _, write := range writes {
+		id := write.ID
+		if write.Type == internal.ProductWriteUpsert {
+			id = write.Product.ID
+		}
+
+		if _, ok := current[id]; ok || write.Type == internal.ProductWriteCreate {
+			continue
+		}
+
+		if current[id], err = p.stored(ctx, id); err != nil {
+			results = internal.NewProductBatchResults(len(writes), err)
+			return
+		}
+	}
+
+	if results, err = p.sv.Batch(ctx, writes, atomic); err != nil {
+		return
+	}
+
+	var entries []internal.AuditEntry
+	for index, result := range results {
+		if result.Err != nil {
+			continue
+		}
+
+		product := result.Product
+		before := current[product.ID]
+		switch writes[index].Type {
+		case internal.ProductWritePurge:
+			// the purge of a product of the trash is not a change of the catalog
+			if !product.DeletedAt.IsZero() {
+				continue
+			}
+			fallthrough
+		case internal.ProductWriteDelete:
+			// a product created by the batch is only known once written
+			if before == nil {
+				before = &product
+			}
+			entries = append(entries, p.entry(internal.AuditDelete, before, nil))
+			current[product.ID] = nil
+			continue
+		case internal.ProductWriteCreate:
+			before = nil
+		}
+
+		operation := internal.AuditUpdate
+		if before == nil {
+			operation = internal.AuditCreate
+		}
+		entries = append(entries, p.entry(operation, before, &product))
+		current[product.ID] = &product
+	}
+
+	err = p.record(ctx, entries...)
+	return
+}
+
+// Import applies an import and records the products it created, updated and deleted, found by
+// comparing the products before and after it
+func (p *ProductAudited) Import(ctx context.Context, imp internal.ProductImport) (report internal.ProductImportReport, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if imp.DryRun {
+		report, err = p.sv.Import(ctx, imp)
+		return
+	}
+
+	if err = p.ready(); err != nil {
+		return
+	}
+
+	before, err := p.all(ctx)
+	if err != nil {
+		return
+	}
+
+	if report, err = p.sv.Import(ctx, imp); err != nil {
+		return
+	}
+
+	after, err := p.all(ctx)
+	if err != nil {
+		return
+	}
+
+	stored := make(map[int]internal.Product, len(before))
+	for _, product := range before {
+		stored[product.ID] = product
+	}
+
+	var entries []internal.AuditEntry
+	for _, product := range after {
+		old, ok := stored[product.ID]
+		delete(stored, product.ID)
+
+		product := product
+		switch {
+		case !ok:
+			entries = append(entries, p.entry(internal.AuditCreate, nil, &product))
+		case old.Version != product.Version:
+			entries = append(entries, p.entry(internal.AuditUpdate, &old, &product))
+		}
+	}
+
+	// the products left were deleted by the import
+	for _, product := range before {
+		if _, ok := stored[product.ID]; ok {
+			product := product
+			entries = append(entries, p.entry(internal.AuditDelete, &product, nil))
+		}
+	}
+
+	err = p.record(ctx, entries...)
+	return
+}
+
+// stored returns the stored product, nil when it does not exist
+func (p *ProductAudited) stored(ctx context.Context, id int) (product *internal.Product, err error) {
+	stored, err := p.sv.GetByID(ctx, id)
+	switch {
+	case err == nil:
+		product = &stored
+	case errors.Is(err, internal.ErrProductNotFound):
+		err = nil
+	}
+	return
+}
+
+// all returns the stored products, in the order of their IDs
+func (p *ProductAudited) all(ctx context.Context) (products []internal.Product, err error) {
+	products, _, err = p.sv.GetAll(ctx, internal.ProductQuery{})
+	if errors.Is(err, internal.ErrProductsEmpty) {
+		err = nil
+	}
+	return
+}
+
+// entry returns the entry of a change, its time, actor and request ID are set when it is recorded
+func (p *ProductAudited) entry(operation string, before, after *internal.Product) (entry internal.AuditEntry) {
+	entry = internal.AuditEntry{Operation: operation, Before: before, After: after}
+	if after != nil {
+		entry.ProductID = after.ID
+	} else {
+		entry.ProductID = before.ID
+	}
+	return
+}
+
+// record appends the entries into the log. Undoing a committed change could fail as well, so it is
+// reported as made and its entries are kept until the log records them
+func (p *ProductAudited) record(ctx context.Context, entries ...internal.AuditEntry) (err error) {
+	if len(entries) == 0 {
+		return
+	}
+
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		principal = auth.Anonymous
+	}
+
+	now := p.now().UTC()
+	for index := range entries {
+		entries[index].Time = now
+		entries[index].Actor = principal.Name
+		entries[index].RequestID = middleware.GetReqID(ctx)
+	}
+
+	if appendErr := p.log.Append(entries); appendErr != nil {
+		log.Printf("audit: %d entries of the request %s not recorded, the writes are refused until they are: %v", len(entries), middleware.GetReqID(ctx), appendErr)
+		p.pending = append(p.pending, entries...)
+	}
+	return
+}
+
+// ready records the pending entries, a write can't be made until they are
+func (p *ProductAudited) ready() (err error) {
+	if len(p.pending) == 0 {
+		return
+	}
+
+	if err = p.log.Append(p.pending); err != nil {
+		err = fmt.Errorf("%w: %v", internal.ErrAuditUnavailable, err)
+		return
+	}
+
+	p.pending = nil
+	return
+}
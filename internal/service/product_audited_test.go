@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/auth"
+	"github.com/edwinbm5/go-product-web/internal/repository"
+	"github.com/edwinbm5/go-product-web/internal/storage"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func newTestProduct(code string) internal.Product {
+	return internal.Product{
+		Name:       "Product " + code,
+		Quantity:   1,
+		CodeValue:  code,
+		Expiration: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Price:      10,
+	}
+}
+
+// newAuditedContext returns the context of a request made by the principal
+func newAuditedContext(name, requestID string) context.Context {
+	ctx := auth.NewContext(context.Background(), auth.Principal{Name: name})
+	return context.WithValue(ctx, middleware.RequestIDKey, requestID)
+}
+
+// auditOperation is what an audit entry records, without its time and products
+type auditOperation struct {
+	Actor     string
+	RequestID string
+	Operation string
+	ProductID int
+}
+
+// auditOperations returns the operations of the log, the oldest first
+func auditOperations(t *testing.T, audit *storage.AuditFile) (operations []auditOperation) {
+	entries, err := audit.Query(internal.AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index := len(entries) - 1; index >= 0; index-- {
+		entry := entries[index]
+		operations = append(operations, auditOperation{Actor: entry.Actor, RequestID: entry.RequestID, Operation: entry.Operation, ProductID: entry.ProductID})
+	}
+	return
+}
+
+// TestProductAudited_Batch checks that every write of a batch is recorded with the principal and
+// the request that made it, and that the failed writes are not
+func TestProductAudited_Batch(t *testing.T) {
+	audit := storage.NewAuditFile("")
+	sv := NewProductAudited(NewDefaultProduct(repository.NewProductMap(nil, 0), nil), audit)
+
+	product := newTestProduct("A")
+	if err := sv.Create(newAuditedContext("admin", "req-1"), &product); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := sv.Batch(newAuditedContext("editor", "req-2"), []internal.ProductWrite{
+		{Type: internal.ProductWriteCreate, Product: newTestProduct("B")},
+		{Type: internal.ProductWritePatch, ID: product.ID, Patch: internal.ProductMergePatch{"quantity": float64(7)}},
+		{Type: internal.ProductWriteDelete, ID: 99},
+		{Type: internal.ProductWriteDelete, ID: product.ID},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[2].Err == nil {
+		t.Fatalf("got %+v, want the delete of an unknown product to fail", results[2])
+	}
+
+	want := []auditOperation{
+		{Actor: "admin", RequestID: "req-1", Operation: internal.AuditCreate, ProductID: 1},
+		{Actor: "editor", RequestID: "req-2", Operation: internal.AuditCreate, ProductID: 2},
+		{Actor: "editor", RequestID: "req-2", Operation: internal.AuditUpdate, ProductID: 1},
+		{Actor: "editor", RequestID: "req-2", Operation: internal.AuditDelete, ProductID: 1},
+	}
+	if got := auditOperations(t, audit); !slices.Equal(got, want) {
+		t.Fatalf("got operations %+v, want %+v", got, want)
+	}
+
+	// the update records the fields it changed only
+	entries, _ := audit.Query(internal.AuditQuery{ProductID: product.ID, Limit: 2})
+	if changes := entries[1].Changes(); len(changes) != 1 || changes[0] != "quantity" {
+		t.Fatalf("got changes %v, want [quantity]", changes)
+	}
+}
+
+// TestProductAudited_Import checks that the products created, updated and deleted by an import are
+// recorded with the principal of the import, and that a dry run records nothing
+func TestProductAudited_Import(t *testing.T) {
+	audit := storage.NewAuditFile("")
+	sv := NewProductAudited(NewDefaultProduct(repository.NewProductMap(nil, 0), nil), audit)
+
+	for _, code := range []string{"A", "B"} {
+		product := newTestProduct(code)
+		if err := sv.Create(newAuditedContext("admin", "req-1"), &product); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	updated := newTestProduct("A")
+	updated.Quantity = 9
+	rows := []internal.ProductRow{{Line: 2, Product: updated}, {Line: 3, Product: newTestProduct("C")}}
+
+	ctx := newAuditedContext("importer", "req-2")
+	if _, err := sv.Import(ctx, internal.ProductImport{Rows: rows, Strategy: internal.ProductImportReplace, DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	if operations := auditOperations(t, audit); len(operations) != 2 {
+		t.Fatalf("got operations %+v after a dry run, want the 2 creates", operations)
+	}
+
+	if _, err := sv.Import(ctx, internal.ProductImport{Rows: rows, Strategy: internal.ProductImportReplace}); err != nil {
+		t.Fatal(err)
+	}
+
+	// replace deletes the stored products and creates the imported ones
+	want := []auditOperation{
+		{Actor: "importer", RequestID: "req-2", Operation: internal.AuditCreate, ProductID: 3},
+		{Actor: "importer", RequestID: "req-2", Operation: internal.AuditCreate, ProductID: 4},
+		{Actor: "importer", RequestID: "req-2", Operation: internal.AuditDelete, ProductID: 1},
+		{Actor: "importer", RequestID: "req-2", Operation: internal.AuditDelete, ProductID: 2},
+	}
+	if got := auditOperations(t, audit)[2:]; !slices.Equal(got, want) {
+		t.Fatalf("got operations %+v, want %+v", got, want)
+	}
+}
+
+// failingAuditLog is an audit log whose appends fail while fail is set
+type failingAuditLog struct {
+	*storage.AuditFile
+	fail bool
+}
+
+func (l *failingAuditLog) Append(entries []internal.AuditEntry) (err error) {
+	if l.fail {
+		return errors.New("disk full")
+	}
+	return l.AuditFile.Append(entries)
+}
+
+// TestProductAudited_AppendFailure checks that a change the log can't record is reported as made,
+// that no other change is made until its entry is recorded, and that the entry is not lost
+func TestProductAudited_AppendFailure(t *testing.T) {
+	audit := &failingAuditLog{AuditFile: storage.NewAuditFile("")}
+	sv := NewProductAudited(NewDefaultProduct(repository.NewProductMap(nil, 0), nil), audit)
+	ctx := newAuditedContext("admin", "req-1")
+
+	audit.fail = true
+	product := newTestProduct("A")
+	if err := sv.Create(ctx, &product); err != nil {
+		t.Fatalf("got error %v, want the create reported as made", err)
+	}
+
+	refused := newTestProduct("B")
+	if err := sv.Create(ctx, &refused); !errors.Is(err, internal.ErrAuditUnavailable) {
+		t.Fatalf("got error %v, want %v", err, internal.ErrAuditUnavailable)
+	}
+	if _, total, err := sv.GetAll(ctx, internal.ProductQuery{}); err != nil || total != 1 {
+		t.Fatalf("got %d products and error %v, want the create refused", total, err)
+	}
+
+	audit.fail = false
+	if err := sv.Delete(ctx, product.ID, internal.ProductCondition{}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []auditOperation{
+		{Actor: "admin", RequestID: "req-1", Operation: internal.AuditCreate, ProductID: product.ID},
+		{Actor: "admin", RequestID: "req-1", Operation: internal.AuditDelete, ProductID: product.ID},
+	}
+	if got := auditOperations(t, audit.AuditFile); !slices.Equal(got, want) {
+		t.Fatalf("got operations %+v, want %+v", got, want)
+	}
+}
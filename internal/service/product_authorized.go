@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/auth"
+)
+
+// ProductAuthorized is a service that checks the principal of the context against a policy
+// before calling another service. Contexts without a principal are anonymous
+type ProductAuthorized struct {
+	sv     internal.ProductService
+	policy auth.Policy
+}
+
+// NewProductAuthorized creates a new ProductAuthorized service
+func NewProductAuthorized(sv internal.ProductService, policy auth.Policy) *ProductAuthorized {
+	return &ProductAuthorized{
+		sv:     sv,
+		policy: policy,
+	}
+}
+
+// GetAll returns the products in the database that match the query
+func (p *ProductAuthorized) GetAll(ctx context.Context, query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsList); err != nil {
+		return
+	}
+
+	products, total, err = p.sv.GetAll(ctx, query)
+	return
+}
+
+// Search returns the products whose name or code value match the text
+func (p *ProductAuthorized) Search(ctx context.Context, text string, query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsList); err != nil {
+		return
+	}
+
+	products, total, err = p.sv.Search(ctx, text, query)
+	return
+}
+
+// GetExpiring returns the page of the products that expire within the given duration, and their groups
+func (p *ProductAuthorized) GetExpiring(ctx context.Context, within time.Duration, query internal.ProductQuery) (products []internal.Product, groups []internal.ExpirationGroup, total int, err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsList); err != nil {
+		return
+	}
+
+	products, groups, total, err = p.sv.GetExpiring(ctx, within, query)
+	return
+}
+
+// GetExpired returns the page of the products whose expiration date already passed, and their groups
+func (p *ProductAuthorized) GetExpired(ctx context.Context, query internal.ProductQuery) (products []internal.Product, groups []internal.ExpirationGroup, total int, err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsList); err != nil {
+		return
+	}
+
+	products, groups, total, err = p.sv.GetExpired(ctx, query)
+	return
+}
+
+// GetByID returns a product by its ID
+func (p *ProductAuthorized) GetByID(ctx context.Context, id int) (product internal.Product, err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsGet); err != nil {
+		return
+	}
+
+	product, err = p.sv.GetByID(ctx, id)
+	return
+}
+
+// Stream calls fn with every product that matches the query
+func (p *ProductAuthorized) Stream(ctx context.Context, query internal.ProductQuery, fn func(product internal.Product) error) (err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsList); err != nil {
+		return
+	}
+
+	err = p.sv.Stream(ctx, query, fn)
+	return
+}
+
+// Watch calls fn with the events of the query, the permission is checked once when the watch starts
+func (p *ProductAuthorized) Watch(ctx context.Context, query internal.ProductEventQuery, fn func(events []internal.ProductEvent) error) (err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsList); err != nil {
+		return
+	}
+
+	err = p.sv.Watch(ctx, query, fn)
+	return
+}
+
+// Creates a new product in the database
+func (p *ProductAuthorized) Create(ctx context.Context, product *internal.Product) (err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsCreate); err != nil {
+		return
+	}
+
+	err = p.sv.Create(ctx, product)
+	return
+}
+
+// Updates a product in the database, if not exists, creates it, so both permissions are needed
+func (p *ProductAuthorized) UpdateAndCreate(ctx context.Context, product *internal.Product, condition internal.ProductCondition) (err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsUpdate); err != nil {
+		return
+	}
+
+	if err = p.authorize(ctx, auth.PermissionProductsCreate); err != nil {
+		return
+	}
+
+	err = p.sv.UpdateAndCreate(ctx, product, condition)
+	return
+}
+
+// Updates a product in the database
+func (p *ProductAuthorized) Update(ctx context.Context, id int, patch internal.ProductPatch, condition internal.ProductCondition) (product internal.Product, err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsUpdate); err != nil {
+		return
+	}
+
+	product, err = p.sv.Update(ctx, id, patch, condition)
+	return
+}
+
+// Deletes a product from the database
+func (p *ProductAuthorized) Delete(ctx context.Context, id int, condition internal.ProductCondition) (err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsDelete); err != nil {
+		return
+	}
+
+	err = p.sv.Delete(ctx, id, condition)
+	return
+}
+
+// GetTrash returns the deleted products that match the query, only to the principals that can delete them
+func (p *ProductAuthorized) GetTrash(ctx context.Context, query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsDelete); err != nil {
+		return
+	}
+
+	products, total, err = p.sv.GetTrash(ctx, query)
+	return
+}
+
+// Restore moves a product back from the trash, undoing a delete needs the permission to delete
+func (p *ProductAuthorized) Restore(ctx context.Context, id int) (product internal.Product, err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsDelete); err != nil {
+		return
+	}
+
+	product, err = p.sv.Restore(ctx, id)
+	return
+}
+
+// Batch checks the permissions of every write. The denied writes fail on their own, unless the batch is
+// atomic, in which case no write is applied
+func (p *ProductAuthorized) Batch(ctx context.Context, writes []internal.ProductWrite, atomic bool) (results []internal.ProductWriteResult, err error) {
+	denied := make([]error, len(writes))
+	allowed := make([]internal.ProductWrite, 0, len(writes))
+	for index, write := range writes {
+		if denied[index] = p.authorizeWrite(ctx, write); denied[index] == nil {
+			allowed = append(allowed, write)
+			continue
+		}
+
+		if atomic {
+			err = &internal.ProductBatchError{Index: index, Err: denied[index]}
+			results = internal.NewProductBatchResults(len(writes), err)
+			return
+		}
+	}
+
+	allowedResults, err := p.sv.Batch(ctx, allowed, atomic)
+	// a service returns a result per write even when the batch fails, or else every write fails with the error
+	if len(allowedResults) != len(allowed) {
+		allowedResults = internal.NewProductBatchResults(len(allowed), err)
+	}
+
+	// the results of the allowed writes are put back in the place of their write
+	results = make([]internal.ProductWriteResult, len(writes))
+	for index := range writes {
+		if denied[index] != nil {
+			results[index].Err = denied[index]
+			continue
+		}
+
+		results[index], allowedResults = allowedResults[0], allowedResults[1:]
+	}
+	return
+}
+
+// Import applies the rows of an import, a replace also needs the permission to delete
+func (p *ProductAuthorized) Import(ctx context.Context, imp internal.ProductImport) (report internal.ProductImportReport, err error) {
+	if err = p.authorize(ctx, auth.PermissionProductsImport); err != nil {
+		return
+	}
+
+	if imp.Strategy == internal.ProductImportReplace {
+		if err = p.authorize(ctx, auth.PermissionProductsDelete); err != nil {
+			return
+		}
+	}
+
+	report, err = p.sv.Import(ctx, imp)
+	return
+}
+
+// authorizeWrite checks the permissions of a write of a batch
+func (p *ProductAuthorized) authorizeWrite(ctx context.Context, write internal.ProductWrite) (err error) {
+	switch write.Type {
+	case internal.ProductWriteCreate:
+		err = p.authorize(ctx, auth.PermissionProductsCreate)
+	case internal.ProductWriteUpsert:
+		if err = p.authorize(ctx, auth.PermissionProductsUpdate); err == nil {
+			err = p.authorize(ctx, auth.PermissionProductsCreate)
+		}
+	case internal.ProductWritePatch:
+		err = p.authorize(ctx, auth.PermissionProductsUpdate)
+	case internal.ProductWriteDelete, internal.ProductWritePurge:
+		err = p.authorize(ctx, auth.PermissionProductsDelete)
+	}
+	return
+}
+
+// authorize checks the permission of the principal of the context
+func (p *ProductAuthorized) authorize(ctx context.Context, permission string) (err error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		principal = auth.Anonymous
+	}
+
+	err = p.policy.Authorize(principal, permission)
+	return
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/auth"
+	"github.com/edwinbm5/go-product-web/internal/repository"
+)
+
+// newAuthorizedContext returns the context of a request made by a principal with the role
+func newAuthorizedContext(role string) context.Context {
+	return auth.NewContext(context.Background(), auth.Principal{Name: role, Roles: []string{role}})
+}
+
+// newTestAuthorized returns a service with the default policy over the products A and B
+func newTestAuthorized(t *testing.T) *ProductAuthorized {
+	sv := NewProductAuthorized(NewDefaultProduct(repository.NewProductMap(nil, 0), nil), auth.DefaultPolicy())
+	for _, code := range []string{"A", "B"} {
+		product := newTestProduct(code)
+		if err := sv.Create(newAuthorizedContext(auth.RoleAdmin), &product); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sv
+}
+
+// TestProductAuthorized_Roles checks the operations each role of the default policy is denied
+func TestProductAuthorized_Roles(t *testing.T) {
+	operations := map[string]func(sv *ProductAuthorized, ctx context.Context) error{
+		"get": func(sv *ProductAuthorized, ctx context.Context) (err error) {
+			_, err = sv.GetByID(ctx, 1)
+			return
+		},
+		"create": func(sv *ProductAuthorized, ctx context.Context) (err error) {
+			product := newTestProduct("C")
+			return sv.Create(ctx, &product)
+		},
+		"update": func(sv *ProductAuthorized, ctx context.Context) (err error) {
+			_, err = sv.Update(ctx, 1, internal.ProductMergePatch{"quantity": float64(5)}, internal.ProductCondition{})
+			return
+		},
+		"delete": func(sv *ProductAuthorized, ctx context.Context) (err error) {
+			return sv.Delete(ctx, 2, internal.ProductCondition{})
+		},
+		"trash": func(sv *ProductAuthorized, ctx context.Context) (err error) {
+			_, _, err = sv.GetTrash(ctx, internal.ProductQuery{})
+			if errors.Is(err, internal.ErrProductsEmpty) {
+				err = nil
+			}
+			return
+		},
+	}
+
+	denied := map[string][]string{
+		auth.RoleAnonymous: {"create", "update", "delete", "trash"},
+		auth.RoleViewer:    {"create", "update", "delete", "trash"},
+		auth.RoleEditor:    {"delete", "trash"},
+		auth.RoleAdmin:     {},
+	}
+
+	for role, deniedOperations := range denied {
+		for name, operation := range operations {
+			sv := newTestAuthorized(t)
+			err := operation(sv, newAuthorizedContext(role))
+
+			want := false
+			for _, deniedOperation := range deniedOperations {
+				want = want || deniedOperation == name
+			}
+			if got := errors.Is(err, auth.ErrAuthForbidden); got != want || (!want && err != nil) {
+				t.Errorf("%s %s: got error %v, want denied %v", role, name, err, want)
+			}
+		}
+	}
+}
+
+// TestProductAuthorized_Batch checks that the denied writes of a batch fail on their own, and that
+// an atomic batch with a denied write applies none of them
+func TestProductAuthorized_Batch(t *testing.T) {
+	sv := newTestAuthorized(t)
+	ctx := newAuthorizedContext(auth.RoleEditor)
+
+	writes := []internal.ProductWrite{
+		{Type: internal.ProductWriteCreate, Product: newTestProduct("C")},
+		{Type: internal.ProductWriteDelete, ID: 1},
+		{Type: internal.ProductWritePatch, ID: 2, Patch: internal.ProductMergePatch{"quantity": float64(5)}},
+		{Type: internal.ProductWritePurge, ID: 2},
+	}
+
+	results, err := sv.Batch(ctx, writes, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for index, want := range []bool{false, true, false, true} {
+		if got := errors.Is(results[index].Err, auth.ErrAuthForbidden); got != want || (!want && results[index].Err != nil) {
+			t.Errorf("write %d: got error %v, want denied %v", index, results[index].Err, want)
+		}
+	}
+	if product, err := sv.GetByID(ctx, 2); err != nil || product.Quantity != 5 {
+		t.Fatalf("got product %+v and error %v, want the patch applied", product, err)
+	}
+
+	results, err = sv.Batch(ctx, []internal.ProductWrite{
+		{Type: internal.ProductWriteCreate, Product: newTestProduct("D")},
+		{Type: internal.ProductWriteDelete, ID: 1},
+	}, true)
+	var batchErr *internal.ProductBatchError
+	if !errors.As(err, &batchErr) || batchErr.Index != 1 || !errors.Is(batchErr.Err, auth.ErrAuthForbidden) {
+		t.Fatalf("got error %v, want the atomic batch aborted by the delete", err)
+	}
+	if len(results) != 2 || results[0].Err == nil {
+		t.Fatalf("got results %+v, want every write failed", results)
+	}
+	if _, total, _ := sv.GetAll(ctx, internal.ProductQuery{}); total != 3 {
+		t.Fatalf("got %d products, want the atomic batch not applied", total)
+	}
+}
+
+// TestProductAuthorized_Import checks that an import needs the import permission, and a replace
+// the delete permission as well
+func TestProductAuthorized_Import(t *testing.T) {
+	importer := auth.Policy{Roles: map[string][]string{
+		"importer": {auth.PermissionProductsImport},
+		"replacer": {auth.PermissionProductsImport, auth.PermissionProductsDelete},
+	}}
+	sv := NewProductAuthorized(NewDefaultProduct(repository.NewProductMap(nil, 0), nil), importer)
+	rows := []internal.ProductRow{{Line: 2, Product: newTestProduct("A")}}
+
+	tests := []struct {
+		role     string
+		strategy string
+		denied   bool
+	}{
+		{role: auth.RoleEditor, strategy: internal.ProductImportInsert, denied: true},
+		{role: "importer", strategy: internal.ProductImportUpsert},
+		{role: "importer", strategy: internal.ProductImportReplace, denied: true},
+		{role: "replacer", strategy: internal.ProductImportReplace},
+	}
+
+	for _, test := range tests {
+		_, err := sv.Import(newAuthorizedContext(test.role), internal.ProductImport{Rows: rows, Strategy: test.strategy, DryRun: true})
+		if got := errors.Is(err, auth.ErrAuthForbidden); got != test.denied || (!test.denied && err != nil) {
+			t.Errorf("%s %s: got error %v, want denied %v", test.role, test.strategy, err, test.denied)
+		}
+	}
+}
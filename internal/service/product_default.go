@@ -1,49 +1,531 @@
 package service
 
-import "github.com/edwinbm5/go-product-web/internal"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/auth"
+)
+
+// UpdateRetries is the number of times a patch is applied again when the product changes while it is patched
+const UpdateRetries = 5
+
+// StreamChunkSize is the number of products read from the repository at a time by Stream
+const StreamChunkSize = 100
+
+// WatchHeartbeat is how long Watch waits for new events before calling fn with no events
+const WatchHeartbeat = 15 * time.Second
+
+// Defaults of the trash
+const (
+	// TrashRetention is how long the deleted products are kept in the trash before they are purged
+	TrashRetention = 30 * 24 * time.Hour
+	// TrashPurgeEvery is how often PurgeTrash looks for the products to purge
+	TrashPurgeEvery = time.Hour
+)
 
 type ProductDefault struct {
 	repository internal.ProductRepository
+	// events is the log of the events published by the repository, nil when they are not published
+	events internal.ProductEventLog
+	// now returns the current time, used to know which products are expired
+	now func() time.Time
+
+	TrashRetention time.Duration
 }
 
-// NewDefaultProduct creates a new ProductDefault service
-func NewDefaultProduct(repository internal.ProductRepository) *ProductDefault {
+// NewDefaultProduct creates a new ProductDefault service with the default retention of the trash,
+// events can be nil when the repository does not publish its changes
+func NewDefaultProduct(repository internal.ProductRepository, events internal.ProductEventLog) *ProductDefault {
 	return &ProductDefault{
-		repository: repository,
+		repository:     repository,
+		events:         events,
+		now:            time.Now,
+		TrashRetention: TrashRetention,
 	}
 }
 
-// GetAll returns all the products in the database
-func (p *ProductDefault) GetAll() (products []internal.Product, err error) {
-	products, err = p.repository.GetAll()
+// GetAll returns the products in the database that match the query
+func (p *ProductDefault) GetAll(ctx context.Context, query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	products, total, err = p.repository.GetAll(query)
+	return
+}
+
+// Search returns the products whose name or code value match the text
+func (p *ProductDefault) Search(ctx context.Context, text string, query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	products, total, err = p.repository.Search(text, query)
+	return
+}
+
+// GetExpiring returns the page of the products that are not expired yet but expire within the given
+// duration, by default sorted by expiration, and the groups of all of them. The expiration filters of
+// the query are replaced
+func (p *ProductDefault) GetExpiring(ctx context.Context, within time.Duration, query internal.ProductQuery) (products []internal.Product, groups []internal.ExpirationGroup, total int, err error) {
+	today := p.today()
+	after := today.AddDate(0, 0, -1)
+	before := today.Add(within).Truncate(24*time.Hour).AddDate(0, 0, 1)
+
+	query.ExpiresAfter = &after
+	query.ExpiresBefore = &before
+	if len(query.Sort) == 0 {
+		query.Sort = []internal.ProductSort{{Field: "expiration"}}
+	}
+
+	products, groups, total, err = p.grouped(query)
+	return
+}
+
+// GetExpired returns the page of the products whose expiration date already passed, by default sorted
+// by expiration, and the groups of all of them. The expiration filters of the query are replaced
+func (p *ProductDefault) GetExpired(ctx context.Context, query internal.ProductQuery) (products []internal.Product, groups []internal.ExpirationGroup, total int, err error) {
+	today := p.today()
+
+	query.ExpiresAfter = nil
+	query.ExpiresBefore = &today
+	if len(query.Sort) == 0 {
+		query.Sort = []internal.ProductSort{{Field: "expiration"}}
+	}
+
+	products, groups, total, err = p.grouped(query)
+	return
+}
+
+// grouped reads the products of the query without its page, groups all of them and returns the page
+func (p *ProductDefault) grouped(query internal.ProductQuery) (products []internal.Product, groups []internal.ExpirationGroup, total int, err error) {
+	page := internal.ProductQuery{Page: query.Page, PageSize: query.PageSize}
+	query.Page, query.PageSize = 0, 0
+
+	all, total, err := p.repository.GetAll(query)
+	if err != nil {
+		return
+	}
+
+	groups = p.GroupByDaysRemaining(all)
+	products, _ = page.Apply(all)
+	return
+}
+
+// GroupByDaysRemaining groups the products by the days remaining until they expire, sorted by days remaining
+func (p *ProductDefault) GroupByDaysRemaining(products []internal.Product) (groups []internal.ExpirationGroup) {
+	today := p.today()
+
+	positions := make(map[int]int)
+	for _, product := range products {
+		days := int(product.Expiration.Sub(today).Hours() / 24)
+
+		index, ok := positions[days]
+		if !ok {
+			index = len(groups)
+			positions[days] = index
+			groups = append(groups, internal.ExpirationGroup{DaysRemaining: days})
+		}
+		groups[index].Products = append(groups[index].Products, product)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].DaysRemaining < groups[j].DaysRemaining
+	})
+
 	return
 }
 
+// today returns the current date at midnight UTC, as the expiration dates
+func (p *ProductDefault) today() time.Time {
+	year, month, day := p.now().UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
 // GetByID returns a product by its ID
-func (p *ProductDefault) GetByID(id int) (product internal.Product, err error) {
+func (p *ProductDefault) GetByID(ctx context.Context, id int) (product internal.Product, err error) {
 	product, err = p.repository.GetByID(id)
 	return
 }
 
+// Stream calls fn with the products that match the query, a chunk at a time. The repository is not
+// locked while fn runs, so the products written meanwhile are streamed if they come after the cursor
+func (p *ProductDefault) Stream(ctx context.Context, query internal.ProductQuery, fn func(product internal.Product) error) (err error) {
+	after := 0
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		var products []internal.Product
+		if products, err = p.repository.Cursor(after, StreamChunkSize, query); err != nil {
+			return
+		}
+
+		for _, product := range products {
+			if err = fn(product); err != nil {
+				return
+			}
+		}
+
+		if len(products) < StreamChunkSize {
+			return
+		}
+		after = products[len(products)-1].ID
+	}
+}
+
+// Watch reads the events of the log after the last one sent, and waits for the log to change
+// between the reads. Without query.After, only the events published after the call are sent
+func (p *ProductDefault) Watch(ctx context.Context, query internal.ProductEventQuery, fn func(events []internal.ProductEvent) error) (err error) {
+	if p.events == nil {
+		err = fmt.Errorf("%w: the events are not published", internal.ErrProductInternal)
+		return
+	}
+
+	after := query.After
+	if after == 0 {
+		after = p.events.Last()
+	}
+
+	// fn is called at once, then on the events of the query or when the heartbeat is due
+	var called time.Time
+	for {
+		// the channel is taken before the read, so an event appended in between is not missed
+		changed := p.events.Changed()
+
+		var events []internal.ProductEvent
+		if events, err = p.events.Since(after); err != nil {
+			return
+		}
+
+		matched := make([]internal.ProductEvent, 0, len(events))
+		for _, event := range events {
+			if query.Match(event) {
+				matched = append(matched, event)
+			}
+		}
+
+		if len(events) > 0 {
+			after = events[len(events)-1].Sequence
+		}
+
+		if len(matched) > 0 || time.Since(called) >= WatchHeartbeat {
+			if err = fn(matched); err != nil {
+				return
+			}
+			called = time.Now()
+		}
+
+		heartbeat := time.NewTimer(WatchHeartbeat - time.Since(called))
+		select {
+		case <-ctx.Done():
+			heartbeat.Stop()
+			err = ctx.Err()
+			return
+		case <-changed:
+			heartbeat.Stop()
+		case <-heartbeat.C:
+		}
+	}
+}
+
 // Creates a new product in the database
-func (p *ProductDefault) Create(product *internal.Product) (err error) {
+func (p *ProductDefault) Create(ctx context.Context, product *internal.Product) (err error) {
+	if err = internal.ValidateProduct(*product); err != nil {
+		return
+	}
+
 	err = p.repository.Create(product)
 	return
 }
 
 // Updates a product in the database, if not exists, creates it
-func (p *ProductDefault) UpdateAndCreate(product *internal.Product) (err error) {
-	err = p.repository.UpdateAndCreate(product)
+func (p *ProductDefault) UpdateAndCreate(ctx context.Context, product *internal.Product, condition internal.ProductCondition) (err error) {
+	if err = internal.ValidateProduct(*product); err != nil {
+		return
+	}
+
+	err = p.repository.UpdateAndCreate(product, condition)
+	return
+}
+
+// Updates a product in the database with a patch, the patched product is validated before it is saved.
+// The product is only saved if it was not changed since it was read, a concurrent change is retried
+// by patching the product again
+func (p *ProductDefault) Update(ctx context.Context, id int, patch internal.ProductPatch, condition internal.ProductCondition) (product internal.Product, err error) {
+	for attempt := 0; ; attempt++ {
+		stored, getErr := p.repository.GetByID(id)
+		if getErr != nil {
+			err = getErr
+			return
+		}
+
+		if !condition.Met(&stored) {
+			err = fmt.Errorf("%w: The product with ID %d is at version %d", internal.ErrProductCondition, id, stored.Version)
+			return
+		}
+
+		if product, err = patch.Apply(stored); err != nil {
+			return
+		}
+
+		if err = internal.ValidateProduct(product); err != nil {
+			return
+		}
+
+		err = p.repository.Update(&product, internal.ProductCondition{IfMatch: []int{stored.Version}})
+		if !errors.Is(err, internal.ErrProductCondition) || attempt == UpdateRetries {
+			return
+		}
+	}
+}
+
+// Delete moves a product to the trash, marked with the principal of the context
+func (p *ProductDefault) Delete(ctx context.Context, id int, condition internal.ProductCondition) (err error) {
+	err = p.repository.Delete(id, condition, p.deletion(ctx))
+	return
+}
+
+// GetTrash returns the deleted products that match the query
+func (p *ProductDefault) GetTrash(ctx context.Context, query internal.ProductQuery) (products []internal.Product, total int, err error) {
+	products, total, err = p.repository.GetTrash(query)
+	return
+}
+
+// Restore moves a product back from the trash
+func (p *ProductDefault) Restore(ctx context.Context, id int) (product internal.Product, err error) {
+	product, err = p.repository.Restore(id)
+	return
+}
+
+// PurgeTrash removes the products kept in the trash longer than the retention, at once and every
+// TrashPurgeEvery until ctx is done
+func (p *ProductDefault) PurgeTrash(ctx context.Context) {
+	for {
+		products, err := p.repository.Purge(p.now().Add(-p.TrashRetention))
+		switch {
+		case err != nil:
+			fmt.Println("trash:", err)
+		case len(products) > 0:
+			fmt.Println("trash:", len(products), "products purged")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(TrashPurgeEvery):
+		}
+	}
+}
+
+// deletion returns the deletion of the products deleted now by the principal of the context
+func (p *ProductDefault) deletion(ctx context.Context) internal.ProductDeletion {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		principal = auth.Anonymous
+	}
+
+	return internal.ProductDeletion{At: p.now().UTC(), By: principal.Name}
+}
+
+// Batch applies the writes one by one, or all or none of them if the batch is atomic
+func (p *ProductDefault) Batch(ctx context.Context, writes []internal.ProductWrite, atomic bool) (results []internal.ProductWriteResult, err error) {
+	if !atomic {
+		results = make([]internal.ProductWriteResult, len(writes))
+		for index, write := range writes {
+			results[index] = p.write(ctx, write)
+		}
+		return
+	}
+
+	// the products are validated before the batch is applied, and the patched products once they are patched
+	batch := make([]internal.ProductWrite, len(writes))
+	for index, write := range writes {
+		switch write.Type {
+		case internal.ProductWriteCreate, internal.ProductWriteUpsert:
+			if validateErr := internal.ValidateProduct(write.Product); validateErr != nil {
+				err = &internal.ProductBatchError{Index: index, Err: validateErr}
+				results = internal.NewProductBatchResults(len(writes), err)
+				return
+			}
+		case internal.ProductWritePatch:
+			write.Patch = validatedPatch{patch: write.Patch}
+		case internal.ProductWriteDelete:
+			write.Deletion = p.deletion(ctx)
+		}
+		batch[index] = write
+	}
+
+	products, err := p.repository.Batch(batch)
+	if err != nil {
+		results = internal.NewProductBatchResults(len(writes), err)
+		return
+	}
+
+	results = make([]internal.ProductWriteResult, len(products))
+	for index, product := range products {
+		results[index].Product = product
+	}
+	return
+}
+
+// write applies a single write of a batch
+func (p *ProductDefault) write(ctx context.Context, write internal.ProductWrite) (result internal.ProductWriteResult) {
+	product := write.Product
+	switch write.Type {
+	case internal.ProductWriteCreate:
+		result.Err = p.Create(ctx, &product)
+	case internal.ProductWriteUpsert:
+		result.Err = p.UpdateAndCreate(ctx, &product, write.Condition)
+	case internal.ProductWritePatch:
+		product, result.Err = p.Update(ctx, write.ID, write.Patch, write.Condition)
+	case internal.ProductWriteDelete:
+		product = internal.Product{ID: write.ID}
+		result.Err = p.Delete(ctx, write.ID, write.Condition)
+	default:
+		result.Err = fmt.Errorf("%w: unknown write %q", internal.ErrProductBatchInvalid, write.Type)
+	}
+
+	if result.Err == nil {
+		result.Product = product
+	}
 	return
 }
 
-// Updates a product in the database
-func (p *ProductDefault) Update(id int, fields map[string]any) (err error) {
-	err = p.repository.Update(id, fields)
+// Import checks the rows of an import against the stored products and applies them in a single
+// batch. The deletes of a replace go first, so the imported products can reuse their code values:
+// the products whose code values are imported are purged, from the catalog and from the trash, and
+// the other products are moved to the trash
+func (p *ProductDefault) Import(ctx context.Context, imp internal.ProductImport) (report internal.ProductImportReport, err error) {
+	if !slices.Contains(internal.ProductImportStrategies, imp.Strategy) {
+		err = fmt.Errorf("%w: unknown strategy %q", internal.ErrProductImportInvalid, imp.Strategy)
+		return
+	}
+
+	stored, _, err := p.repository.GetAll(internal.ProductQuery{})
+	if err != nil && !errors.Is(err, internal.ErrProductsEmpty) {
+		return
+	}
+	err = nil
+
+	byCode := make(map[string]internal.Product, len(stored))
+	for _, product := range stored {
+		byCode[product.CodeValue] = product
+	}
+
+	// the stored products are written only if they did not change since they were read
+	var writes []internal.ProductWrite
+	var lines []int
+	if imp.Strategy == internal.ProductImportReplace {
+		if writes, err = p.replaced(ctx, stored, imp.Rows); err != nil {
+			return
+		}
+		lines = make([]int, len(writes))
+		report.Deleted = len(stored)
+	}
+
+	seen := make(map[string]int, len(imp.Rows))
+	for _, row := range imp.Rows {
+		rowErr := row.Err
+		if rowErr == nil {
+			rowErr = internal.ValidateProduct(row.Product)
+		}
+
+		existing, exists := byCode[row.Product.CodeValue]
+		switch first, repeated := seen[row.Product.CodeValue]; {
+		case rowErr != nil:
+		case repeated:
+			rowErr = fmt.Errorf("%w: The Code value %s is repeated, first on line %d", internal.ErrProductDuplicated, row.Product.CodeValue, first)
+		case exists && imp.Strategy == internal.ProductImportInsert:
+			rowErr = fmt.Errorf("%w: The Code value %s already exists", internal.ErrProductDuplicated, row.Product.CodeValue)
+		}
+
+		if rowErr != nil {
+			report.Errors = append(report.Errors, &internal.ProductRowError{Line: row.Line, Err: rowErr})
+			continue
+		}
+		seen[row.Product.CodeValue] = row.Line
+
+		write := internal.ProductWrite{Type: internal.ProductWriteCreate, Product: row.Product}
+		if exists && imp.Strategy == internal.ProductImportUpsert {
+			write.Type, write.Product.ID = internal.ProductWriteUpsert, existing.ID
+			write.Condition = internal.ProductCondition{IfMatch: []int{existing.Version}}
+			report.Updated++
+		} else {
+			report.Created++
+		}
+
+		writes = append(writes, write)
+		lines = append(lines, row.Line)
+	}
+
+	if len(report.Errors) > 0 {
+		if !imp.DryRun {
+			err = report.Errors
+		}
+		return
+	}
+
+	if imp.DryRun || len(writes) == 0 {
+		return
+	}
+
+	if _, err = p.repository.Batch(writes); err != nil {
+		// the failed write of a row is reported as an error of its line
+		var batchErr *internal.ProductBatchError
+		if errors.As(err, &batchErr) && lines[batchErr.Index] > 0 {
+			err = internal.ProductRowErrors{{Line: lines[batchErr.Index], Err: batchErr.Err}}
+		}
+		report = internal.ProductImportReport{}
+	}
+	return
+}
+
+// replaced returns the writes that clear the catalog before the rows of a replace are created. The
+// products and the products of the trash whose code values are imported are purged, so their code
+// values are free even when the code values of the trash are reserved
+func (p *ProductDefault) replaced(ctx context.Context, stored []internal.Product, rows []internal.ProductRow) (writes []internal.ProductWrite, err error) {
+	imported := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		imported[row.Product.CodeValue] = true
+	}
+
+	deletion := p.deletion(ctx)
+	for _, product := range stored {
+		write := internal.ProductWrite{
+			Type:      internal.ProductWriteDelete,
+			ID:        product.ID,
+			Condition: internal.ProductCondition{IfMatch: []int{product.Version}},
+			Deletion:  deletion,
+		}
+		if imported[product.CodeValue] {
+			write.Type = internal.ProductWritePurge
+		}
+		writes = append(writes, write)
+	}
+
+	trash, _, err := p.repository.GetTrash(internal.ProductQuery{})
+	if err != nil {
+		return
+	}
+
+	for _, product := range trash {
+		if imported[product.CodeValue] {
+			writes = append(writes, internal.ProductWrite{Type: internal.ProductWritePurge, ID: product.ID})
+		}
+	}
 	return
 }
 
-func (p *ProductDefault) Delete(id int) (err error) {
-	err = p.repository.Delete(id)
+// validatedPatch is a patch whose patched products are validated
+type validatedPatch struct {
+	patch internal.ProductPatch
+}
+
+func (v validatedPatch) Apply(product internal.Product) (patched internal.Product, err error) {
+	if patched, err = v.patch.Apply(product); err != nil {
+		return
+	}
+
+	err = internal.ValidateProduct(patched)
 	return
 }
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/repository"
+)
+
+// TestProductDefault_ImportReplace checks that a replace imports the code values of the products it
+// replaces and of the trash when the code values of the trash are reserved, as in an export of the
+// catalog imported back after a delete
+func TestProductDefault_ImportReplace(t *testing.T) {
+	rp := repository.NewProductMap(nil, 0)
+	rp.ReserveTrashedCodes = true
+	sv := NewDefaultProduct(rp, nil)
+	ctx := context.Background()
+
+	for _, code := range []string{"A", "B", "C", "D"} {
+		product := newTestProduct(code)
+		if err := sv.Create(ctx, &product); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sv.Delete(ctx, 3, internal.ProductCondition{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// C was deleted after the export, D was created after it
+	var rows []internal.ProductRow
+	for line, code := range []string{"A", "B", "C"} {
+		rows = append(rows, internal.ProductRow{Line: line + 2, Product: newTestProduct(code)})
+	}
+
+	report, err := sv.Import(ctx, internal.ProductImport{Rows: rows, Strategy: internal.ProductImportReplace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 3 || report.Deleted != 3 {
+		t.Fatalf("got report %+v, want 3 products created and 3 deleted", report)
+	}
+
+	products, _, err := sv.GetAll(ctx, internal.ProductQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var codes []string
+	for _, product := range products {
+		codes = append(codes, product.CodeValue)
+	}
+	if !slices.Equal(codes, []string{"A", "B", "C"}) {
+		t.Fatalf("got code values %v, want [A B C]", codes)
+	}
+
+	// the product not imported is in the trash and can be restored, the others were purged
+	trash, _, err := sv.GetTrash(ctx, internal.ProductQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].CodeValue != "D" {
+		t.Fatalf("got trash %+v, want the product D", trash)
+	}
+	if _, err := sv.Restore(ctx, trash[0].ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expirationDays returns the days remaining of the groups and the number of products of each
+func expirationDays(groups []internal.ExpirationGroup) (days, counts []int) {
+	for _, group := range groups {
+		days = append(days, group.DaysRemaining)
+		counts = append(counts, len(group.Products))
+	}
+	return
+}
+
+// TestProductDefault_Expiration checks the boundaries of the expiring and expired products and their
+// groups: a product expiring today is expiring and not expired, the last day within the duration is
+// included, and the groups count the products of every page
+func TestProductDefault_Expiration(t *testing.T) {
+	rp := repository.NewProductMap(nil, 0)
+	sv := NewDefaultProduct(rp, nil)
+	sv.now = func() time.Time { return time.Date(2026, 1, 10, 15, 30, 0, 0, time.UTC) }
+	ctx := context.Background()
+
+	for index, day := range []int{-10, -1, 0, 1, 1, 7, 8} {
+		product := newTestProduct(string(rune('A' + index)))
+		product.Expiration = time.Date(2026, 1, 10+day, 0, 0, 0, 0, time.UTC)
+		if err := sv.Create(ctx, &product); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		within time.Duration
+		total  int
+		days   []int
+		counts []int
+	}{
+		{name: "7 days", within: 7 * 24 * time.Hour, total: 4, days: []int{0, 1, 7}, counts: []int{1, 2, 1}},
+		{name: "36 hours", within: 36 * time.Hour, total: 3, days: []int{0, 1}, counts: []int{1, 2}},
+		{name: "1 hour", within: time.Hour, total: 1, days: []int{0}, counts: []int{1}},
+	}
+	for _, test := range tests {
+		products, groups, total, err := sv.GetExpiring(ctx, test.within, internal.ProductQuery{Page: 1, PageSize: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if total != test.total || len(products) != 1 || products[0].CodeValue != "C" {
+			t.Fatalf("%s: got total %d and page %+v, want %d products starting with C", test.name, total, products, test.total)
+		}
+		if days, counts := expirationDays(groups); !slices.Equal(days, test.days) || !slices.Equal(counts, test.counts) {
+			t.Fatalf("%s: got days %v with %v products, want %v with %v", test.name, days, counts, test.days, test.counts)
+		}
+	}
+
+	products, groups, total, err := sv.GetExpired(ctx, internal.ProductQuery{Page: 2, PageSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(products) != 1 || products[0].CodeValue != "B" {
+		t.Fatalf("got total %d and page %+v, want 2 products with B on the second page", total, products)
+	}
+	if days, counts := expirationDays(groups); !slices.Equal(days, []int{-10, -1}) || !slices.Equal(counts, []int{1, 1}) {
+		t.Fatalf("got days %v with %v products, want [-10 -1] with [1 1]", days, counts)
+	}
+}
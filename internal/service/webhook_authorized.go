@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/auth"
+)
+
+// WebhookAuthorized is a service that checks the permission to manage the webhooks before calling
+// another service, every operation needs it since the webhooks and their deliveries hold the events
+type WebhookAuthorized struct {
+	sv     internal.WebhookService
+	policy auth.Policy
+}
+
+// NewWebhookAuthorized creates a new WebhookAuthorized service
+func NewWebhookAuthorized(sv internal.WebhookService, policy auth.Policy) *WebhookAuthorized {
+	return &WebhookAuthorized{
+		sv:     sv,
+		policy: policy,
+	}
+}
+
+// GetAll returns all the webhooks
+func (w *WebhookAuthorized) GetAll(ctx context.Context) (webhooks []internal.Webhook, err error) {
+	if err = w.authorize(ctx); err != nil {
+		return
+	}
+
+	webhooks, err = w.sv.GetAll(ctx)
+	return
+}
+
+// GetByID returns a webhook by its ID
+func (w *WebhookAuthorized) GetByID(ctx context.Context, id int) (webhook internal.Webhook, err error) {
+	if err = w.authorize(ctx); err != nil {
+		return
+	}
+
+	webhook, err = w.sv.GetByID(ctx, id)
+	return
+}
+
+// Create saves a new webhook
+func (w *WebhookAuthorized) Create(ctx context.Context, webhook *internal.Webhook) (err error) {
+	if err = w.authorize(ctx); err != nil {
+		return
+	}
+
+	err = w.sv.Create(ctx, webhook)
+	return
+}
+
+// Update replaces a webhook
+func (w *WebhookAuthorized) Update(ctx context.Context, webhook *internal.Webhook) (err error) {
+	if err = w.authorize(ctx); err != nil {
+		return
+	}
+
+	err = w.sv.Update(ctx, webhook)
+	return
+}
+
+// Delete removes a webhook and its deliveries
+func (w *WebhookAuthorized) Delete(ctx context.Context, id int) (err error) {
+	if err = w.authorize(ctx); err != nil {
+		return
+	}
+
+	err = w.sv.Delete(ctx, id)
+	return
+}
+
+// Deliveries returns the deliveries that match the query
+func (w *WebhookAuthorized) Deliveries(ctx context.Context, query internal.WebhookDeliveryQuery) (deliveries []internal.WebhookDelivery, err error) {
+	if err = w.authorize(ctx); err != nil {
+		return
+	}
+
+	deliveries, err = w.sv.Deliveries(ctx, query)
+	return
+}
+
+// Redeliver queues a delivery again
+func (w *WebhookAuthorized) Redeliver(ctx context.Context, id int) (delivery internal.WebhookDelivery, err error) {
+	if err = w.authorize(ctx); err != nil {
+		return
+	}
+
+	delivery, err = w.sv.Redeliver(ctx, id)
+	return
+}
+
+// authorize checks the permission of the principal of the context
+func (w *WebhookAuthorized) authorize(ctx context.Context) (err error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		principal = auth.Anonymous
+	}
+
+	err = w.policy.Authorize(principal, auth.PermissionWebhooksManage)
+	return
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+type WebhookDefault struct {
+	repository internal.WebhookRepository
+	// now returns the current time, used for the dates of the webhooks and the redeliveries
+	now func() time.Time
+}
+
+// NewWebhookDefault creates a new WebhookDefault service
+func NewWebhookDefault(repository internal.WebhookRepository) *WebhookDefault {
+	return &WebhookDefault{
+		repository: repository,
+		now:        time.Now,
+	}
+}
+
+// GetAll returns all the webhooks
+func (w *WebhookDefault) GetAll(ctx context.Context) (webhooks []internal.Webhook, err error) {
+	webhooks, err = w.repository.GetAll()
+	return
+}
+
+// GetByID returns a webhook by its ID
+func (w *WebhookDefault) GetByID(ctx context.Context, id int) (webhook internal.Webhook, err error) {
+	webhook, err = w.repository.GetByID(id)
+	return
+}
+
+// Create validates and saves a new webhook, a secret is generated when it has none
+func (w *WebhookDefault) Create(ctx context.Context, webhook *internal.Webhook) (err error) {
+	if webhook.Secret == "" {
+		if webhook.Secret, err = newWebhookSecret(); err != nil {
+			return
+		}
+	}
+
+	if err = internal.ValidateWebhook(*webhook); err != nil {
+		return
+	}
+
+	webhook.CreatedAt = w.now().UTC()
+	webhook.UpdatedAt = webhook.CreatedAt
+	err = w.repository.Create(webhook)
+	return
+}
+
+// Update replaces a webhook, the secret and the creation date are kept from the stored webhook
+func (w *WebhookDefault) Update(ctx context.Context, webhook *internal.Webhook) (err error) {
+	stored, err := w.repository.GetByID(webhook.ID)
+	if err != nil {
+		return
+	}
+
+	if webhook.Secret == "" {
+		webhook.Secret = stored.Secret
+	}
+
+	if err = internal.ValidateWebhook(*webhook); err != nil {
+		return
+	}
+
+	webhook.CreatedAt = stored.CreatedAt
+	webhook.UpdatedAt = w.now().UTC()
+	err = w.repository.Update(webhook)
+	return
+}
+
+// Delete removes a webhook and its deliveries
+func (w *WebhookDefault) Delete(ctx context.Context, id int) (err error) {
+	err = w.repository.Delete(id)
+	return
+}
+
+// Deliveries returns the deliveries that match the query, the webhook of the query must exist
+func (w *WebhookDefault) Deliveries(ctx context.Context, query internal.WebhookDeliveryQuery) (deliveries []internal.WebhookDelivery, err error) {
+	if query.Status != "" && !slices.Contains(internal.WebhookDeliveryStatuses, query.Status) {
+		err = &tools.FieldError{Field: "status", Msg: "must be " + strings.Join(internal.WebhookDeliveryStatuses, ", ")}
+		return
+	}
+
+	if query.WebhookID != 0 {
+		if _, err = w.repository.GetByID(query.WebhookID); err != nil {
+			return
+		}
+	}
+
+	deliveries, err = w.repository.Deliveries(query)
+	return
+}
+
+// Redeliver queues a delivery again to be attempted at once, with its failures reset
+func (w *WebhookDefault) Redeliver(ctx context.Context, id int) (delivery internal.WebhookDelivery, err error) {
+	if delivery, err = w.repository.GetDelivery(id); err != nil {
+		return
+	}
+
+	if delivery.Status == internal.WebhookDeliveryPending {
+		err = fmt.Errorf("%w: The delivery with ID %d is still being attempted", internal.ErrWebhookDeliveryPending, id)
+		return
+	}
+
+	delivery.Status = internal.WebhookDeliveryPending
+	delivery.Failures = 0
+	delivery.NextAttempt = w.now().UTC()
+	err = w.repository.SaveDelivery(&delivery)
+	return
+}
+
+// newWebhookSecret generates a random secret for the signatures
+func newWebhookSecret() (secret string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		err = fmt.Errorf("%w: %v", internal.ErrProductInternal, err)
+		return
+	}
+
+	secret = "whsec_" + hex.EncodeToString(b)
+	return
+}
@@ -0,0 +1,384 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
+
+// Defaults of the WebhookDispatcher
+const (
+	// WebhookMaxAttempts is the number of failed attempts after which a delivery is dead
+	WebhookMaxAttempts = 10
+	// WebhookBackoff is the wait after the first failed attempt, doubled after each failure
+	WebhookBackoff = 30 * time.Second
+	// WebhookMaxBackoff is the longest wait between two attempts
+	WebhookMaxBackoff = time.Hour
+	// WebhookTimeout is how long a subscriber has to answer
+	WebhookTimeout = 10 * time.Second
+	// WebhookWorkers is the number of deliveries attempted at the same time
+	WebhookWorkers = 8
+	// WebhookPoll is how often the queue is checked for the deliveries due
+	WebhookPoll = time.Second
+)
+
+// Headers of the requests sent to the subscribers. The signature is the HMAC-SHA256 of the timestamp,
+// a dot and the body, with the secret of the webhook, as "sha256=" and the hex digest
+const (
+	WebhookHeaderID        = "X-Webhook-ID"
+	WebhookHeaderDelivery  = "X-Webhook-Delivery"
+	WebhookHeaderEvent     = "X-Webhook-Event"
+	WebhookHeaderTimestamp = "X-Webhook-Timestamp"
+	WebhookHeaderSignature = "X-Webhook-Signature"
+)
+
+// WebhookDispatcher queues the events of the product log for the webhooks that match them, and
+// posts the queued deliveries to the subscribers. A failed delivery is attempted again with an
+// exponential backoff until it succeeds or runs out of attempts and is dead
+type WebhookDispatcher struct {
+	repository internal.WebhookRepository
+	events     internal.ProductEventLog
+	client     *http.Client
+	// dateLayout is the format of the expiration dates of the payloads
+	dateLayout string
+
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+
+	mu sync.Mutex
+	// queued is closed and replaced when deliveries are queued, to wake up the workers
+	queued chan struct{}
+	// claimed are the deliveries being attempted by a worker
+	claimed map[int]bool
+	// now returns the current time, used to know which deliveries are due
+	now func() time.Time
+}
+
+// NewWebhookDispatcher creates a new WebhookDispatcher with the default attempts and backoff
+func NewWebhookDispatcher(repository internal.WebhookRepository, events internal.ProductEventLog, dateLayout string) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		repository: repository,
+		events:     events,
+		// a redirect is a failed attempt, the subscriber must answer on the registered URL
+		client: &http.Client{
+			Timeout: WebhookTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		dateLayout:  dateLayout,
+		MaxAttempts: WebhookMaxAttempts,
+		Backoff:     WebhookBackoff,
+		MaxBackoff:  WebhookMaxBackoff,
+		queued:      make(chan struct{}),
+		claimed:     make(map[int]bool),
+		now:         time.Now,
+	}
+}
+
+// Run queues and delivers the events until ctx is done
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		d.enqueue(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		d.deliver(ctx)
+	}()
+	wg.Wait()
+}
+
+// enqueue follows the event log from the last event queued. The events published while the
+// application was stopped are queued on start, unless the log no longer has them
+func (d *WebhookDispatcher) enqueue(ctx context.Context) {
+	after := d.repository.Sequence()
+	if after == 0 {
+		after = d.events.Last()
+	}
+
+	for {
+		changed := d.events.Changed()
+
+		events, err := d.events.Since(after)
+		if errors.Is(err, internal.ErrProductEventsExpired) {
+			fmt.Println("webhooks:", err, "- the missing events are not delivered")
+			after = d.events.Last()
+			continue
+		}
+
+		if err == nil && len(events) > 0 {
+			if err = d.queue(events); err == nil {
+				after = events[len(events)-1].Sequence
+			}
+		}
+
+		// a failed queue is retried on the next poll
+		if err != nil {
+			fmt.Println("webhooks:", err)
+			changed = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case <-time.After(WebhookPoll):
+		}
+	}
+}
+
+// queue adds a delivery per event and active webhook that matches it
+func (d *WebhookDispatcher) queue(events []internal.ProductEvent) (err error) {
+	webhooks, err := d.repository.GetAll()
+	if err != nil {
+		return
+	}
+
+	now := d.now().UTC()
+	var deliveries []internal.WebhookDelivery
+	for _, event := range events {
+		for _, webhook := range webhooks {
+			if !webhook.Active || !webhook.Match(event) {
+				continue
+			}
+
+			deliveries = append(deliveries, internal.WebhookDelivery{
+				WebhookID:   webhook.ID,
+				Event:       event,
+				Status:      internal.WebhookDeliveryPending,
+				NextAttempt: now,
+				CreatedAt:   now,
+			})
+		}
+	}
+
+	if err = d.repository.Enqueue(deliveries, events[len(events)-1].Sequence); err != nil {
+		return
+	}
+
+	if len(deliveries) > 0 {
+		d.mu.Lock()
+		close(d.queued)
+		d.queued = make(chan struct{})
+		d.mu.Unlock()
+	}
+	return
+}
+
+// deliver attempts the deliveries due with WebhookWorkers workers, each takes the next delivery due
+// once it is done with its own, so a slow subscriber only holds up its worker
+func (d *WebhookDispatcher) deliver(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < WebhookWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work attempts the next delivery due until ctx is done, and waits for new deliveries or the next
+// poll when none is due
+func (d *WebhookDispatcher) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		d.mu.Lock()
+		queued := d.queued
+		d.mu.Unlock()
+
+		if delivery, ok := d.next(); ok {
+			d.attempt(ctx, delivery)
+			d.release(delivery.ID)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-queued:
+		case <-time.After(WebhookPoll):
+		}
+	}
+}
+
+// next claims the first delivery due that no other worker is attempting
+func (d *WebhookDispatcher) next() (delivery internal.WebhookDelivery, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// the claimed deliveries are still due until they are saved, one more is enough to find a free one
+	deliveries, err := d.repository.Due(d.now(), len(d.claimed)+1)
+	if err != nil {
+		fmt.Println("webhooks:", err)
+		return
+	}
+
+	for _, due := range deliveries {
+		if !d.claimed[due.ID] {
+			d.claimed[due.ID] = true
+			delivery, ok = due, true
+			return
+		}
+	}
+	return
+}
+
+// release frees a delivery once its attempt is saved
+func (d *WebhookDispatcher) release(id int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.claimed, id)
+}
+
+// attempt posts a delivery to its webhook and saves the result
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery internal.WebhookDelivery) {
+	webhook, err := d.repository.GetByID(delivery.WebhookID)
+	if err != nil {
+		// the deliveries of a deleted webhook are deleted with it
+		return
+	}
+
+	start := d.now()
+	attempt := internal.WebhookAttempt{Time: start.UTC()}
+	attempt.StatusCode, err = d.post(ctx, webhook, delivery)
+	attempt.Duration = d.now().Sub(start)
+
+	// an attempt interrupted by the shutdown is not counted
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err == nil {
+		delivery.Status = internal.WebhookDeliveryDelivered
+	} else {
+		attempt.Err = err.Error()
+		delivery.Failures++
+		delivery.NextAttempt = d.now().Add(d.backoff(delivery.Failures)).UTC()
+		if delivery.Failures >= d.MaxAttempts {
+			delivery.Status = internal.WebhookDeliveryDead
+		}
+	}
+	delivery.Attempts = append(delivery.Attempts, attempt)
+
+	if err = d.repository.SaveDelivery(&delivery); err != nil && !errors.Is(err, internal.ErrWebhookDeliveryNotFound) {
+		fmt.Println("webhooks:", err)
+	}
+}
+
+// backoff returns the wait after the failures, doubled on each failure up to MaxBackoff
+func (d *WebhookDispatcher) backoff(failures int) (wait time.Duration) {
+	wait = d.Backoff << (failures - 1)
+	if wait > d.MaxBackoff || wait <= 0 {
+		wait = d.MaxBackoff
+	}
+	return
+}
+
+// post sends the signed payload of a delivery, any answer but a 2xx is an error
+func (d *WebhookDispatcher) post(ctx context.Context, webhook internal.Webhook, delivery internal.WebhookDelivery) (statusCode int, err error) {
+	body, err := json.Marshal(d.payload(delivery))
+	if err != nil {
+		return
+	}
+
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-product-web-webhooks")
+	req.Header.Set(WebhookHeaderID, strconv.Itoa(webhook.ID))
+	req.Header.Set(WebhookHeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(WebhookHeaderEvent, delivery.Event.Type)
+	req.Header.Set(WebhookHeaderTimestamp, timestamp)
+	req.Header.Set(WebhookHeaderSignature, WebhookSignature(webhook.Secret, timestamp, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	statusCode = res.StatusCode
+	if statusCode < 200 || statusCode > 299 {
+		err = fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return
+}
+
+// WebhookSignature signs the body of a delivery sent at the timestamp, the subscribers compute it
+// again to check the payload comes from the API and was not changed
+func WebhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookPayload is the body sent to the subscribers, deleted products have their ID only
+type webhookPayload struct {
+	ID        int             `json:"id"`
+	WebhookID int             `json:"webhook_id"`
+	Event     string          `json:"event"`
+	Sequence  int64           `json:"sequence"`
+	Time      string          `json:"time"`
+	ProductID int             `json:"product_id"`
+	Product   *webhookProduct `json:"product,omitempty"`
+}
+
+type webhookProduct struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	Quantity    int     `json:"quantity"`
+	CodeValue   string  `json:"code_value"`
+	IsPublished bool    `json:"is_published"`
+	Expiration  string  `json:"expiration"`
+	Price       float64 `json:"price"`
+	Version     int     `json:"version"`
+}
+
+// payload converts a delivery to the body sent to its subscriber
+func (d *WebhookDispatcher) payload(delivery internal.WebhookDelivery) (p webhookPayload) {
+	event := delivery.Event
+	p = webhookPayload{
+		ID:        delivery.ID,
+		WebhookID: delivery.WebhookID,
+		Event:     event.Type,
+		Sequence:  event.Sequence,
+		Time:      event.Time.UTC().Format(time.RFC3339),
+		ProductID: event.Product.ID,
+	}
+
+	if event.Type != internal.ProductEventDeleted {
+		p.Product = &webhookProduct{
+			ID:          event.Product.ID,
+			Name:        event.Product.Name,
+			Quantity:    event.Product.Quantity,
+			CodeValue:   event.Product.CodeValue,
+			IsPublished: event.Product.IsPublished,
+			Expiration:  event.Product.Expiration.Format(d.dateLayout),
+			Price:       event.Product.Price,
+			Version:     event.Product.Version,
+		}
+	}
+	return
+}
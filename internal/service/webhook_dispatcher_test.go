@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/storage"
+)
+
+const testWebhookSecret = "test-secret-0123456789"
+
+// newTestDispatcher returns a dispatcher on a webhook repository in memory, with a clock that only
+// moves when the test sets it
+func newTestDispatcher(t *testing.T, events internal.ProductEventLog) (d *WebhookDispatcher, repository *storage.WebhookFile, now *time.Time) {
+	repository = storage.NewWebhookFile("")
+	if events == nil {
+		events = storage.NewEventLog("", 10)
+	}
+
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = &clock
+
+	d = NewWebhookDispatcher(repository, events, "02/01/2006")
+	d.now = func() time.Time { return *now }
+	return
+}
+
+// newTestWebhook creates an active webhook of the URL
+func newTestWebhook(t *testing.T, repository *storage.WebhookFile, url string, events []string, productIDs []int) (webhook internal.Webhook) {
+	webhook = internal.Webhook{URL: url, Events: events, ProductIDs: productIDs, Secret: testWebhookSecret, Active: true}
+	if err := repository.Create(&webhook); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func newTestEvent(sequence int64, eventType string, id int) internal.ProductEvent {
+	product := newTestProduct("P")
+	product.ID, product.Version = id, 1
+	return internal.ProductEvent{Sequence: sequence, Type: eventType, Product: product, Time: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+// attemptDue attempts the deliveries due at the time of the dispatcher, and returns how many
+func attemptDue(t *testing.T, d *WebhookDispatcher, repository *storage.WebhookFile) int {
+	deliveries, err := repository.Due(d.now(), WebhookWorkers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, delivery := range deliveries {
+		d.attempt(context.Background(), delivery)
+	}
+	return len(deliveries)
+}
+
+// TestWebhookDispatcher_Signature checks that a subscriber verifies the signature of a delivery
+// with the secret of its webhook
+func TestWebhookDispatcher_Signature(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []map[string]any
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(WebhookHeaderTimestamp)
+
+		want := WebhookSignature(testWebhookSecret, timestamp, body)
+		if !hmac.Equal([]byte(r.Header.Get(WebhookHeaderSignature)), []byte(want)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var payload map[string]any
+		json.Unmarshal(body, &payload)
+
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	d, repository, _ := newTestDispatcher(t, nil)
+	webhook := newTestWebhook(t, repository, server.URL, nil, nil)
+
+	if err := d.queue([]internal.ProductEvent{newTestEvent(1, internal.ProductEventCreated, 7)}); err != nil {
+		t.Fatal(err)
+	}
+	if n := attemptDue(t, d, repository); n != 1 {
+		t.Fatalf("got %d deliveries due, want 1", n)
+	}
+
+	deliveries, _ := repository.Deliveries(internal.WebhookDeliveryQuery{WebhookID: webhook.ID})
+	if len(deliveries) != 1 || deliveries[0].Status != internal.WebhookDeliveryDelivered {
+		t.Fatalf("got deliveries %+v, want one delivered", deliveries)
+	}
+
+	if len(received) != 1 || received[0]["event"] != internal.ProductEventCreated || received[0]["product_id"] != float64(7) {
+		t.Fatalf("got payloads %+v, want the created event of the product 7", received)
+	}
+
+	// a body changed on the way does not match the signature
+	if WebhookSignature(testWebhookSecret, "1", []byte(`{"id":1}`)) == WebhookSignature(testWebhookSecret, "1", []byte(`{"id":2}`)) {
+		t.Fatal("got the same signature for two bodies")
+	}
+}
+
+// TestWebhookDispatcher_Backoff checks that a failed delivery waits twice as long after each failure,
+// up to the maximum backoff, and is dead once it runs out of attempts. A dead delivery redelivered is
+// attempted again with its history kept
+func TestWebhookDispatcher_Backoff(t *testing.T) {
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	d, repository, now := newTestDispatcher(t, nil)
+	d.MaxAttempts, d.Backoff, d.MaxBackoff = 4, time.Second, 3*time.Second
+	newTestWebhook(t, repository, server.URL, nil, nil)
+
+	if err := d.queue([]internal.ProductEvent{newTestEvent(1, internal.ProductEventUpdated, 1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := *now
+	for attempt, wait := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		if n := attemptDue(t, d, repository); n != 1 {
+			t.Fatalf("attempt %d: got %d deliveries due, want 1", attempt+1, n)
+		}
+
+		delivery, _ := repository.GetDelivery(1)
+		if delivery.Status != internal.WebhookDeliveryPending || delivery.Failures != attempt+1 {
+			t.Fatalf("attempt %d: got %s with %d failures", attempt+1, delivery.Status, delivery.Failures)
+		}
+		if !delivery.NextAttempt.Equal(now.Add(wait)) {
+			t.Fatalf("attempt %d: got next attempt after %s, want %s", attempt+1, delivery.NextAttempt.Sub(*now), wait)
+		}
+
+		// the delivery is not due before its next attempt
+		if n := attemptDue(t, d, repository); n != 0 {
+			t.Fatalf("attempt %d: got %d deliveries due before the backoff", attempt+1, n)
+		}
+		*now = delivery.NextAttempt
+	}
+
+	attemptDue(t, d, repository)
+	delivery, _ := repository.GetDelivery(1)
+	if delivery.Status != internal.WebhookDeliveryDead || len(delivery.Attempts) != 4 || delivery.Attempts[0].StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got %+v, want the delivery dead after 4 attempts", delivery)
+	}
+	if dead, _ := repository.Deliveries(internal.WebhookDeliveryQuery{Status: internal.WebhookDeliveryDead}); len(dead) != 1 {
+		t.Fatalf("got dead deliveries %+v, want 1", dead)
+	}
+
+	// the redelivery is attempted at once, with its failures reset
+	*now = start.Add(time.Hour)
+	sv := NewWebhookDefault(repository)
+	sv.now = d.now
+	if _, err := sv.Redeliver(context.Background(), delivery.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sv.Redeliver(context.Background(), delivery.ID); !errors.Is(err, internal.ErrWebhookDeliveryPending) {
+		t.Fatalf("got error %v, want %v", err, internal.ErrWebhookDeliveryPending)
+	}
+
+	fail = false
+	if n := attemptDue(t, d, repository); n != 1 {
+		t.Fatalf("got %d deliveries due after the redelivery, want 1", n)
+	}
+
+	delivery, _ = repository.GetDelivery(1)
+	if delivery.Status != internal.WebhookDeliveryDelivered || len(delivery.Attempts) != 5 || delivery.Failures != 0 {
+		t.Fatalf("got %+v, want the delivery delivered with its 5 attempts", delivery)
+	}
+}
+
+// TestWebhookDispatcher_Filters checks that the events are queued for the active webhooks whose
+// events and products match them only
+func TestWebhookDispatcher_Filters(t *testing.T) {
+	d, repository, _ := newTestDispatcher(t, nil)
+
+	all := newTestWebhook(t, repository, "http://localhost/all", nil, nil)
+	deleted := newTestWebhook(t, repository, "http://localhost/deleted", []string{internal.ProductEventDeleted}, nil)
+	product := newTestWebhook(t, repository, "http://localhost/product", nil, []int{2})
+	inactive := newTestWebhook(t, repository, "http://localhost/inactive", nil, nil)
+	inactive.Active = false
+	if err := repository.Update(&inactive); err != nil {
+		t.Fatal(err)
+	}
+
+	err := d.queue([]internal.ProductEvent{
+		newTestEvent(1, internal.ProductEventCreated, 1),
+		newTestEvent(2, internal.ProductEventUpdated, 2),
+		newTestEvent(3, internal.ProductEventDeleted, 1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int][]int64{all.ID: {1, 2, 3}, deleted.ID: {3}, product.ID: {2}, inactive.ID: nil}
+	for id, sequences := range want {
+		deliveries, _ := repository.Deliveries(internal.WebhookDeliveryQuery{WebhookID: id})
+
+		var got []int64
+		for index := len(deliveries) - 1; index >= 0; index-- {
+			got = append(got, deliveries[index].Event.Sequence)
+		}
+		if !slices.Equal(got, sequences) {
+			t.Errorf("webhook %d: got events %v, want %v", id, got, sequences)
+		}
+	}
+
+	if sequence := repository.Sequence(); sequence != 3 {
+		t.Fatalf("got sequence %d, want 3", sequence)
+	}
+}
+
+// watchedEventLog is an event log that reports the sequences read by the dispatcher
+type watchedEventLog struct {
+	*storage.EventLog
+	reads chan int64
+}
+
+func (l *watchedEventLog) Since(after int64) (events []internal.ProductEvent, err error) {
+	events, err = l.EventLog.Since(after)
+	select {
+	case l.reads <- after:
+	default:
+	}
+	return
+}
+
+// TestWebhookDispatcher_ResumeExpired checks that the dispatcher resumes from the last event of the
+// log when the events after its sequence were dropped, and keeps queuing the new ones
+func TestWebhookDispatcher_ResumeExpired(t *testing.T) {
+	events := &watchedEventLog{EventLog: storage.NewEventLog("", 2), reads: make(chan int64, 1)}
+	for id := 1; id <= 5; id++ {
+		if err := events.Append([]internal.ProductEvent{newTestEvent(0, internal.ProductEventCreated, id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, repository, _ := newTestDispatcher(t, events)
+	webhook := newTestWebhook(t, repository, "http://localhost/all", nil, nil)
+
+	// the dispatcher stopped after the first event, the log now has the events 4 and 5 only
+	if err := repository.Enqueue(nil, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.enqueue(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the events are read from the last one once the sequence expired
+	for after := range events.reads {
+		if after == 5 {
+			break
+		}
+	}
+
+	if err := events.Append([]internal.ProductEvent{newTestEvent(0, internal.ProductEventUpdated, 6)}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.After(5 * time.Second)
+	for repository.Sequence() != 6 {
+		select {
+		case <-deadline:
+			t.Fatalf("got sequence %d, want the event 6 queued", repository.Sequence())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	deliveries, _ := repository.Deliveries(internal.WebhookDeliveryQuery{WebhookID: webhook.ID})
+	if len(deliveries) != 1 || deliveries[0].Event.Sequence != 6 {
+		t.Fatalf("got deliveries %+v, want the event 6 only", deliveries)
+	}
+}
+
+// TestWebhookDispatcher_SlowSubscriber checks that a subscriber slow to answer holds up its worker
+// only, the other deliveries are attempted meanwhile
+func TestWebhookDispatcher_SlowSubscriber(t *testing.T) {
+	unblock := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer slow.Close()
+
+	received := make(chan struct{}, 10)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer fast.Close()
+
+	d, repository, now := newTestDispatcher(t, nil)
+	slowWebhook := newTestWebhook(t, repository, slow.URL, nil, nil)
+	fastWebhook := newTestWebhook(t, repository, fast.URL, nil, nil)
+
+	// the slow deliveries are first in the queue and take all the workers but one
+	var deliveries []internal.WebhookDelivery
+	for sequence := int64(1); sequence < WebhookWorkers; sequence++ {
+		deliveries = append(deliveries, internal.WebhookDelivery{WebhookID: slowWebhook.ID, Event: newTestEvent(sequence, internal.ProductEventCreated, 1), Status: internal.WebhookDeliveryPending, NextAttempt: *now})
+	}
+	for sequence := int64(WebhookWorkers); sequence < WebhookWorkers+3; sequence++ {
+		deliveries = append(deliveries, internal.WebhookDelivery{WebhookID: fastWebhook.ID, Event: newTestEvent(sequence, internal.ProductEventCreated, 1), Status: internal.WebhookDeliveryPending, NextAttempt: *now})
+	}
+	if err := repository.Enqueue(deliveries, WebhookWorkers+2); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.deliver(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		close(unblock)
+		<-done
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for count := 0; count < 3; count++ {
+		select {
+		case <-received:
+		case <-deadline:
+			t.Fatalf("got %d fast deliveries, want 3 while the slow ones are attempted", count)
+		}
+	}
+}
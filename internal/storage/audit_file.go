@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
+
+// AuditFile is an append-only log of the changes made on the products, one JSON entry per line.
+// The entries are synced before Append returns and are never rewritten. Queries read the file and
+// keep up to twice their limit in memory, so the memory used does not grow with the log. An empty
+// file path keeps the entries in memory only
+type AuditFile struct {
+	FilePath string
+
+	mu   sync.Mutex
+	last int64
+	file logFile
+	// entries holds the log when there is no file
+	entries []internal.AuditEntry
+}
+
+// NewAuditFile creates a new AuditFile
+func NewAuditFile(filePath string) *AuditFile {
+	return &AuditFile{
+		FilePath: filePath,
+	}
+}
+
+type AuditEntryJSON struct {
+	Sequence  int64        `json:"sequence"`
+	Time      time.Time    `json:"time"`
+	Actor     string       `json:"actor"`
+	RequestID string       `json:"request_id,omitempty"`
+	Operation string       `json:"operation"`
+	ProductID int          `json:"product_id"`
+	Before    *ProductJSON `json:"before,omitempty"`
+	After     *ProductJSON `json:"after,omitempty"`
+}
+
+// Open finds the last sequence of the file and opens it for appending
+func (a *AuditFile) Open() (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.FilePath == "" {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(a.FilePath), 0755); err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageOpen, err)
+		return
+	}
+
+	a.file, err = os.OpenFile(a.FilePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageOpen, err)
+		return
+	}
+
+	valid, err := a.scan(func(entry internal.AuditEntry) bool {
+		a.last = entry.Sequence
+		return true
+	})
+	if err != nil {
+		return
+	}
+
+	// as in the log of the storage, a line without its newline is a torn write and is discarded
+	if err = a.file.Truncate(valid); err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageLoad, err)
+		return
+	}
+
+	return
+}
+
+// Append assigns the next sequences to the entries and writes them at the end of the file, in
+// a single write so they are either all in the log or discarded as a torn write
+func (a *AuditFile) Append(entries []internal.AuditEntry) (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var buf bytes.Buffer
+	for index := range entries {
+		entries[index].Sequence = a.last + int64(index) + 1
+
+		line, err := json.Marshal(newAuditEntryJSON(entries[index]))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrStorageAppend, err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	if a.file == nil {
+		a.entries = append(a.entries, entries...)
+		a.last += int64(len(entries))
+		return
+	}
+
+	// the bytes of a failed write are cut from the file, or the next entries would be merged
+	// into the torn line and the file could not be opened again
+	offset, err := a.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageAppend, err)
+		return
+	}
+
+	if _, err = a.file.Write(buf.Bytes()); err == nil {
+		err = a.file.Sync()
+	}
+	if err != nil {
+		a.file.Truncate(offset)
+		err = fmt.Errorf("%w: %v", ErrStorageAppend, err)
+		return
+	}
+
+	a.last += int64(len(entries))
+	return
+}
+
+// Query returns the entries that match the query, the newest first. Only the last matches up to
+// the limit are kept while the file is read
+func (a *AuditFile) Query(query internal.AuditQuery) (entries []internal.AuditEntry, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entries = make([]internal.AuditEntry, 0)
+	collect := func(entry internal.AuditEntry) bool {
+		if query.Before != 0 && entry.Sequence >= query.Before {
+			return false
+		}
+
+		if query.Match(entry) {
+			entries = append(entries, entry)
+		}
+
+		// the older matches are dropped once there are twice the limit, so the copy is amortized
+		if query.Limit > 0 && len(entries) == 2*query.Limit {
+			entries = append(entries[:0], entries[query.Limit:]...)
+		}
+		return true
+	}
+
+	if a.file == nil {
+		for _, entry := range a.entries {
+			if !collect(entry) {
+				break
+			}
+		}
+	} else if _, err = a.scan(collect); err != nil {
+		return
+	}
+
+	if query.Limit > 0 && len(entries) > query.Limit {
+		entries = entries[len(entries)-query.Limit:]
+	}
+	slices.Reverse(entries)
+	return
+}
+
+// Close closes the file
+func (a *AuditFile) Close() (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return
+	}
+
+	err = a.file.Close()
+	a.file = nil
+	return
+}
+
+// scan reads the entries of the file from the start until fn returns false, and returns the offset
+// after the last complete line. The caller must hold the lock
+func (a *AuditFile) scan(fn func(entry internal.AuditEntry) bool) (valid int64, err error) {
+	reader := bufio.NewReader(io.NewSectionReader(a.file, 0, 1<<62))
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil {
+			return
+		}
+
+		var ej AuditEntryJSON
+		if err = json.Unmarshal(line, &ej); err != nil {
+			err = fmt.Errorf("%w: corrupted audit entry at offset %d: %v", ErrStorageLoad, valid, err)
+			return
+		}
+		valid += int64(len(line))
+
+		entry, entryErr := ej.toAuditEntry()
+		if entryErr != nil {
+			err = fmt.Errorf("%w: audit entry %d: %v", ErrStorageLoad, ej.Sequence, entryErr)
+			return
+		}
+
+		if !fn(entry) {
+			return
+		}
+	}
+}
+
+func newAuditEntryJSON(entry internal.AuditEntry) (ej AuditEntryJSON) {
+	ej = AuditEntryJSON{
+		Sequence:  entry.Sequence,
+		Time:      entry.Time,
+		Actor:     entry.Actor,
+		RequestID: entry.RequestID,
+		Operation: entry.Operation,
+		ProductID: entry.ProductID,
+	}
+
+	if entry.Before != nil {
+		before := newProductJSON(*entry.Before)
+		ej.Before = &before
+	}
+	if entry.After != nil {
+		after := newProductJSON(*entry.After)
+		ej.After = &after
+	}
+	return
+}
+
+func (ej AuditEntryJSON) toAuditEntry() (entry internal.AuditEntry, err error) {
+	entry = internal.AuditEntry{
+		Sequence:  ej.Sequence,
+		Time:      ej.Time,
+		Actor:     ej.Actor,
+		RequestID: ej.RequestID,
+		Operation: ej.Operation,
+		ProductID: ej.ProductID,
+	}
+
+	if ej.Before != nil {
+		before, err := ej.Before.toProduct()
+		if err != nil {
+			return entry, err
+		}
+		entry.Before = &before
+	}
+	if ej.After != nil {
+		after, err := ej.After.toProduct()
+		if err != nil {
+			return entry, err
+		}
+		entry.After = &after
+	}
+	return
+}
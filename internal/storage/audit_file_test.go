@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
+
+// TestAuditFile_AppendTorn checks that a failed append is cut from the file, so the next entries
+// are kept and the file opens again
+func TestAuditFile_AppendTorn(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "audit.log")
+
+	audit := NewAuditFile(filePath)
+	if err := audit.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := &tornFile{File: audit.file.(*os.File)}
+	audit.file = file
+
+	if err := audit.Append([]internal.AuditEntry{{Operation: internal.AuditCreate, ProductID: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	file.fail = true
+	if err := audit.Append([]internal.AuditEntry{{Operation: internal.AuditCreate, ProductID: 2}}); !errors.Is(err, ErrStorageAppend) {
+		t.Fatalf("got error %v, want %v", err, ErrStorageAppend)
+	}
+
+	file.fail = false
+	if err := audit.Append([]internal.AuditEntry{{Operation: internal.AuditCreate, ProductID: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := audit.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	audit = NewAuditFile(filePath)
+	if err := audit.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+
+	entries, err := audit.Query(internal.AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || entries[0].ProductID != 3 || entries[1].ProductID != 1 {
+		t.Fatalf("got entries %+v, want the products 3 and 1", entries)
+	}
+}
+
+// TestAuditFile_Query checks that the queries return the newest entries that match, from the file
+// and from the memory
+func TestAuditFile_Query(t *testing.T) {
+	for _, filePath := range []string{filepath.Join(t.TempDir(), "audit.log"), ""} {
+		audit := NewAuditFile(filePath)
+		if err := audit.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer audit.Close()
+
+		for id := 1; id <= 7; id++ {
+			actor := "admin"
+			if id%2 == 0 {
+				actor = "editor"
+			}
+			if err := audit.Append([]internal.AuditEntry{{Actor: actor, Operation: internal.AuditCreate, ProductID: id}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			name  string
+			query internal.AuditQuery
+			want  []int
+		}{
+			{name: "all", query: internal.AuditQuery{}, want: []int{7, 6, 5, 4, 3, 2, 1}},
+			{name: "limit", query: internal.AuditQuery{Limit: 3}, want: []int{7, 6, 5}},
+			{name: "next page", query: internal.AuditQuery{Before: 5, Limit: 3}, want: []int{4, 3, 2}},
+			{name: "last page", query: internal.AuditQuery{Before: 2, Limit: 3}, want: []int{1}},
+			{name: "actor", query: internal.AuditQuery{Actor: "editor", Limit: 2}, want: []int{6, 4}},
+			{name: "product", query: internal.AuditQuery{ProductID: 3}, want: []int{3}},
+		}
+
+		for _, tt := range tests {
+			entries, err := audit.Query(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []int
+			for _, entry := range entries {
+				ids = append(ids, entry.ProductID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("%q %s: got products %v, want %v", filePath, tt.name, ids, tt.want)
+			}
+		}
+	}
+}
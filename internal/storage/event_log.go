@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+// EventLog is a log of the last events of the products. It keeps up to size events in memory and,
+// with a file path, appends them to a file so the sequences and the events survive a restart.
+// The file is rewritten with the events in memory once it holds twice their number. The appends are
+// synced, so a sequence is never given again after a crash. The sequences of the events that can't
+// be appended are skipped, so the clients that follow the log are told to read the products again
+type EventLog struct {
+	FilePath string
+
+	mu      sync.Mutex
+	size    int
+	events  []internal.ProductEvent
+	last    int64
+	written int
+	file    *os.File
+	changed chan struct{}
+}
+
+// NewEventLog creates a new EventLog, an empty file path keeps the events in memory only
+func NewEventLog(filePath string, size int) *EventLog {
+	return &EventLog{
+		FilePath: filePath,
+		size:     max(size, 1),
+		changed:  make(chan struct{}),
+	}
+}
+
+type EventJSON struct {
+	Sequence int64       `json:"sequence"`
+	Type     string      `json:"type"`
+	Product  ProductJSON `json:"product"`
+	Time     time.Time   `json:"time"`
+}
+
+// Open reads the events of the file and opens it for appending
+func (l *EventLog) Open() (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.FilePath == "" {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(l.FilePath), 0755); err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageOpen, err)
+		return
+	}
+
+	l.file, err = os.OpenFile(l.FilePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageOpen, err)
+		return
+	}
+
+	// as in the log of the storage, a line without its newline is a torn write and is discarded
+	valid := int64(0)
+	reader := bufio.NewReader(l.file)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil {
+			break
+		}
+
+		var ev EventJSON
+		if err = json.Unmarshal(line, &ev); err != nil {
+			err = fmt.Errorf("%w: corrupted event at offset %d: %v", ErrStorageLoad, valid, err)
+			return
+		}
+		valid += int64(len(line))
+
+		event := internal.ProductEvent{Sequence: ev.Sequence, Type: ev.Type, Time: ev.Time}
+		if event.Product, err = ev.Product.toProduct(); err != nil && ev.Type != internal.ProductEventDeleted {
+			err = fmt.Errorf("%w: event %d: %v", ErrStorageLoad, ev.Sequence, err)
+			return
+		}
+		err = nil
+
+		// the events missing before this one were never appended, the clients that resume from
+		// them must read the products again
+		if len(l.events) > 0 && event.Sequence != l.last+1 {
+			l.events = l.events[:0]
+		}
+
+		l.keep(event)
+		l.written++
+	}
+
+	if err = l.file.Truncate(valid); err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageLoad, err)
+		return
+	}
+
+	return
+}
+
+// Append assigns the next sequences to the events, writes them into the file and adds them to the log.
+// When they can't be written their sequences are skipped and the events in memory are dropped, so
+// Since answers ErrProductEventsExpired to the clients that didn't receive them
+func (l *EventLog) Append(events []internal.ProductEvent) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var buf bytes.Buffer
+	for index := range events {
+		events[index].Sequence = l.last + int64(index) + 1
+
+		line, marshalErr := json.Marshal(newEventJSON(events[index]))
+		if marshalErr != nil {
+			err = fmt.Errorf("%w: %v", ErrStorageAppend, marshalErr)
+			break
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	if err == nil && l.file != nil {
+		if err = l.write(buf.Bytes()); err != nil {
+			err = fmt.Errorf("%w: %v", ErrStorageAppend, err)
+		} else {
+			l.written += len(events)
+		}
+	}
+
+	if err != nil {
+		l.events = l.events[:0]
+		l.last += int64(len(events))
+		close(l.changed)
+		l.changed = make(chan struct{})
+		return
+	}
+
+	for _, event := range events {
+		l.keep(event)
+	}
+
+	// the file is rewritten after the events are kept, so it starts with the oldest event in memory.
+	// The events are already in the file, a failed rewrite is retried on the next append
+	if l.file != nil && l.written >= 2*l.size {
+		l.rewrite()
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+	return
+}
+
+// write appends the lines into the file and syncs it. The bytes of a failed write are cut from the file,
+// so the next events are not written after them
+func (l *EventLog) write(data []byte) (err error) {
+	offset, err := l.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return
+	}
+
+	if _, err = l.file.Write(data); err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		l.file.Truncate(offset)
+	}
+	return
+}
+
+// Since returns the events after the sequence
+func (l *EventLog) Since(after int64) (events []internal.ProductEvent, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the sequence of the event before the first one kept
+	first := l.last - int64(len(l.events))
+	if after < first || after > l.last {
+		err = fmt.Errorf("%w: the log has the events after %d to %d", internal.ErrProductEventsExpired, first, l.last)
+		return
+	}
+
+	events = append(events, l.events[after-first:]...)
+	return
+}
+
+// Last returns the sequence of the last event
+func (l *EventLog) Last() (sequence int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sequence = l.last
+	return
+}
+
+// Changed returns a channel that is closed on the next Append
+func (l *EventLog) Changed() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.changed
+}
+
+// Close closes the file
+func (l *EventLog) Close() (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return
+	}
+
+	err = l.file.Close()
+	l.file = nil
+	return
+}
+
+// keep adds an event to the memory, dropping the oldest one when it is full
+func (l *EventLog) keep(event internal.ProductEvent) {
+	if len(l.events) == l.size {
+		l.events = append(l.events[:0], l.events[1:]...)
+	}
+
+	l.events = append(l.events, event)
+	l.last = event.Sequence
+}
+
+// rewrite replaces the file with the events in memory
+func (l *EventLog) rewrite() (err error) {
+	var buf bytes.Buffer
+	for _, event := range l.events {
+		line, err := json.Marshal(newEventJSON(event))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrStorageSave, err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	if err = tools.WriteFileAtomic(l.FilePath, buf.Bytes()); err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageSave, err)
+		return
+	}
+
+	file, err := os.OpenFile(l.FilePath, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageSave, err)
+		return
+	}
+
+	// the old file was renamed over, its events are already in the new one
+	l.file.Close()
+	l.file, l.written = file, len(l.events)
+	return
+}
+
+func newEventJSON(event internal.ProductEvent) EventJSON {
+	return EventJSON{
+		Sequence: event.Sequence,
+		Type:     event.Type,
+		Product:  newProductJSON(event.Product),
+		Time:     event.Time,
+	}
+}
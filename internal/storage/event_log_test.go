@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
+
+// TestEventLog_AppendGap checks that the events that can't be appended leave a gap, so the clients
+// that missed them are told to read the products again instead of skipping them, even after a restart
+func TestEventLog_AppendGap(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "products.json.events")
+
+	events := NewEventLog(filePath, 10)
+	if err := events.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := internal.ProductEvent{Type: internal.ProductEventDeleted, Product: internal.Product{ID: 1}}
+	if err := events.Append([]internal.ProductEvent{deleted}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the writes into the closed file fail
+	events.file.Close()
+	changed := events.Changed()
+	if err := events.Append([]internal.ProductEvent{deleted}); !errors.Is(err, ErrStorageAppend) {
+		t.Fatalf("got error %v, want %v", err, ErrStorageAppend)
+	}
+
+	select {
+	case <-changed:
+	default:
+		t.Fatal("got the clients not woken up by the failed append")
+	}
+	if _, err := events.Since(1); !errors.Is(err, internal.ErrProductEventsExpired) {
+		t.Fatalf("got error %v after the gap, want %v", err, internal.ErrProductEventsExpired)
+	}
+
+	var err error
+	if events.file, err = os.OpenFile(filePath, os.O_RDWR|os.O_APPEND, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = events.Append([]internal.ProductEvent{deleted}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := events.Since(2); err != nil || len(got) != 1 || got[0].Sequence != 3 {
+		t.Fatalf("got events %+v and error %v, want the event 3", got, err)
+	}
+	events.Close()
+
+	events = NewEventLog(filePath, 10)
+	if err = events.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer events.Close()
+
+	if _, err = events.Since(1); !errors.Is(err, internal.ErrProductEventsExpired) {
+		t.Fatalf("got error %v after the restart, want %v", err, internal.ErrProductEventsExpired)
+	}
+	if got, err := events.Since(2); err != nil || len(got) != 1 || got[0].Sequence != 3 {
+		t.Fatalf("got events %+v and error %v after the restart, want the event 3", got, err)
+	}
+}
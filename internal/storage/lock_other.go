@@ -0,0 +1,10 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// lockFile does not lock the file on the systems without flock
+func lockFile(file *os.File) (err error) {
+	return
+}
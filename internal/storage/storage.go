@@ -1,15 +1,45 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
 
 type Storage interface {
 	Open() (err error)
-	Load() (err error)
-	Save() (err error)
+	// Load returns the stored products and the last ID given, which can be higher than the IDs
+	// stored once the products that had it are deleted
+	Load() (products []internal.Product, lastID int, err error)
+	Save(products []internal.Product, lastID int) (err error)
+	Append(operation Operation) (err error)
+	Close() (err error)
+}
+
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+	// OperationTrash and OperationRestore move a product to the trash and back, with its full state
+	OperationTrash   = "trash"
+	OperationRestore = "restore"
+	// OperationBatch is a list of operations applied all or none
+	OperationBatch = "batch"
+)
+
+// Operation is a change made on a product, as written in the write-ahead log
+type Operation struct {
+	Type    string
+	Product internal.Product
+	// Operations are the operations of a batch
+	Operations []Operation
 }
 
 var (
-	ErrStorageOpen = errors.New("storage: error opening storage")
-	ErrStorageLoad = errors.New("storage: error loading storage")
-	ErrStorageSave = errors.New("storage: error saving storage")
+	ErrStorageOpen   = errors.New("storage: error opening storage")
+	ErrStorageLoad   = errors.New("storage: error loading storage")
+	ErrStorageSave   = errors.New("storage: error saving storage")
+	ErrStorageAppend = errors.New("storage: error appending to the log")
+	// ErrStorageLocked is returned by Open when another process has the storage open
+	ErrStorageLocked = errors.New("storage: storage is open in another process")
 )
@@ -1 +1,431 @@
 package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+// StorageDefault is a storage that persists the products in a JSON file (snapshot),
+// and every change made after the snapshot in a write-ahead log next to it
+type StorageDefault struct {
+	FilePath string
+	WALPath  string
+
+	mu  sync.Mutex
+	wal logFile
+}
+
+// logFile is a file written at its end, *os.File in the storages
+type logFile interface {
+	io.ReadWriteSeeker
+	io.ReaderAt
+	io.Closer
+	Truncate(size int64) error
+	Sync() error
+}
+
+// NewStorageDefault creates a new StorageDefault, the log is stored in filePath + ".wal"
+func NewStorageDefault(filePath string) *StorageDefault {
+	return &StorageDefault{
+		FilePath: filePath,
+		WALPath:  filePath + ".wal",
+	}
+}
+
+type ProductJSON struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	Quantity    int     `json:"quantity"`
+	CodeValue   string  `json:"code_value"`
+	IsPublished bool    `json:"is_published"`
+	Expiration  string  `json:"expiration"`
+	Price       float64 `json:"price"`
+	Version     int     `json:"version"`
+	// DeletedAt and DeletedBy are only set on the products of the trash
+	DeletedAt string `json:"deleted_at,omitempty"`
+	DeletedBy string `json:"deleted_by,omitempty"`
+}
+
+// SnapshotJSON is the content of the snapshot. A snapshot with the products only, as a JSON array,
+// is read with the highest ID stored as its last ID
+type SnapshotJSON struct {
+	LastID   int           `json:"last_id"`
+	Products []ProductJSON `json:"products"`
+}
+
+type OperationJSON struct {
+	Type       string          `json:"type"`
+	Product    *ProductJSON    `json:"product,omitempty"`
+	Operations []OperationJSON `json:"operations,omitempty"`
+}
+
+// Open creates an empty catalog if the file does not exist and opens the log for appending. The log is
+// locked until Close, so a single process writes the storage at a time
+func (s *StorageDefault) Open() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = os.Stat(s.FilePath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if err = os.MkdirAll(filepath.Dir(s.FilePath), 0755); err != nil {
+			err = fmt.Errorf("%w: %v", ErrStorageOpen, err)
+			return
+		}
+
+		if err = tools.WriteFileAtomic(s.FilePath, []byte(`{"last_id":0,"products":[]}`)); err != nil {
+			err = fmt.Errorf("%w: %v", ErrStorageOpen, err)
+			return
+		}
+	case err != nil:
+		err = fmt.Errorf("%w: %v", ErrStorageOpen, err)
+		return
+	}
+
+	wal, err := os.OpenFile(s.WALPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageOpen, err)
+		return
+	}
+
+	if err = lockFile(wal); err != nil {
+		wal.Close()
+		err = fmt.Errorf("%w: %s: %w", ErrStorageOpen, s.WALPath, err)
+		return
+	}
+
+	s.wal = wal
+	return
+}
+
+// Load reads all the products from the snapshot and replays the log on top of them, it can be
+// called without Open to read the storage only
+func (s *StorageDefault) Load() (products []internal.Product, lastID int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.FilePath)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageLoad, err)
+		return
+	}
+
+	var snapshot SnapshotJSON
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &snapshot.Products)
+	} else {
+		err = json.Unmarshal(data, &snapshot)
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageLoad, err)
+		return
+	}
+
+	lastID = snapshot.LastID
+	products = make([]internal.Product, 0, len(snapshot.Products))
+	index := make(map[int]int, len(snapshot.Products))
+	for _, pr := range snapshot.Products {
+		product, err := pr.toProduct()
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: product %d: %v", ErrStorageLoad, pr.ID, err)
+		}
+
+		index[pr.ID] = len(products)
+		products = append(products, product)
+		lastID = max(lastID, pr.ID)
+	}
+
+	// without Open the log is replayed from a read-only file and left as it is, so a running
+	// application that has it open is not disturbed
+	if s.wal == nil {
+		wal, openErr := os.Open(s.WALPath)
+		if errors.Is(openErr, os.ErrNotExist) {
+			return
+		}
+		if openErr != nil {
+			err = fmt.Errorf("%w: %v", ErrStorageLoad, openErr)
+			return
+		}
+		defer wal.Close()
+
+		_, err = s.replayLog(wal, &products, &lastID, index)
+		return
+	}
+
+	if _, err = s.wal.Seek(0, 0); err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageLoad, err)
+		return
+	}
+
+	valid, err := s.replayLog(s.wal, &products, &lastID, index)
+	if err != nil {
+		return
+	}
+
+	// drop the torn tail so new entries start on a clean line
+	if err = s.wal.Truncate(valid); err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageLoad, err)
+		return
+	}
+
+	return
+}
+
+// replayLog replays the operations of the log on top of the products, and returns the offset after
+// the last complete line. Operations hold the full state of the product, so replaying an operation
+// already contained in the snapshot has no effect. The last ID is raised to the IDs of the operations,
+// those of the products deleted for good included
+func (s *StorageDefault) replayLog(r io.Reader, products *[]internal.Product, lastID *int, index map[int]int) (valid int64, err error) {
+	reader := bufio.NewReader(r)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil {
+			// a line without its trailing newline is a write interrupted by a crash,
+			// it was never acknowledged so it is discarded
+			return
+		}
+
+		var op OperationJSON
+		if err = json.Unmarshal(line, &op); err != nil {
+			err = fmt.Errorf("%w: corrupted log entry at offset %d: %v", ErrStorageLoad, valid, err)
+			return
+		}
+		valid += int64(len(line))
+
+		if err = replay(products, lastID, index, op); err != nil {
+			return
+		}
+	}
+}
+
+// Save writes all the products to the snapshot file with the last ID, one product per line, and
+// empties the log since its operations are now part of the snapshot
+func (s *StorageDefault) Save(products []internal.Product, lastID int) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"last_id":` + strconv.Itoa(lastID) + `,"products":[`)
+	for index, pr := range products {
+		if index > 0 {
+			buf.WriteString(",\n")
+		}
+
+		line, err := json.Marshal(newProductJSON(pr))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrStorageSave, err)
+		}
+
+		buf.Write(line)
+	}
+	buf.WriteString("]}")
+
+	if err = tools.WriteFileAtomic(s.FilePath, buf.Bytes()); err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageSave, err)
+		return
+	}
+
+	if s.wal == nil {
+		return
+	}
+
+	if err = s.wal.Truncate(0); err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageSave, err)
+		return
+	}
+
+	if err = s.wal.Sync(); err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageSave, err)
+		return
+	}
+
+	return
+}
+
+// Append writes an operation at the end of the log, it returns once the operation is on disk
+func (s *StorageDefault) Append(operation Operation) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		err = fmt.Errorf("%w: storage is not open", ErrStorageAppend)
+		return
+	}
+
+	// a batch is written in a single line, so it is either fully in the log or discarded as a torn write
+	line, err := json.Marshal(newOperationJSON(operation))
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageAppend, err)
+		return
+	}
+
+	// the bytes of a failed write are cut from the log, or the next entry would be written after them
+	offset, err := s.wal.Seek(0, io.SeekEnd)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageAppend, err)
+		return
+	}
+
+	if _, err = s.wal.Write(append(line, '\n')); err == nil {
+		err = s.wal.Sync()
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageAppend, err)
+		s.rollback(offset)
+		return
+	}
+
+	return
+}
+
+// rollback truncates the log to the offset of a failed write. If it can't, the log is closed so
+// nothing else is written after the torn entry, which is dropped by the next Load
+func (s *StorageDefault) rollback(offset int64) {
+	if err := s.wal.Truncate(offset); err == nil {
+		if err = s.wal.Sync(); err == nil {
+			return
+		}
+	}
+
+	s.wal.Close()
+	s.wal = nil
+}
+
+// Close closes the log
+func (s *StorageDefault) Close() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wal == nil {
+		return
+	}
+
+	err = s.wal.Close()
+	s.wal = nil
+	return
+}
+
+// replay applies an operation of the log to the products, index holds the position of each product by ID
+func replay(products *[]internal.Product, lastID *int, index map[int]int, op OperationJSON) (err error) {
+	if op.Type == OperationBatch {
+		for _, batchOp := range op.Operations {
+			if err = replay(products, lastID, index, batchOp); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	if op.Product == nil {
+		err = fmt.Errorf("%w: log operation %q without product", ErrStorageLoad, op.Type)
+		return
+	}
+
+	// deleted products are logged with their ID only
+	product, parseErr := op.Product.toProduct()
+	if op.Type != OperationDelete && parseErr != nil {
+		err = fmt.Errorf("%w: product %d: %v", ErrStorageLoad, op.Product.ID, parseErr)
+		return
+	}
+
+	*lastID = max(*lastID, op.Product.ID)
+
+	// a product moved to the trash is kept with its deletion, a delete removes it for good
+	i, exists := index[product.ID]
+	switch op.Type {
+	case OperationCreate, OperationUpdate, OperationTrash, OperationRestore:
+		if exists {
+			(*products)[i] = product
+			return
+		}
+		index[product.ID] = len(*products)
+		*products = append(*products, product)
+	case OperationDelete:
+		if !exists {
+			return
+		}
+		*products = append((*products)[:i], (*products)[i+1:]...)
+		delete(index, product.ID)
+		for id, j := range index {
+			if j > i {
+				index[id] = j - 1
+			}
+		}
+	default:
+		err = fmt.Errorf("%w: unknown log operation %q", ErrStorageLoad, op.Type)
+	}
+
+	return
+}
+
+func newOperationJSON(operation Operation) (op OperationJSON) {
+	op.Type = operation.Type
+	if operation.Type == OperationBatch {
+		for _, batchOp := range operation.Operations {
+			op.Operations = append(op.Operations, newOperationJSON(batchOp))
+		}
+		return
+	}
+
+	product := newProductJSON(operation.Product)
+	op.Product = &product
+	return
+}
+
+func newProductJSON(pr internal.Product) (product ProductJSON) {
+	product = ProductJSON{
+		ID:          pr.ID,
+		Name:        pr.Name,
+		Quantity:    pr.Quantity,
+		CodeValue:   pr.CodeValue,
+		IsPublished: pr.IsPublished,
+		Expiration:  pr.Expiration.Format(tools.DateLayoutLegacy),
+		Price:       pr.Price,
+		Version:     pr.Version,
+		DeletedBy:   pr.DeletedBy,
+	}
+
+	if !pr.DeletedAt.IsZero() {
+		product.DeletedAt = pr.DeletedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return
+}
+
+func (pr ProductJSON) toProduct() (product internal.Product, err error) {
+	product = internal.Product{
+		ID:          pr.ID,
+		Name:        pr.Name,
+		Quantity:    pr.Quantity,
+		CodeValue:   pr.CodeValue,
+		IsPublished: pr.IsPublished,
+		Price:       pr.Price,
+		Version:     pr.Version,
+		DeletedBy:   pr.DeletedBy,
+	}
+
+	// the products saved before the versions were introduced are at their first version
+	if product.Version < 1 {
+		product.Version = 1
+	}
+
+	if pr.DeletedAt != "" {
+		if product.DeletedAt, err = time.Parse(time.RFC3339Nano, pr.DeletedAt); err != nil {
+			return
+		}
+	}
+
+	product.Expiration, err = tools.ParseDate(pr.Expiration)
+	return
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
+
+// tornFile is a log file whose writes fail after writing half of their bytes while fail is set
+type tornFile struct {
+	*os.File
+	fail bool
+}
+
+func (f *tornFile) Write(data []byte) (n int, err error) {
+	if !f.fail {
+		return f.File.Write(data)
+	}
+
+	n, _ = f.File.Write(data[:len(data)/2])
+	err = errors.New("disk full")
+	return
+}
+
+func newTestProduct(id int, code string) internal.Product {
+	return internal.Product{
+		ID:         id,
+		Name:       "Product " + code,
+		Quantity:   1,
+		CodeValue:  code,
+		Expiration: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Price:      10,
+		Version:    1,
+	}
+}
+
+// TestStorageDefault_AppendTorn checks that a failed append leaves nothing in the log, so the
+// next entries are replayed and the failed one is not
+func TestStorageDefault_AppendTorn(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "products.json")
+
+	st := NewStorageDefault(filePath)
+	if err := st.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := &tornFile{File: st.wal.(*os.File)}
+	st.wal = file
+
+	if err := st.Append(Operation{Type: OperationCreate, Product: newTestProduct(1, "A")}); err != nil {
+		t.Fatal(err)
+	}
+
+	file.fail = true
+	if err := st.Append(Operation{Type: OperationCreate, Product: newTestProduct(2, "B")}); !errors.Is(err, ErrStorageAppend) {
+		t.Fatalf("got error %v, want %v", err, ErrStorageAppend)
+	}
+
+	file.fail = false
+	if err := st.Append(Operation{Type: OperationCreate, Product: newTestProduct(2, "C")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	st = NewStorageDefault(filePath)
+	if err := st.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	products, _, err := st.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(products) != 2 || products[0].CodeValue != "A" || products[1].CodeValue != "C" {
+		t.Fatalf("got products %+v, want A and C", products)
+	}
+}
+
+// TestStorageDefault_LoadArray checks that a snapshot with the products only is read with the
+// highest ID as its last ID, and is saved back with the last ID
+func TestStorageDefault_LoadArray(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "products.json")
+	data := `[{"id":2,"name":"Product B","quantity":1,"code_value":"B","is_published":false,"expiration":"01/01/2030","price":10},
+{"id":7,"name":"Product C","quantity":1,"code_value":"C","is_published":false,"expiration":"01/01/2030","price":10}]`
+	if err := os.WriteFile(filePath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	st := NewStorageDefault(filePath)
+	products, lastID, err := st.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 2 || lastID != 7 {
+		t.Fatalf("got %d products and last ID %d, want 2 and 7", len(products), lastID)
+	}
+
+	if err = st.Save(products[:1], lastID); err != nil {
+		t.Fatal(err)
+	}
+	if products, lastID, err = st.Load(); err != nil || len(products) != 1 || lastID != 7 {
+		t.Fatalf("got %d products, last ID %d and error %v, want 1 product and last ID 7", len(products), lastID, err)
+	}
+}
+
+// TestStorageDefault_Locked checks that a storage can't be opened twice, until it is closed
+func TestStorageDefault_Locked(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "products.json")
+
+	first := NewStorageDefault(filePath)
+	if err := first.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewStorageDefault(filePath).Open(); !errors.Is(err, ErrStorageLocked) {
+		t.Fatalf("got error %v, want %v", err, ErrStorageLocked)
+	}
+
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	second := NewStorageDefault(filePath)
+	if err := second.Open(); err != nil {
+		t.Fatal(err)
+	}
+	second.Close()
+}
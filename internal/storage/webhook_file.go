@@ -0,0 +1,575 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+	"github.com/edwinbm5/go-product-web/internal/platform/tools"
+)
+
+const (
+	// WebhookFileDelivered is the number of delivered deliveries kept as history, the oldest are dropped
+	WebhookFileDelivered = 1000
+	// WebhookFileDead is the number of dead deliveries kept in the dead-letter list, the oldest are dropped
+	WebhookFileDead = 1000
+	// WebhookFileCompactEvery is the number of changes of the queue appended to the log before it is
+	// written into the file
+	WebhookFileCompactEvery = 1000
+)
+
+// Types of the entries of the log of the queue
+const (
+	webhookLogEnqueue  = "enqueue"
+	webhookLogDelivery = "delivery"
+)
+
+// WebhookFile is a repository of the webhooks and their delivery queue stored in a JSON file. The
+// webhooks are saved into the file, the changes of the queue are appended to a log next to it and
+// written into the file every WebhookFileCompactEvery changes. Every change is saved before it is
+// visible, so a queued delivery survives a restart
+type WebhookFile struct {
+	FilePath string
+	LogPath  string
+
+	mu    sync.RWMutex
+	state webhookState
+	log   *os.File
+	// logged is the number of entries of the log
+	logged int
+}
+
+// NewWebhookFile creates a new WebhookFile, an empty file path keeps the webhooks in memory only.
+// The log is stored in filePath + ".wal"
+func NewWebhookFile(filePath string) *WebhookFile {
+	f := &WebhookFile{
+		FilePath: filePath,
+	}
+	if filePath != "" {
+		f.LogPath = filePath + ".wal"
+	}
+	return f
+}
+
+// webhookState is the content of the file
+type webhookState struct {
+	Sequence       int64                 `json:"sequence"`
+	LastWebhookID  int                   `json:"last_webhook_id"`
+	LastDeliveryID int                   `json:"last_delivery_id"`
+	Webhooks       []WebhookJSON         `json:"webhooks"`
+	Deliveries     []WebhookDeliveryJSON `json:"deliveries"`
+}
+
+type WebhookJSON struct {
+	ID         int       `json:"id"`
+	URL        string    `json:"url"`
+	Events     []string  `json:"events"`
+	ProductIDs []int     `json:"product_ids"`
+	Secret     string    `json:"secret"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type WebhookAttemptJSON struct {
+	Time       time.Time     `json:"time"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Err        string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
+
+type WebhookDeliveryJSON struct {
+	ID          int                  `json:"id"`
+	WebhookID   int                  `json:"webhook_id"`
+	Event       EventJSON            `json:"event"`
+	Status      string               `json:"status"`
+	Attempts    []WebhookAttemptJSON `json:"attempts"`
+	Failures    int                  `json:"failures"`
+	NextAttempt time.Time            `json:"next_attempt"`
+	CreatedAt   time.Time            `json:"created_at"`
+}
+
+// webhookLogEntryJSON is a change of the queue in the log, the deliveries queued up to the sequence
+// or a delivery saved
+type webhookLogEntryJSON struct {
+	Type       string                `json:"type"`
+	Sequence   int64                 `json:"sequence,omitempty"`
+	Deliveries []WebhookDeliveryJSON `json:"deliveries"`
+}
+
+// Load reads the file, replays the log on top of it and opens the log for appending. A missing
+// file has no webhooks. Close must be called to close the log
+func (f *WebhookFile) Load() (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.FilePath == "" {
+		return
+	}
+
+	var state webhookState
+	data, err := os.ReadFile(f.FilePath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		err = nil
+	case err != nil:
+		err = fmt.Errorf("%w: %v", ErrStorageLoad, err)
+		return
+	default:
+		if err = json.Unmarshal(data, &state); err != nil {
+			err = fmt.Errorf("%w: %v", ErrStorageLoad, err)
+			return
+		}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(f.LogPath), 0755); err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageOpen, err)
+		return
+	}
+
+	log, err := os.OpenFile(f.LogPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageOpen, err)
+		return
+	}
+
+	// as in the log of the storage, a line without its newline is a torn write and is discarded
+	valid, logged := int64(0), 0
+	reader := bufio.NewReader(log)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil {
+			break
+		}
+
+		var entry webhookLogEntryJSON
+		if err = json.Unmarshal(line, &entry); err != nil {
+			log.Close()
+			err = fmt.Errorf("%w: corrupted webhook log entry at offset %d: %v", ErrStorageLoad, valid, err)
+			return
+		}
+		valid += int64(len(line))
+		logged++
+
+		state.apply(entry)
+	}
+
+	if err = log.Truncate(valid); err != nil {
+		log.Close()
+		err = fmt.Errorf("%w: %v", ErrStorageLoad, err)
+		return
+	}
+
+	if f.log != nil {
+		f.log.Close()
+	}
+	f.state, f.log, f.logged = state, log, logged
+	return
+}
+
+// Close closes the log
+func (f *WebhookFile) Close() (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.log == nil {
+		return
+	}
+
+	err = f.log.Close()
+	f.log = nil
+	return
+}
+
+// GetAll returns all the webhooks
+func (f *WebhookFile) GetAll() (webhooks []internal.Webhook, err error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	webhooks = make([]internal.Webhook, 0, len(f.state.Webhooks))
+	for _, wh := range f.state.Webhooks {
+		webhooks = append(webhooks, wh.toWebhook())
+	}
+	return
+}
+
+// GetByID returns a webhook by its ID
+func (f *WebhookFile) GetByID(id int) (webhook internal.Webhook, err error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	index := f.webhookIndex(id)
+	if index < 0 {
+		err = fmt.Errorf("%w: The webhook with ID %d does not exist", internal.ErrWebhookNotFound, id)
+		return
+	}
+
+	webhook = f.state.Webhooks[index].toWebhook()
+	return
+}
+
+// Create assigns the next ID to the webhook and saves it
+func (f *WebhookFile) Create(webhook *internal.Webhook) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state := f.clone()
+	state.LastWebhookID++
+	webhook.ID = state.LastWebhookID
+	state.Webhooks = append(state.Webhooks, newWebhookJSON(*webhook))
+
+	err = f.save(state)
+	return
+}
+
+// Update replaces a webhook
+func (f *WebhookFile) Update(webhook *internal.Webhook) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	index := f.webhookIndex(webhook.ID)
+	if index < 0 {
+		err = fmt.Errorf("%w: The webhook with ID %d does not exist", internal.ErrWebhookNotFound, webhook.ID)
+		return
+	}
+
+	state := f.clone()
+	state.Webhooks[index] = newWebhookJSON(*webhook)
+
+	err = f.save(state)
+	return
+}
+
+// Delete removes a webhook and its deliveries
+func (f *WebhookFile) Delete(id int) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	index := f.webhookIndex(id)
+	if index < 0 {
+		err = fmt.Errorf("%w: The webhook with ID %d does not exist", internal.ErrWebhookNotFound, id)
+		return
+	}
+
+	state := f.clone()
+	state.Webhooks = slices.Delete(state.Webhooks, index, index+1)
+	state.Deliveries = slices.DeleteFunc(state.Deliveries, func(d WebhookDeliveryJSON) bool { return d.WebhookID == id })
+
+	err = f.save(state)
+	return
+}
+
+// Sequence returns the sequence of the last event queued
+func (f *WebhookFile) Sequence() (sequence int64) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	sequence = f.state.Sequence
+	return
+}
+
+// Enqueue assigns the next IDs to the deliveries and appends them to the log with the sequence
+func (f *WebhookFile) Enqueue(deliveries []internal.WebhookDelivery, sequence int64) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry := webhookLogEntryJSON{Type: webhookLogEnqueue, Sequence: sequence, Deliveries: make([]WebhookDeliveryJSON, 0, len(deliveries))}
+	for index := range deliveries {
+		entry.Deliveries = append(entry.Deliveries, newWebhookDeliveryJSON(deliveries[index]))
+		entry.Deliveries[index].ID = f.state.LastDeliveryID + index + 1
+	}
+
+	if err = f.append(entry); err != nil {
+		return
+	}
+
+	for index := range deliveries {
+		deliveries[index].ID = entry.Deliveries[index].ID
+	}
+	return
+}
+
+// Due returns up to limit pending deliveries whose next attempt is before now
+func (f *WebhookFile) Due(now time.Time, limit int) (deliveries []internal.WebhookDelivery, err error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, d := range f.state.Deliveries {
+		if len(deliveries) == limit {
+			break
+		}
+
+		if d.Status == internal.WebhookDeliveryPending && !d.NextAttempt.After(now) {
+			deliveries = append(deliveries, d.toWebhookDelivery())
+		}
+	}
+	return
+}
+
+// GetDelivery returns a delivery by its ID
+func (f *WebhookFile) GetDelivery(id int) (delivery internal.WebhookDelivery, err error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	index := f.deliveryIndex(id)
+	if index < 0 {
+		err = fmt.Errorf("%w: The delivery with ID %d does not exist", internal.ErrWebhookDeliveryNotFound, id)
+		return
+	}
+
+	delivery = f.state.Deliveries[index].toWebhookDelivery()
+	return
+}
+
+// Deliveries returns the deliveries that match the query, the newest first
+func (f *WebhookFile) Deliveries(query internal.WebhookDeliveryQuery) (deliveries []internal.WebhookDelivery, err error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	deliveries = []internal.WebhookDelivery{}
+	for i := len(f.state.Deliveries) - 1; i >= 0; i-- {
+		delivery := f.state.Deliveries[i].toWebhookDelivery()
+		if query.Match(delivery) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return
+}
+
+// SaveDelivery replaces a delivery and appends it to the log. The oldest delivered deliveries are
+// dropped past WebhookFileDelivered, and the oldest dead ones past WebhookFileDead
+func (f *WebhookFile) SaveDelivery(delivery *internal.WebhookDelivery) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.deliveryIndex(delivery.ID) < 0 {
+		err = fmt.Errorf("%w: The delivery with ID %d does not exist", internal.ErrWebhookDeliveryNotFound, delivery.ID)
+		return
+	}
+
+	err = f.append(webhookLogEntryJSON{Type: webhookLogDelivery, Deliveries: []WebhookDeliveryJSON{newWebhookDeliveryJSON(*delivery)}})
+	return
+}
+
+// apply makes a change of the log on the state. The changes already in the state, left in the log
+// by a crash after the file was written, are applied again without effect
+func (s *webhookState) apply(entry webhookLogEntryJSON) {
+	switch entry.Type {
+	case webhookLogEnqueue:
+		for _, delivery := range entry.Deliveries {
+			if delivery.ID > s.LastDeliveryID {
+				s.Deliveries = append(s.Deliveries, delivery)
+				s.LastDeliveryID = delivery.ID
+			}
+		}
+		s.Sequence = max(s.Sequence, entry.Sequence)
+	case webhookLogDelivery:
+		for _, delivery := range entry.Deliveries {
+			// the deliveries of a deleted webhook are gone
+			index := slices.IndexFunc(s.Deliveries, func(d WebhookDeliveryJSON) bool { return d.ID == delivery.ID })
+			if index >= 0 {
+				s.Deliveries[index] = delivery
+			}
+		}
+		s.trim()
+	}
+}
+
+// trim drops the oldest delivered deliveries past WebhookFileDelivered and the oldest dead ones past WebhookFileDead
+func (s *webhookState) trim() {
+	delivered, dead := 0, 0
+	for i := len(s.Deliveries) - 1; i >= 0; i-- {
+		drop := false
+		switch s.Deliveries[i].Status {
+		case internal.WebhookDeliveryDelivered:
+			delivered++
+			drop = delivered > WebhookFileDelivered
+		case internal.WebhookDeliveryDead:
+			dead++
+			drop = dead > WebhookFileDead
+		}
+
+		if drop {
+			s.Deliveries = slices.Delete(s.Deliveries, i, i+1)
+		}
+	}
+}
+
+// webhookIndex returns the position of a webhook, or -1
+func (f *WebhookFile) webhookIndex(id int) int {
+	return slices.IndexFunc(f.state.Webhooks, func(wh WebhookJSON) bool { return wh.ID == id })
+}
+
+// deliveryIndex returns the position of a delivery, or -1
+func (f *WebhookFile) deliveryIndex(id int) int {
+	return slices.IndexFunc(f.state.Deliveries, func(d WebhookDeliveryJSON) bool { return d.ID == id })
+}
+
+// clone copies the state, so a change that fails to be saved is discarded
+func (f *WebhookFile) clone() (state webhookState) {
+	state = f.state
+	state.Webhooks = slices.Clone(f.state.Webhooks)
+	state.Deliveries = slices.Clone(f.state.Deliveries)
+	return
+}
+
+// save writes the state into the file and makes it the current one, the file is only readable
+// by its owner since it holds the secrets of the webhooks
+func (f *WebhookFile) save(state webhookState) (err error) {
+	if f.FilePath == "" {
+		f.state = state
+		return
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageSave, err)
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(f.FilePath), 0755); err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageSave, err)
+		return
+	}
+
+	if err = tools.WriteFileAtomic(f.FilePath, data); err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageSave, err)
+		return
+	}
+
+	f.state = state
+
+	// the changes of the log are now in the file, a log left behind by a failure is replayed
+	// without effect on the next load
+	if f.log == nil {
+		return
+	}
+
+	if err = f.log.Truncate(0); err == nil {
+		err = f.log.Sync()
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageSave, err)
+		return
+	}
+
+	f.logged = 0
+	return
+}
+
+// append writes a change of the queue at the end of the log and applies it on the state once it is
+// on disk. The log is written into the file every WebhookFileCompactEvery changes
+func (f *WebhookFile) append(entry webhookLogEntryJSON) (err error) {
+	if f.FilePath == "" {
+		f.state.apply(entry)
+		return
+	}
+
+	if f.log == nil {
+		err = fmt.Errorf("%w: webhook log is not open", ErrStorageAppend)
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrStorageAppend, err)
+		return
+	}
+
+	// the bytes of a failed write are cut from the log, or the next entry would be written after them
+	offset, err := f.log.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = f.log.Write(append(line, '\n'))
+	}
+	if err == nil {
+		err = f.log.Sync()
+	}
+	if err != nil {
+		if truncateErr := f.log.Truncate(offset); truncateErr == nil {
+			f.log.Sync()
+		}
+		err = fmt.Errorf("%w: %v", ErrStorageAppend, err)
+		return
+	}
+
+	f.state.apply(entry)
+	f.logged++
+
+	// the change is on disk, a failed compaction is tried again on the next change
+	if f.logged >= WebhookFileCompactEvery {
+		f.save(f.clone())
+	}
+	return
+}
+
+func newWebhookJSON(webhook internal.Webhook) WebhookJSON {
+	return WebhookJSON{
+		ID:         webhook.ID,
+		URL:        webhook.URL,
+		Events:     webhook.Events,
+		ProductIDs: webhook.ProductIDs,
+		Secret:     webhook.Secret,
+		Active:     webhook.Active,
+		CreatedAt:  webhook.CreatedAt,
+		UpdatedAt:  webhook.UpdatedAt,
+	}
+}
+
+func (wh WebhookJSON) toWebhook() internal.Webhook {
+	return internal.Webhook{
+		ID:         wh.ID,
+		URL:        wh.URL,
+		Events:     slices.Clone(wh.Events),
+		ProductIDs: slices.Clone(wh.ProductIDs),
+		Secret:     wh.Secret,
+		Active:     wh.Active,
+		CreatedAt:  wh.CreatedAt,
+		UpdatedAt:  wh.UpdatedAt,
+	}
+}
+
+func newWebhookDeliveryJSON(delivery internal.WebhookDelivery) (d WebhookDeliveryJSON) {
+	d = WebhookDeliveryJSON{
+		ID:          delivery.ID,
+		WebhookID:   delivery.WebhookID,
+		Event:       newEventJSON(delivery.Event),
+		Status:      delivery.Status,
+		Attempts:    make([]WebhookAttemptJSON, 0, len(delivery.Attempts)),
+		Failures:    delivery.Failures,
+		NextAttempt: delivery.NextAttempt,
+		CreatedAt:   delivery.CreatedAt,
+	}
+
+	for _, attempt := range delivery.Attempts {
+		d.Attempts = append(d.Attempts, WebhookAttemptJSON(attempt))
+	}
+	return
+}
+
+func (d WebhookDeliveryJSON) toWebhookDelivery() (delivery internal.WebhookDelivery) {
+	delivery = internal.WebhookDelivery{
+		ID:          d.ID,
+		WebhookID:   d.WebhookID,
+		Event:       internal.ProductEvent{Sequence: d.Event.Sequence, Type: d.Event.Type, Time: d.Event.Time},
+		Status:      d.Status,
+		Failures:    d.Failures,
+		NextAttempt: d.NextAttempt,
+		CreatedAt:   d.CreatedAt,
+	}
+
+	// the deleted products have their ID only, their expiration is not a date
+	delivery.Event.Product, _ = d.Event.Product.toProduct()
+
+	for _, attempt := range d.Attempts {
+		delivery.Attempts = append(delivery.Attempts, internal.WebhookAttempt(attempt))
+	}
+	return
+}
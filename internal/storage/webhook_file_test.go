@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal"
+)
+
+// TestWebhookFile_Reload checks that the webhooks, the queue and its sequence survive a restart
+func TestWebhookFile_Reload(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "webhooks.json")
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	repository := NewWebhookFile(filePath)
+	if err := repository.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	webhook := internal.Webhook{URL: "http://localhost/hook", Secret: "test-secret-0123456789", Active: true, ProductIDs: []int{1}}
+	if err := repository.Create(&webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries := []internal.WebhookDelivery{
+		{WebhookID: webhook.ID, Event: internal.ProductEvent{Sequence: 3, Type: internal.ProductEventDeleted, Product: internal.Product{ID: 1}}, Status: internal.WebhookDeliveryPending, NextAttempt: now},
+		{WebhookID: webhook.ID, Event: internal.ProductEvent{Sequence: 4, Type: internal.ProductEventDeleted, Product: internal.Product{ID: 1}}, Status: internal.WebhookDeliveryPending, NextAttempt: now.Add(time.Minute)},
+	}
+	if err := repository.Enqueue(deliveries, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repository.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	repository = NewWebhookFile(filePath)
+	if err := repository.Load(); err != nil {
+		t.Fatal(err)
+	}
+	defer repository.Close()
+
+	if sequence := repository.Sequence(); sequence != 4 {
+		t.Fatalf("got sequence %d, want 4", sequence)
+	}
+
+	if stored, err := repository.GetByID(webhook.ID); err != nil || stored.Secret != webhook.Secret || len(stored.ProductIDs) != 1 {
+		t.Fatalf("got webhook %+v and error %v, want %+v", stored, err, webhook)
+	}
+
+	// only the first delivery is due
+	due, err := repository.Due(now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].ID != deliveries[0].ID || due[0].Event.Sequence != 3 {
+		t.Fatalf("got deliveries due %+v, want the delivery %d", due, deliveries[0].ID)
+	}
+}
+
+// TestWebhookFile_Log checks that the changes of the queue are appended to the log without writing
+// the file, and that a torn entry at the end of the log is discarded on load
+func TestWebhookFile_Log(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "webhooks.json")
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	repository := NewWebhookFile(filePath)
+	if err := repository.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	webhook := internal.Webhook{URL: "http://localhost/hook", Secret: "test-secret-0123456789", Active: true}
+	if err := repository.Create(&webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries := []internal.WebhookDelivery{
+		{WebhookID: webhook.ID, Event: internal.ProductEvent{Sequence: 1, Type: internal.ProductEventDeleted, Product: internal.Product{ID: 1}}, Status: internal.WebhookDeliveryPending, NextAttempt: now},
+		{WebhookID: webhook.ID, Event: internal.ProductEvent{Sequence: 2, Type: internal.ProductEventDeleted, Product: internal.Product{ID: 2}}, Status: internal.WebhookDeliveryPending, NextAttempt: now},
+	}
+	if err := repository.Enqueue(deliveries, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries[0].Status = internal.WebhookDeliveryDelivered
+	if err := repository.SaveDelivery(&deliveries[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := os.ReadFile(filePath); err != nil || string(data) != string(saved) {
+		t.Fatalf("got the file rewritten by the queue, want the changes in the log only")
+	}
+
+	// a crash in the middle of an append leaves a line without its newline
+	log, err := os.OpenFile(repository.LogPath, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.WriteString(`{"type":"delivery","deliveries":[{"id":2,`); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+
+	if err := repository.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	repository = NewWebhookFile(filePath)
+	if err := repository.Load(); err != nil {
+		t.Fatal(err)
+	}
+	defer repository.Close()
+
+	if sequence := repository.Sequence(); sequence != 2 {
+		t.Fatalf("got sequence %d, want 2", sequence)
+	}
+
+	stored, err := repository.Deliveries(internal.WebhookDeliveryQuery{WebhookID: webhook.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[int]string{}
+	for _, delivery := range stored {
+		statuses[delivery.ID] = delivery.Status
+	}
+	if len(statuses) != 2 || statuses[deliveries[0].ID] != internal.WebhookDeliveryDelivered || statuses[deliveries[1].ID] != internal.WebhookDeliveryPending {
+		t.Fatalf("got deliveries %+v, want the first delivered and the second pending", stored)
+	}
+
+	// the next delivery gets the next ID after the replay
+	next := []internal.WebhookDelivery{{WebhookID: webhook.ID, Event: internal.ProductEvent{Sequence: 3, Type: internal.ProductEventDeleted, Product: internal.Product{ID: 3}}, Status: internal.WebhookDeliveryPending, NextAttempt: now}}
+	if err := repository.Enqueue(next, 3); err != nil {
+		t.Fatal(err)
+	}
+	if next[0].ID != deliveries[1].ID+1 {
+		t.Fatalf("got delivery ID %d, want %d", next[0].ID, deliveries[1].ID+1)
+	}
+}
+
+// TestWebhookFile_Dead checks that the oldest dead deliveries are dropped past WebhookFileDead
+func TestWebhookFile_Dead(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	repository := NewWebhookFile("")
+	webhook := internal.Webhook{URL: "http://localhost/hook", Secret: "test-secret-0123456789", Active: true}
+	if err := repository.Create(&webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries := make([]internal.WebhookDelivery, WebhookFileDead+2)
+	for index := range deliveries {
+		deliveries[index] = internal.WebhookDelivery{WebhookID: webhook.ID, Event: internal.ProductEvent{Sequence: int64(index + 1), Type: internal.ProductEventDeleted, Product: internal.Product{ID: 1}}, Status: internal.WebhookDeliveryPending, NextAttempt: now}
+	}
+	if err := repository.Enqueue(deliveries, int64(len(deliveries))); err != nil {
+		t.Fatal(err)
+	}
+
+	for index := range deliveries {
+		deliveries[index].Status = internal.WebhookDeliveryDead
+		if err := repository.SaveDelivery(&deliveries[index]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dead, err := repository.Deliveries(internal.WebhookDeliveryQuery{WebhookID: webhook.ID, Status: internal.WebhookDeliveryDead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != WebhookFileDead {
+		t.Fatalf("got %d dead deliveries, want %d", len(dead), WebhookFileDead)
+	}
+
+	for _, delivery := range dead {
+		if delivery.ID == deliveries[0].ID || delivery.ID == deliveries[1].ID {
+			t.Fatalf("got the dead delivery %d, want the oldest dropped", delivery.ID)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/edwinbm5/go-product-web/internal/platform/validate"
+)
+
+// Statuses of a delivery, a dead delivery ran out of attempts and is kept in the dead-letter list
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+// WebhookDeliveryStatuses are all the statuses of a delivery
+var WebhookDeliveryStatuses = []string{WebhookDeliveryPending, WebhookDeliveryDelivered, WebhookDeliveryDead}
+
+var (
+	ErrWebhookNotFound         = errors.New("Webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("Webhook delivery not found")
+	// ErrWebhookDeliveryPending is returned when a delivery still being attempted is sent again
+	ErrWebhookDeliveryPending = errors.New("Webhook delivery is pending")
+)
+
+// Webhook is a subscriber URL notified of the events of the products
+type Webhook struct {
+	ID  int
+	URL string
+	// Events are the types of the events sent, all of them when empty
+	Events []string
+	// ProductIDs are the products whose events are sent, all of them when empty
+	ProductIDs []int
+	// Secret is the key of the HMAC-SHA256 signature of the payloads
+	Secret string
+	// Active webhooks receive the events, the new events are not queued for an inactive webhook
+	Active    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Match reports whether the event passes the filters of the webhook
+func (w Webhook) Match(event ProductEvent) bool {
+	if len(w.Events) > 0 && !slices.Contains(w.Events, event.Type) {
+		return false
+	}
+
+	return len(w.ProductIDs) == 0 || slices.Contains(w.ProductIDs, event.Product.ID)
+}
+
+// WebhookSchema are the rules of the webhook fields, named as in the JSON payloads
+var WebhookSchema = validate.Schema{
+	{Name: "url", Rules: []validate.Rule{validate.Required(), validate.String(), validate.Length(1, 2048), validate.URL("http", "https")}},
+	{Name: "events", Rules: []validate.Rule{validate.Each(validate.String(),
+		validate.OneOf(ProductEventCreated, ProductEventUpdated, ProductEventDeleted, ProductEventRestored))}},
+	{Name: "product_ids", Rules: []validate.Rule{validate.Each(validate.Integer(), validate.Positive())}},
+	{Name: "secret", Rules: []validate.Rule{validate.String(), validate.Length(16, 256)}},
+	{Name: "active", Rules: []validate.Rule{validate.Bool()}},
+}
+
+// ValidateWebhook checks every field of a webhook against the WebhookSchema
+func ValidateWebhook(webhook Webhook) (err error) {
+	err = WebhookSchema.Validate(map[string]any{
+		"url":         webhook.URL,
+		"events":      webhook.Events,
+		"product_ids": webhook.ProductIDs,
+		"secret":      webhook.Secret,
+		"active":      webhook.Active,
+	})
+	return
+}
+
+// WebhookAttempt is an attempt of a delivery, StatusCode is 0 when no response was received
+type WebhookAttempt struct {
+	Time       time.Time
+	StatusCode int
+	Err        string
+	Duration   time.Duration
+}
+
+// WebhookDelivery is an event queued for a webhook, with the history of its attempts
+type WebhookDelivery struct {
+	ID        int
+	WebhookID int
+	Event     ProductEvent
+	Status    string
+	Attempts  []WebhookAttempt
+	// Failures are the failed attempts since the delivery was queued, they set the wait before the next one
+	Failures int
+	// NextAttempt is when a pending delivery is attempted again
+	NextAttempt time.Time
+	CreatedAt   time.Time
+}
+
+// WebhookDeliveryQuery filters the deliveries, the zero values match every delivery
+type WebhookDeliveryQuery struct {
+	WebhookID int
+	Status    string
+}
+
+// Match reports whether the delivery passes the filters of the query
+func (q WebhookDeliveryQuery) Match(delivery WebhookDelivery) bool {
+	return (q.WebhookID == 0 || q.WebhookID == delivery.WebhookID) &&
+		(q.Status == "" || q.Status == delivery.Status)
+}
+
+type WebhookRepository interface {
+	GetAll() (webhooks []Webhook, err error)
+	GetByID(id int) (webhook Webhook, err error)
+	Create(webhook *Webhook) (err error)
+	Update(webhook *Webhook) (err error)
+	// Delete removes the webhook and its deliveries
+	Delete(id int) (err error)
+	// Sequence is the sequence of the last event queued
+	Sequence() (sequence int64)
+	// Enqueue adds the deliveries of the events up to the sequence, the deliveries and the sequence
+	// are saved at once so an event is queued only once
+	Enqueue(deliveries []WebhookDelivery, sequence int64) (err error)
+	// Due returns up to limit pending deliveries whose next attempt is before now, the oldest first
+	Due(now time.Time, limit int) (deliveries []WebhookDelivery, err error)
+	GetDelivery(id int) (delivery WebhookDelivery, err error)
+	// Deliveries returns the deliveries that match the query, the newest first
+	Deliveries(query WebhookDeliveryQuery) (deliveries []WebhookDelivery, err error)
+	SaveDelivery(delivery *WebhookDelivery) (err error)
+}
+
+// WebhookService manages the webhooks and their deliveries
+type WebhookService interface {
+	GetAll(ctx context.Context) (webhooks []Webhook, err error)
+	GetByID(ctx context.Context, id int) (webhook Webhook, err error)
+	// Create generates the secret of the webhooks created without one
+	Create(ctx context.Context, webhook *Webhook) (err error)
+	// Update replaces the webhook, its secret is kept when the webhook has none
+	Update(ctx context.Context, webhook *Webhook) (err error)
+	Delete(ctx context.Context, id int) (err error)
+	Deliveries(ctx context.Context, query WebhookDeliveryQuery) (deliveries []WebhookDelivery, err error)
+	// Redeliver queues a delivered or dead delivery again, its attempts are kept in the history
+	Redeliver(ctx context.Context, id int) (delivery WebhookDelivery, err error)
+}